@@ -1,46 +1,85 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
+	"os"
 	"time"
+	"weather/internal/alerts"
+	"weather/internal/apikey"
 	"weather/internal/application"
+	"weather/internal/bounce"
+	"weather/internal/clock"
 	"weather/internal/config"
 	"weather/internal/database"
 	"weather/internal/env"
+	"weather/internal/janitor"
+	"weather/internal/lock"
 	"weather/internal/mailer"
+	"weather/internal/models"
+	"weather/internal/outbox"
+	"weather/internal/ratelimit"
+	"weather/internal/secrets"
 	"weather/internal/store"
+	"weather/internal/telegram"
 	"weather/internal/weather"
+	"weather/internal/webhook"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
 
-	dbName := env.GetString("DB_NAME", "weather")
-	dbPassword := env.GetString("DB_PASSWORD", "")
-	dbUser := env.GetString("DB_USER", "postgres")
-	dbHost := env.GetString("DB_HOST", "localhost")
-	dbPort := env.GetInt("DB_PORT", 5432)
-	dbSSL := env.GetString("DB_SSL_MODE", "")
-
-	dbAddr := fmt.Sprintf(
-		"user=%s password=%s host=%s port=%d dbname=%s sslmode=%s",
-		dbUser,
-		dbPassword,
-		dbHost,
-		dbPort,
-		dbName,
-		dbSSL,
-	)
+	dbPassword, err := secrets.FromEnv("DB_PASSWORD", "")
+	if err != nil {
+		log.Panic(err)
+	}
 
 	dbCfg := config.DBConfig{
-		Addr:         dbAddr,
+		Driver:       env.GetString("DB_DRIVER", "postgres"),
+		Path:         env.GetString("DB_PATH", "weather.db"),
+		Host:         env.GetString("DB_HOST", "localhost"),
+		Port:         env.GetInt("DB_PORT", 5432),
+		User:         env.GetString("DB_USER", "postgres"),
+		Password:     dbPassword,
+		Name:         env.GetString("DB_NAME", "weather"),
+		SSLMode:      env.GetString("DB_SSL_MODE", ""),
 		MaxOpenConns: env.GetInt("MAX_OPEN_CONNS", 30),
 		MaxIdleConns: env.GetInt("DB_MAX_IDLE_CONNS", 30),
 		MaxIdleTime:  env.GetString("DB_MAX_IDLE_TIME", "15m"),
 	}
 
+	adminToken, err := secrets.FromEnv("ADMIN_TOKEN", "")
+	if err != nil {
+		log.Panic(err)
+	}
+
+	bounceWebhookSecret, err := secrets.FromEnv("BOUNCE_WEBHOOK_SECRET", "")
+	if err != nil {
+		log.Panic(err)
+	}
+
+	rateLimitCfg := config.RateLimitConfig{
+		Store: env.GetString("RATE_LIMIT_STORE", "memory"),
+	}
+	policies := []struct {
+		policy *ratelimit.Policy
+		name   string
+		env    string
+		spec   string
+	}{
+		{&rateLimitCfg.Subscribe, "subscribe", "RATE_LIMIT_SUBSCRIBE", "10/1h"},
+		{&rateLimitCfg.SubscribeEmail, "subscribe_email", "RATE_LIMIT_SUBSCRIBE_EMAIL", "3/1h"},
+		{&rateLimitCfg.Weather, "weather", "RATE_LIMIT_WEATHER", "60/1m"},
+	}
+	for _, p := range policies {
+		if *p.policy, err = ratelimit.ParsePolicy(p.name, env.GetString(p.env, p.spec)); err != nil {
+			log.Panic(err)
+		}
+	}
+
 	appPort := env.GetInt("APP_PORT", 8080)
 	readTimeoutDuration := time.Duration(env.GetInt("READ_TIMEOUT", 5)) * time.Second
 	writeTimeoutDuration := time.Duration(env.GetInt("WRITE_TIMEOUT", 5)) * time.Second
@@ -51,35 +90,290 @@ func main() {
 		WriteTimeout: writeTimeoutDuration,
 		IdleTimeout:  idleTimeoutDuration,
 		DB:           dbCfg,
+		Storage:      env.GetString("STORAGE", "database"),
+		AdminToken:   adminToken,
+
+		TrustedProxies: env.GetList("TRUSTED_PROXIES", nil),
+
+		BounceWebhookSecret: bounceWebhookSecret,
+
+		WeatherRequireAuth: env.GetBool("WEATHER_REQUIRE_API_KEY", false),
+		RateLimit:          rateLimitCfg,
+		OptIn: config.OptInConfig{
+			ResendCooldown:   env.GetDuration("CONFIRMATION_RESEND_COOLDOWN", 5*time.Minute),
+			MaxSendsInWindow: env.GetInt("CONFIRMATION_MAX_SENDS", 5),
+			SendWindow:       env.GetDuration("CONFIRMATION_SEND_WINDOW", 24*time.Hour),
+			PurgeAfter:       env.GetDuration("UNCONFIRMED_PURGE_AFTER", 72*time.Hour),
+			PurgeInterval:    env.GetDuration("UNCONFIRMED_PURGE_INTERVAL", time.Hour),
+		},
 	}
 
-	db, err := database.New(dbCfg)
-	if err != nil {
-		log.Panic(err)
+	var (
+		db      *sql.DB
+		storage store.Storage
+		locker  lock.Locker
+	)
+	switch cfg.Storage {
+	// "postgres" is the name from before DB_DRIVER existed
+	case "database", "postgres", "":
+		db, err = database.New(dbCfg)
+		if err != nil {
+			log.Panic(err)
+		}
+		defer db.Close()
+
+		if dbCfg.Driver == "sqlite" {
+			// a SQLite file is only ever used by one replica
+			storage = store.NewSQLiteStorage(db, clock.Real{})
+			locker = lock.NewLocal()
+		} else {
+			storage = store.NewStorage(db)
+			locker = lock.NewPostgres(db)
+		}
+	case "memory":
+		log.Println("using in-memory storage, all data is lost on exit")
+		storage = store.NewMemoryStorage(clock.Real{})
+		locker = lock.NewLocal()
+	default:
+		log.Panicf("unknown STORAGE: %s", cfg.Storage)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		if db == nil {
+			log.Fatal("apikey commands need STORAGE=database")
+		}
+		if err := apikey.RunCLI(context.Background(), storage, os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var rateLimitStore ratelimit.Store
+	switch rateLimitCfg.Store {
+	case "postgres":
+		if db == nil || dbCfg.Driver == "sqlite" {
+			log.Panic("RATE_LIMIT_STORE=postgres needs STORAGE=database with DB_DRIVER=postgres")
+		}
+		rateLimitStore = ratelimit.NewPostgresStore(db)
+	case "memory", "":
+		rateLimitStore = ratelimit.NewMemoryStore(clock.Real{})
+	default:
+		log.Panicf("unknown RATE_LIMIT_STORE: %s", rateLimitCfg.Store)
 	}
-	defer db.Close()
 
 	weatherServiceURL := env.GetString("WEATHER_SERVICE_URL", "http://api.weatherapi.com/v1/current.json")
-	weatherApiKey := env.GetString("WEATHER_API_KEY", "fake-api-key")
+	weatherApiKey, err := secrets.FromEnv("WEATHER_API_KEY", "fake-api-key")
+	if err != nil {
+		log.Panic(err)
+	}
+	recorder := weather.NewRecorder(storage.Observation, clock.Real{}, env.GetInt("OBSERVATION_BUFFER", 1000))
 	weatherService := weather.NewRemoteService(&weather.WeatherApi{
-		BaseURL: weatherServiceURL,
-		ApiKey:  weatherApiKey,
+		BaseURL:     weatherServiceURL,
+		ForecastURL: env.GetString("WEATHER_FORECAST_URL", "http://api.weatherapi.com/v1/forecast.json"),
+		ApiKey:      weatherApiKey,
+		AirQuality:  env.GetBool("WEATHER_AIR_QUALITY", true),
+		Observer:    recorder,
+	})
+
+	smtpUser, err := secrets.FromEnv("SMTP_USER", "email")
+	if err != nil {
+		log.Panic(err)
+	}
+	smtpPassword, err := secrets.FromEnv("SMTP_PASS", "smash")
+	if err != nil {
+		log.Panic(err)
+	}
+	smtpCfg := config.SMTPConfig{
+		User:        smtpUser,
+		Password:    smtpPassword,
+		Host:        env.GetString("SMTP_HOST", "host"),
+		Port:        env.GetString("SMTP_PORT", "port"),
+		Security:    env.GetString("SMTP_SECURITY", "tls"),
+		CAFile:      env.GetString("SMTP_CA_FILE", ""),
+		PoolSize:    env.GetInt("SMTP_POOL_SIZE", 4),
+		IdleTimeout: env.GetDuration("SMTP_IDLE_TIMEOUT", 30*time.Second),
+		Timeout:     env.GetDuration("SMTP_TIMEOUT", 30*time.Second),
+		MaxPerConn:  env.GetInt("SMTP_MAX_PER_CONN", 100),
+	}
+
+	publicURL := env.GetString("PUBLIC_BASE_URL", "http://localhost:8080")
+
+	mailer, err := mailer.New(smtpCfg, publicURL, weatherService)
+	if err != nil {
+		log.Panic(err)
+	}
+	poller := weather.NewPoller(weatherService, storage.Subscription, clock.Real{}, env.GetDuration("WEATHER_POLL_INTERVAL", 30*time.Minute))
+	mailer.Snapshot = poller.Snapshot()
+	mailer.History = storage.Observation
+	mailer.Suppressions = storage.Suppression
+	mailer.Tokens = storage.Subscription
+	mailer.Workers = env.GetInt("DIGEST_WORKERS", 8)
+	mailer.Schedule = storage.Schedule
+	mailer.CatchUpGrace = env.GetDuration("DIGEST_CATCHUP_GRACE", 30*time.Minute)
+	mailer.Locker = locker
+	mailer.Targets = storage.Subscription
+
+	relay := outbox.NewRelay(storage.Outbox, clock.Real{})
+	relay.MaxAttempts = env.GetInt("OUTBOX_MAX_ATTEMPTS", 8)
+	mailer.HandleOutbox(relay)
+
+	// webhook posts get a relay of their own, so a slow endpoint never holds
+	// up emails and a post is never cut short by the email relay's run
+	var webhookRelay *outbox.Relay
+	webhookRelayTimeout := env.GetDuration("WEBHOOK_RELAY_TIMEOUT", time.Minute)
+	if env.GetBool("WEBHOOKS_ENABLED", true) {
+		webhooks := webhook.New(storage, clock.Real{})
+		webhooks.Client.Timeout = env.GetDuration("WEBHOOK_TIMEOUT", 10*time.Second)
+		webhooks.MaxFailures = env.GetInt("WEBHOOK_MAX_FAILURES", 10)
+		if webhooks.Client.Timeout <= 0 || webhooks.Client.Timeout >= webhookRelayTimeout {
+			log.Panic("WEBHOOK_TIMEOUT must be positive and shorter than WEBHOOK_RELAY_TIMEOUT")
+		}
+
+		webhookRelay = outbox.NewRelay(storage.Outbox, clock.Real{})
+		webhookRelay.MaxAttempts = relay.MaxAttempts
+		// a claimed post stays hidden from other replicas for the whole run
+		webhookRelay.Lease = webhookRelayTimeout + webhooks.Client.Timeout
+		webhooks.Handle(webhookRelay)
+		mailer.Channels[models.ChannelWebhook] = webhooks
+	}
+
+	telegramToken, err := secrets.FromEnv("TELEGRAM_BOT_TOKEN", "")
+	if err != nil {
+		log.Panic(err)
+	}
+	telegramWebhookSecret, err := secrets.FromEnv("TELEGRAM_WEBHOOK_SECRET", "")
+	if err != nil {
+		log.Panic(err)
+	}
+	var bot *telegram.Bot
+	if telegramToken.Get() != "" {
+		client := telegram.NewClient(env.GetString("TELEGRAM_API_URL", telegram.DefaultBaseURL), telegramToken)
+		bot = telegram.NewBot(client, storage, weatherService, mailer, clock.Real{})
+		bot.PollTimeout = env.GetDuration("TELEGRAM_POLL_TIMEOUT", 30*time.Second)
+		bot.WebhookURL = env.GetString("TELEGRAM_WEBHOOK_URL", "")
+		bot.WebhookSecret = telegramWebhookSecret
+		bot.Locker = locker
+		bot.LockRetry = env.GetDuration("TELEGRAM_LOCK_RETRY", 30*time.Second)
+		if bot.WebhookURL != "" && telegramWebhookSecret.Get() == "" {
+			log.Panic("TELEGRAM_WEBHOOK_URL needs TELEGRAM_WEBHOOK_SECRET")
+		}
+		mailer.Channels[models.ChannelTelegram] = bot
+	}
+
+	secretsReloadInterval := time.Duration(env.GetInt("SECRETS_RELOAD_INTERVAL", 30)) * time.Second
+	secretsWatcher := secrets.NewWatcher(secretsReloadInterval, dbPassword, adminToken, bounceWebhookSecret, telegramToken, telegramWebhookSecret, weatherApiKey, smtpUser, smtpPassword)
+
+	housekeeping := janitor.New()
+	housekeeping.Add(janitor.Task{
+		Name:     "purge unconfirmed subscriptions",
+		Interval: cfg.OptIn.PurgeInterval,
+		Run: func(ctx context.Context) error {
+			purged, err := storage.Subscription.PurgeUnconfirmed(ctx, cfg.OptIn.PurgeAfter)
+			if purged > 0 {
+				log.Printf("purged %d unconfirmed subscriptions", purged)
+			}
+			return err
+		},
+	})
+
+	housekeeping.Add(janitor.Task{
+		Name:     "resume expired pauses",
+		Interval: env.GetDuration("PAUSE_CHECK_INTERVAL", time.Minute),
+		Run: func(ctx context.Context) error {
+			return mailer.ResumeExpired(ctx, storage)
+		},
+	})
+
+	housekeeping.Add(janitor.Task{
+		Name:     "purge digest idempotency keys",
+		Interval: 24 * time.Hour,
+		Run: func(ctx context.Context) error {
+			_, err := storage.Schedule.PurgeDeliveries(ctx, 7*24*time.Hour)
+			return err
+		},
 	})
 
-	smtpUser := env.GetString("SMTP_USER", "email")
-	smtpPassword := env.GetString("SMTP_PASS", "smash")
-	smtpHost := env.GetString("SMTP_HOST", "host")
-	smtpPort := env.GetString("SMTP_PORT", "port")
+	housekeeping.Add(janitor.Task{
+		Name:     "relay outbox",
+		Interval: env.GetDuration("OUTBOX_POLL_INTERVAL", 5*time.Second),
+		Run:      relay.Run,
+	})
 
-	mailer := mailer.New(smtpUser, smtpPassword, smtpHost, smtpPort, weatherService)
+	if webhookRelay != nil {
+		housekeeping.Add(janitor.Task{
+			Name:     "relay webhook deliveries",
+			Interval: env.GetDuration("OUTBOX_POLL_INTERVAL", 5*time.Second),
+			Timeout:  webhookRelayTimeout,
+			Run:      webhookRelay.Run,
+		})
+	}
+
+	housekeeping.Add(janitor.Task{
+		Name:     "purge sent outbox messages",
+		Interval: 24 * time.Hour,
+		Run: func(ctx context.Context) error {
+			_, err := storage.Outbox.PurgeSent(ctx, 7*24*time.Hour)
+			return err
+		},
+	})
+
+	observationRetention := env.GetDuration("OBSERVATION_RETENTION", 90*24*time.Hour)
+	housekeeping.Add(janitor.Task{
+		Name:     "purge old observations",
+		Interval: 24 * time.Hour,
+		Run: func(ctx context.Context) error {
+			purged, err := storage.Observation.Purge(ctx, observationRetention)
+			if purged > 0 {
+				log.Printf("purged %d observations older than %s", purged, observationRetention)
+			}
+			return err
+		},
+	})
+
+	housekeeping.Add(janitor.Task{
+		Name:     "purge webhook delivery log",
+		Interval: 24 * time.Hour,
+		Run: func(ctx context.Context) error {
+			_, err := storage.Webhook.PurgeDeliveries(ctx, 30*24*time.Hour)
+			return err
+		},
+	})
+
+	notifier := alerts.NewNotifier(storage, weatherService, mailer, clock.Real{})
+	notifier.Snapshot = poller.Snapshot()
+	housekeeping.Add(janitor.Task{
+		Name:     "check weather alerts",
+		Interval: env.GetDuration("ALERT_CHECK_INTERVAL", 10*time.Minute),
+		Run:      notifier.Run,
+	})
+
+	if dir := env.GetString("BOUNCE_MAILBOX_DIR", ""); dir != "" {
+		mailbox := bounce.NewMailbox(dir, bounce.NewProcessor(storage, mailer))
+		housekeeping.Add(janitor.Task{
+			Name:     "scan bounce mailbox",
+			Interval: env.GetDuration("BOUNCE_SCAN_INTERVAL", 5*time.Minute),
+			Run:      mailbox.Scan,
+		})
+	}
 
 	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	// rate limits key on the client IP, which must not come from any caller's header
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Panic(err)
+	}
 	app := application.Application{
 		Config:         cfg,
-		Store:          store.NewStorage(db),
-		Router:         gin.Default(),
+		Store:          storage,
+		Router:         router,
 		WeatherService: weatherService,
+		Recorder:       recorder,
+		Poller:         poller,
 		MailerService:  mailer,
+		SecretsWatcher: secretsWatcher,
+		RateLimitStore: rateLimitStore,
+		Janitor:        housekeeping,
+		Telegram:       bot,
 	}
 
 	app.Run()
@@ -0,0 +1,215 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"weather/internal/clock"
+	"weather/internal/mailer"
+	"weather/internal/models"
+	"weather/internal/outbox"
+	"weather/internal/store"
+)
+
+// Source fetches the alerts currently published for a city, and its current
+// weather for air quality thresholds when the snapshot has none.
+type Source interface {
+	GetCityAlerts(city string) ([]models.Alert, error)
+	GetCityWeather(city string) (models.Weather, error)
+}
+
+// WeatherSnapshot serves recently polled weather.
+type WeatherSnapshot interface {
+	Get(city string) (models.Weather, bool)
+}
+
+// Composer writes the notification of an alert to one subscriber.
+type Composer interface {
+	AlertMessage(sub models.Subscription, alert models.Alert) (mailer.Message, error)
+}
+
+// Notifier checks every subscribed city for weather alerts and poor air, keeps
+// them as alert history and queues one notification per alert and subscriber
+// on the outbox. Subscribers only hear about the severities they opted in to
+// and about air from their own air quality threshold on.
+type Notifier struct {
+	store    store.Storage
+	source   Source
+	messages Composer
+	clock    clock.Clock
+
+	// Snapshot is optional, when set air quality is read from it and only
+	// fetched for cities it has no fresh reading for.
+	Snapshot WeatherSnapshot
+}
+
+func NewNotifier(store store.Storage, source Source, messages Composer, clk clock.Clock) *Notifier {
+	return &Notifier{
+		store:    store,
+		source:   source,
+		messages: messages,
+		clock:    clk,
+	}
+}
+
+// Run checks once, as a janitor task. Cities whose alerts or weather cannot
+// be fetched are logged and retried on the next run.
+func (n *Notifier) Run(ctx context.Context) error {
+	subs, err := n.store.Subscription.ListActive(ctx)
+	if err != nil {
+		return err
+	}
+
+	// cities are fetched once, and only for what someone there wants; alerts
+	// go by email, chat subscriptions have no address to send them to
+	batches := make(map[string][]models.Subscription)
+	for _, sub := range subs {
+		if !sub.Active() || !sub.HasEmail() || (len(sub.AlertSeverities) == 0 && sub.AirQualityThreshold == 0) {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(sub.City))
+		batches[key] = append(batches[key], sub)
+	}
+
+	queued := 0
+	for _, batch := range batches {
+		for _, alert := range n.cityAlerts(batch) {
+			if alert.Expired(n.clock.Now()) {
+				continue
+			}
+
+			alert.City = batch[0].City
+			if _, err := n.store.Alert.Record(ctx, &alert.Alert); err != nil {
+				return err
+			}
+
+			for _, sub := range batch {
+				if !alert.wanted(sub) {
+					continue
+				}
+				notified, err := n.notify(ctx, sub, alert.Alert)
+				if err != nil {
+					return err
+				}
+				if notified {
+					queued++
+				}
+			}
+		}
+	}
+
+	if queued > 0 {
+		log.Printf("queued %d weather alert notifications", queued)
+	}
+
+	return nil
+}
+
+// cityAlert is an alert to pass on, airQuality is the US EPA index of air
+// quality alerts and zero for those the provider published.
+type cityAlert struct {
+	models.Alert
+	airQuality int
+}
+
+// wanted reports whether sub opted in to the alert, by severity for published
+// alerts and by threshold for air quality.
+func (a cityAlert) wanted(sub models.Subscription) bool {
+	if a.airQuality > 0 {
+		return sub.AirQualityThreshold > 0 && a.airQuality >= sub.AirQualityThreshold
+	}
+	return sub.AlertSeverities.Has(a.Severity)
+}
+
+// cityAlerts returns the provider's alerts for the city of batch, and an air
+// quality alert when its air is poor enough for someone's threshold.
+func (n *Notifier) cityAlerts(batch []models.Subscription) []cityAlert {
+	city := batch[0].City
+	severities, threshold := false, 0
+	for _, sub := range batch {
+		severities = severities || len(sub.AlertSeverities) > 0
+		if sub.AirQualityThreshold > 0 && (threshold == 0 || sub.AirQualityThreshold < threshold) {
+			threshold = sub.AirQualityThreshold
+		}
+	}
+
+	alerts := []cityAlert{}
+	if severities {
+		published, err := n.source.GetCityAlerts(city)
+		if err != nil {
+			log.Printf("ERROR: cant get weather alerts for %q: %v", city, err)
+		}
+		for _, alert := range published {
+			alerts = append(alerts, cityAlert{Alert: alert})
+		}
+	}
+
+	if threshold > 0 {
+		weather, err := n.cityWeather(city)
+		if err != nil {
+			log.Printf("ERROR: cant get air quality for %q: %v", city, err)
+		} else if aq := weather.AirQuality; aq != nil && aq.USEPAIndex >= threshold {
+			alerts = append(alerts, cityAlert{Alert: n.airQualityAlert(*aq), airQuality: aq.USEPAIndex})
+		}
+	}
+
+	return alerts
+}
+
+func (n *Notifier) cityWeather(city string) (models.Weather, error) {
+	if n.Snapshot != nil {
+		if weather, ok := n.Snapshot.Get(city); ok {
+			return weather, nil
+		}
+	}
+	return n.source.GetCityWeather(city)
+}
+
+// airQualityAlert describes today's air at its index level. The id holds both,
+// so a subscriber hears about each level at most once a day, and again when
+// the air gets worse.
+func (n *Notifier) airQualityAlert(aq models.AirQuality) models.Alert {
+	now := n.clock.Now().UTC()
+	expires := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+
+	severity := models.SeverityMinor
+	switch {
+	case aq.USEPAIndex >= 5:
+		severity = models.SeveritySevere
+	case aq.USEPAIndex == 4:
+		severity = models.SeverityModerate
+	}
+
+	return models.Alert{
+		ID:          fmt.Sprintf("aqi.%s.%d", now.Format(time.DateOnly), aq.USEPAIndex),
+		Event:       models.AirQualityEvent,
+		Headline:    "Air quality is " + aq.Category(),
+		Severity:    severity,
+		Description: "Air quality: " + aq.Summary() + ".",
+		Instruction: "Limit time outdoors, especially with asthma or other breathing conditions.",
+		ExpiresAt:   &expires,
+	}
+}
+
+// notify queues the alert for sub unless it was queued before. The claim and
+// the queued message commit together, so a failed run never loses or doubles
+// a notification.
+func (n *Notifier) notify(ctx context.Context, sub models.Subscription, alert models.Alert) (bool, error) {
+	msg, err := n.messages.AlertMessage(sub, alert)
+	if err != nil {
+		return false, err
+	}
+
+	var claimed bool
+	err = n.store.WithTx(ctx, func(tx store.Storage) error {
+		claimed, err = tx.Alert.ClaimDelivery(ctx, alert.ID, sub.ID)
+		if err != nil || !claimed {
+			return err
+		}
+		return outbox.Add(ctx, tx.Outbox, mailer.OutboxTopic, msg)
+	})
+
+	return claimed && err == nil, err
+}
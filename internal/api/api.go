@@ -3,26 +3,104 @@ package api
 import (
 	"weather/internal/api/handlers"
 	"weather/internal/api/middleware"
+	"weather/internal/bounce"
+	"weather/internal/config"
 	"weather/internal/mailer"
+	"weather/internal/models"
+	"weather/internal/ratelimit"
 	"weather/internal/store"
+	"weather/internal/telegram"
 	"weather/internal/weather"
 
 	"github.com/gin-gonic/gin"
 )
 
-func Mount(router *gin.Engine, storage store.Storage, weatherService *weather.RemoteService, mailerService *mailer.SmtpMailer) {
+func Mount(router *gin.Engine, cfg config.Config, storage store.Storage, weatherService *weather.RemoteService, mailerService *mailer.SmtpMailer, limiter ratelimit.Store, bot *telegram.Bot) {
 	weatherHandler := handlers.NewWeatherHandler(storage, weatherService)
-	subscriptionHandler := handlers.NewSubscriptionHandler(storage, mailerService)
+	subscriptionHandler := handlers.NewSubscriptionHandler(storage, mailerService, cfg.OptIn, mailerService.Clock)
+	adminHandler := handlers.NewAdminHandler(storage, mailerService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(storage)
+	bounceHandler := handlers.NewBounceHandler(storage, bounce.NewProcessor(storage, mailerService))
+
+	// only routes that check scopes look up keys, the public ones ignore them
+	authenticate := middleware.Authenticate(storage, cfg.AdminToken)
 
 	api := router.Group("/api")
 
 	weather := api.Group("/weather")
+	if cfg.WeatherRequireAuth {
+		weather.Use(authenticate, middleware.RequireScope(models.ScopeWeatherRead))
+	}
+	weather.Use(middleware.RateLimit(limiter, cfg.RateLimit.Weather, middleware.ByAPIKey))
 	weather.Use(middleware.ExtractQuery("city"))
 	weather.GET("/", weatherHandler.CityWeather)
+	weather.GET("/history", weatherHandler.History)
+	weather.GET("/alerts", weatherHandler.Alerts)
 
 	subscription := api.Group("/")
 	subscription.Use(middleware.ExtractParam("token"))
-	subscription.POST("/subscribe", subscriptionHandler.Subscribe)
-	subscription.GET("/confirm/:token", subscriptionHandler.Confirm)
-	subscription.GET("/unsubscribe/:token", subscriptionHandler.Unsubscribe)
+	subscription.POST("/subscribe",
+		middleware.RateLimit(limiter, cfg.RateLimit.Subscribe, middleware.ByIP),
+		middleware.RateLimit(limiter, cfg.RateLimit.SubscribeEmail, middleware.ByJSONField("email")),
+		subscriptionHandler.Subscribe,
+	)
+	// resends are limited like subscribing but on their own buckets, so
+	// resending never eats into the subscribe budget or the other way round
+	subscription.POST("/subscribe/resend",
+		middleware.RateLimit(limiter, cfg.RateLimit.Subscribe.Renamed("subscribe_resend"), middleware.ByIP),
+		middleware.RateLimit(limiter, cfg.RateLimit.SubscribeEmail.Renamed("subscribe_email_resend"), middleware.ByJSONField("email")),
+		subscriptionHandler.Resend,
+	)
+	subscription.GET("/confirm/:token", subscriptionHandler.RequireIssuedToken, subscriptionHandler.Confirm)
+	subscription.GET("/unsubscribe/:token", subscriptionHandler.RequireIssuedToken, subscriptionHandler.Unsubscribe)
+	subscription.POST("/unsubscribe/:token", subscriptionHandler.RequireIssuedToken, subscriptionHandler.OneClickUnsubscribe)
+
+	preferences := api.Group("/subscriptions/:token")
+	preferences.Use(middleware.ExtractParam("token"), subscriptionHandler.RequireIssuedToken)
+	preferences.GET("", subscriptionHandler.GetPreferences)
+	preferences.PATCH("", subscriptionHandler.UpdatePreferences)
+	preferences.POST("/pause", subscriptionHandler.Pause)
+	preferences.POST("/resume", subscriptionHandler.Resume)
+	preferences.GET("/webhook/deliveries", subscriptionHandler.WebhookDeliveries)
+
+	manage := router.Group("/manage/:token")
+	manage.Use(middleware.ExtractParam("token"), subscriptionHandler.RequireIssuedToken)
+	manage.GET("", subscriptionHandler.ManagePage)
+	manage.POST("", subscriptionHandler.ManageSubmit)
+
+	webhooks := router.Group("/webhooks")
+	webhooks.POST("/bounces", middleware.WebhookSecret(cfg.BounceWebhookSecret), bounceHandler.Webhook)
+	if bot != nil {
+		telegramHandler := handlers.NewTelegramHandler(bot)
+		webhooks.POST("/telegram", middleware.SecretHeader("X-Telegram-Bot-Api-Secret-Token", bot.WebhookSecret), telegramHandler.Webhook)
+	}
+
+	admin := router.Group("/admin")
+	admin.Use(authenticate)
+
+	adminSubscriptions := admin.Group("/subscriptions")
+	adminSubscriptions.Use(middleware.RequireScope(models.ScopeSubscriptionsAdmin))
+	adminSubscriptions.GET("", adminHandler.ListSubscriptions)
+	adminSubscriptions.GET("/stats", adminHandler.CityStats)
+
+	adminSubscription := adminSubscriptions.Group("/:id")
+	adminSubscription.Use(middleware.ExtractParam("id"))
+	adminSubscription.GET("", adminHandler.GetSubscription)
+	adminSubscription.DELETE("", adminHandler.DeleteSubscription)
+	adminSubscription.POST("/confirm", adminHandler.ConfirmSubscription)
+	adminSubscription.POST("/status", adminHandler.ChangeStatus)
+	adminSubscription.GET("/history", adminHandler.History)
+	adminSubscription.POST("/resend", middleware.RequireScope(models.ScopeMailSend), adminHandler.ResendConfirmation)
+
+	adminSuppressions := admin.Group("/suppressions")
+	adminSuppressions.Use(middleware.RequireScope(models.ScopeSubscriptionsAdmin))
+	adminSuppressions.GET("", bounceHandler.ListSuppressions)
+	adminSuppressions.POST("", bounceHandler.AddSuppression)
+	adminSuppressions.DELETE("/:email", bounceHandler.RemoveSuppression)
+
+	adminKeys := admin.Group("/api-keys")
+	adminKeys.Use(middleware.RequireScope(models.ScopeKeysAdmin))
+	adminKeys.GET("", apiKeyHandler.List)
+	adminKeys.POST("", apiKeyHandler.Issue)
+	adminKeys.DELETE("/:id", middleware.ExtractParam("id"), apiKeyHandler.Revoke)
 }
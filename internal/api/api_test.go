@@ -0,0 +1,310 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"weather/internal/clock"
+	"weather/internal/config"
+	"weather/internal/mailer"
+	"weather/internal/models"
+	"weather/internal/ratelimit"
+	"weather/internal/secrets"
+	"weather/internal/store"
+	"weather/internal/weather"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter(t *testing.T, cfg config.Config) *gin.Engine {
+	t.Helper()
+	return newTestRouterOn(t, cfg, store.NewMemoryStorage(clock.Real{}))
+}
+
+func newTestRouterOn(t *testing.T, cfg config.Config, storage store.Storage) *gin.Engine {
+	t.Helper()
+	return newTestRouterWith(t, cfg, storage, newTestMailer(t))
+}
+
+func newTestMailer(t *testing.T) *mailer.SmtpMailer {
+	t.Helper()
+
+	weatherService := weather.NewRemoteService(&weather.WeatherApi{ApiKey: secrets.Static("")})
+	mailerService, err := mailer.New(config.SMTPConfig{Host: "127.0.0.1", Port: "25", Security: mailer.SecurityNone}, "http://localhost", weatherService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mailerService
+}
+
+func newTestRouterWith(t *testing.T, cfg config.Config, storage store.Storage, mailerService *mailer.SmtpMailer) *gin.Engine {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	if cfg.AdminToken == nil {
+		cfg.AdminToken = secrets.Static("admin-token")
+	}
+	if cfg.BounceWebhookSecret == nil {
+		cfg.BounceWebhookSecret = secrets.Static("")
+	}
+
+	router := gin.New()
+	Mount(router, cfg, storage, mailerService.WeatherService, mailerService, ratelimit.NewMemoryStore(clock.Real{}), nil)
+	return router
+}
+
+func serve(router *gin.Engine, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func serveJSON(router *gin.Engine, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPublicRoutesIgnoreUnknownKeys(t *testing.T) {
+	router := newTestRouter(t, config.Config{})
+
+	for _, header := range []http.Header{
+		{"X-Api-Key": {"unknown"}},
+		{"Authorization": {"Bearer unknown"}},
+	} {
+		for _, target := range []string{"/api/confirm/nope", "/api/unsubscribe/nope"} {
+			want := serve(router, http.MethodGet, target, nil).Code
+			if rec := serve(router, http.MethodGet, target, header); rec.Code != want {
+				t.Errorf("GET %s with %v: got %d, want %d as without a key", target, header, rec.Code, want)
+			}
+		}
+	}
+}
+
+func TestAdminRoutesAuthenticate(t *testing.T) {
+	router := newTestRouter(t, config.Config{})
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"no key", nil, http.StatusUnauthorized},
+		{"unknown key", http.Header{"X-Api-Key": {"unknown"}}, http.StatusUnauthorized},
+		{"admin token", http.Header{"Authorization": {"Bearer admin-token"}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(router, http.MethodGet, "/admin/subscriptions", tt.header); rec.Code != tt.want {
+				t.Errorf("got %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeatherAuthOnlyWhenRequired(t *testing.T) {
+	open := newTestRouter(t, config.Config{})
+	// the lookup fails further in, without a key check it never gets a 401
+	if rec := serve(open, http.MethodGet, "/api/weather/", http.Header{"X-Api-Key": {"unknown"}}); rec.Code == http.StatusUnauthorized {
+		t.Errorf("open weather with unknown key: got 401")
+	}
+
+	closed := newTestRouter(t, config.Config{WeatherRequireAuth: true})
+	if rec := serve(closed, http.MethodGet, "/api/weather/", http.Header{"X-Api-Key": {"unknown"}}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("closed weather with unknown key: got %d, want 401", rec.Code)
+	}
+}
+
+func TestResendAnswersAlike(t *testing.T) {
+	router := newTestRouter(t, config.Config{OptIn: config.OptInConfig{SendWindow: time.Hour, MaxSendsInWindow: 2}})
+
+	rec := serveJSON(router, http.MethodPost, "/api/subscribe", `{"email":"known@example.com","city":"Kyiv","frequency":"daily"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("subscribe: got %d %s", rec.Code, rec.Body)
+	}
+
+	unknown := serveJSON(router, http.MethodPost, "/api/subscribe/resend", `{"email":"unknown@example.com"}`)
+	known := serveJSON(router, http.MethodPost, "/api/subscribe/resend", `{"email":"known@example.com"}`)
+	if unknown.Code != http.StatusAccepted || known.Code != unknown.Code || known.Body.String() != unknown.Body.String() {
+		t.Errorf("got %d %s for an unknown address and %d %s for a known one, want the same 202",
+			unknown.Code, unknown.Body, known.Code, known.Body)
+	}
+}
+
+func TestResendRetryAfterWindow(t *testing.T) {
+	router := newTestRouter(t, config.Config{OptIn: config.OptInConfig{ResendCooldown: time.Minute, SendWindow: time.Hour, MaxSendsInWindow: 1}})
+
+	rec := serveJSON(router, http.MethodPost, "/api/subscribe", `{"email":"known@example.com","city":"Kyiv","frequency":"daily"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("subscribe: got %d %s", rec.Code, rec.Body)
+	}
+
+	// the one send of the window is used up, waiting out the cooldown is not enough
+	rec = serveJSON(router, http.MethodPost, "/api/subscribe/resend", `{"email":"known@example.com"}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("resend: got %d %s, want 429", rec.Code, rec.Body)
+	}
+	retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	if err != nil || retryAfter <= 3500 || retryAfter > 3600 {
+		t.Errorf("got Retry-After %q, want the hour of the send window", rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestLegacyTokensRefused(t *testing.T) {
+	ctx := context.Background()
+	storage := store.NewMemoryStorage(clock.Real{})
+	router := newTestRouterOn(t, config.Config{}, storage)
+
+	sub := models.Subscription{Email: "legacy@example.com", City: "Kyiv", Frequency: models.Daily, Units: models.Metric}
+	sub.Token = models.LegacyToken(sub.Email)
+	if err := storage.Subscription.Create(ctx, &sub); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, route := range []struct{ method, target string }{
+		{http.MethodGet, "/api/confirm/" + sub.Token},
+		{http.MethodGet, "/api/unsubscribe/" + sub.Token},
+		{http.MethodPost, "/api/unsubscribe/" + sub.Token},
+		{http.MethodGet, "/api/subscriptions/" + sub.Token},
+		{http.MethodGet, "/manage/" + sub.Token},
+	} {
+		if rec := serve(router, route.method, route.target, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s: got %d, want 404", route.method, route.target, rec.Code)
+		}
+	}
+
+	if got, err := storage.Subscription.GetByID(ctx, sub.ID); err != nil || got.Status != models.StatusPending {
+		t.Errorf("got status %q, %v, want the subscription left pending", got.Status, err)
+	}
+}
+
+func TestOneClickUnsubscribeRequiresForm(t *testing.T) {
+	ctx := context.Background()
+	storage := store.NewMemoryStorage(clock.Real{})
+	router := newTestRouterOn(t, config.Config{}, storage)
+
+	sub := models.Subscription{Email: "one-click@example.com", City: "Kyiv", Frequency: models.Daily, Units: models.Metric, Token: "one-click-token"}
+	if err := storage.Subscription.Create(ctx, &sub); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Subscription.ConfirmByID(ctx, sub.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(contentType, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/unsubscribe/"+sub.Token, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, tt := range []struct{ name, contentType, body string }{
+		{"no body", "", ""},
+		{"other field", "application/x-www-form-urlencoded", "unsubscribe=yes"},
+		{"other value", "application/x-www-form-urlencoded", "List-Unsubscribe=Yes"},
+	} {
+		if code := post(tt.contentType, tt.body); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", tt.name, code)
+		}
+	}
+	if got, _ := storage.Subscription.GetByID(ctx, sub.ID); got.Status != models.StatusActive {
+		t.Fatalf("got status %q after refused posts, want active", got.Status)
+	}
+
+	if code := post("application/x-www-form-urlencoded", "List-Unsubscribe=One-Click"); code != http.StatusOK {
+		t.Errorf("one-click: got %d, want 200", code)
+	}
+	if got, _ := storage.Subscription.GetByID(ctx, sub.ID); got.Status != models.StatusUnsubscribed {
+		t.Errorf("got status %q after one-click, want unsubscribed", got.Status)
+	}
+}
+
+// discardChannel accepts digests and drops them.
+type discardChannel struct{}
+
+func (discardChannel) SendDigest(context.Context, mailer.Digest) error { return nil }
+
+func TestWebhookSecretShownOnce(t *testing.T) {
+	ctx := context.Background()
+	storage := store.NewMemoryStorage(clock.Real{})
+	mailerService := newTestMailer(t)
+	mailerService.Channels[models.ChannelWebhook] = discardChannel{}
+	router := newTestRouterWith(t, config.Config{}, storage, mailerService)
+
+	sub := models.Subscription{Email: "hook@example.com", City: "Kyiv", Frequency: models.Daily, Units: models.Metric, Token: "hook-token"}
+	if err := storage.Subscription.Create(ctx, &sub); err != nil {
+		t.Fatal(err)
+	}
+
+	target := "/api/subscriptions/" + sub.Token
+	// an IP literal is checked without resolving it
+	set := `{"webhook_url":"https://93.184.216.34/hook"}`
+	issued := make([]string, 2)
+	for i := range issued {
+		rec := serveJSON(router, http.MethodPatch, target, set)
+		var resp struct {
+			WebhookSecret string `json:"webhook_secret"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); rec.Code != http.StatusOK || err != nil || resp.WebhookSecret == "" {
+			t.Fatalf("set webhook: got %d %s, want the secret", rec.Code, rec.Body)
+		}
+		issued[i] = resp.WebhookSecret
+	}
+	if issued[0] == issued[1] {
+		t.Errorf("got secret %q twice, want a new one each time the URL is set", issued[0])
+	}
+	if stored, err := storage.Subscription.GetByID(ctx, sub.ID); err != nil || stored.WebhookSecret != issued[1] {
+		t.Errorf("got stored secret %q, %v, want the last one returned", stored.WebhookSecret, err)
+	}
+
+	for _, rec := range []*httptest.ResponseRecorder{
+		serve(router, http.MethodGet, target, nil),
+		serveJSON(router, http.MethodPatch, target, `{"city":"Lviv"}`),
+	} {
+		if strings.Contains(rec.Body.String(), "webhook_secret") || strings.Contains(rec.Body.String(), issued[1]) {
+			t.Errorf("got %d %s, want the secret left out", rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestWebhookRefusedWithoutChannel(t *testing.T) {
+	ctx := context.Background()
+	storage := store.NewMemoryStorage(clock.Real{})
+	router := newTestRouterOn(t, config.Config{}, storage)
+
+	sub := models.Subscription{Email: "hook@example.com", City: "Kyiv", Frequency: models.Daily, Units: models.Metric, Token: "hook-token"}
+	if err := storage.Subscription.Create(ctx, &sub); err != nil {
+		t.Fatal(err)
+	}
+
+	target := "/api/subscriptions/" + sub.Token
+	if rec := serveJSON(router, http.MethodPatch, target, `{"webhook_url":"https://93.184.216.34/hook"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("set webhook: got %d %s, want 400", rec.Code, rec.Body)
+	}
+	if stored, _ := storage.Subscription.GetByID(ctx, sub.ID); stored.UsesWebhook() {
+		t.Errorf("got webhook %q stored, want none", stored.WebhookURL)
+	}
+
+	// switching back to email needs no channel
+	if rec := serveJSON(router, http.MethodPatch, target, `{"webhook_url":""}`); rec.Code != http.StatusOK {
+		t.Errorf("clear webhook: got %d %s, want 200", rec.Code, rec.Body)
+	}
+}
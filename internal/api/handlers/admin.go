@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"weather/internal/mailer"
+	"weather/internal/models"
+	"weather/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type listSubscriptionsResponse struct {
+	Items  []models.Subscription `json:"items"`
+	Total  int64                 `json:"total"`
+	Limit  int                   `json:"limit"`
+	Offset int                   `json:"offset"`
+}
+
+type changeStatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+type AdminHandler struct {
+	store         store.Storage
+	mailerService *mailer.SmtpMailer
+}
+
+func NewAdminHandler(store store.Storage, mailerService *mailer.SmtpMailer) *AdminHandler {
+	return &AdminHandler{
+		store:         store,
+		mailerService: mailerService,
+	}
+}
+
+func (h *AdminHandler) ListSubscriptions(c *gin.Context) {
+	filter, err := parseSubscriptionFilter(c)
+	if err != nil {
+		logError(err, "cant parse subscription filter")
+		c.JSON(http.StatusBadRequest, "Invalid query")
+		return
+	}
+
+	subs, total, err := h.store.Subscription.List(c.Request.Context(), filter)
+	if err != nil {
+		logError(err, "cant list subscriptions")
+		c.JSON(http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	c.JSON(http.StatusOK, listSubscriptionsResponse{
+		Items:  subs,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	})
+}
+
+func (h *AdminHandler) GetSubscription(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+
+	sub, err := h.store.Subscription.GetByID(c.Request.Context(), id)
+	if err != nil {
+		h.storeError(c, err, "cant get subscription")
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+func (h *AdminHandler) DeleteSubscription(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+
+	sub, err := h.store.Subscription.Delete(c.Request.Context(), id)
+	if err != nil {
+		h.storeError(c, err, "cant delete subscription")
+		return
+	}
+
+	sub.Status = models.StatusUnsubscribed
+	h.mailerService.SyncTarget(sub)
+
+	c.JSON(http.StatusOK, "Subscription deleted")
+}
+
+func (h *AdminHandler) ConfirmSubscription(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+
+	sub, err := h.store.Subscription.ConfirmByID(c.Request.Context(), id)
+	if err != nil {
+		h.storeError(c, err, "cant confirm subscription")
+		return
+	}
+
+	h.mailerService.SyncTarget(sub)
+
+	c.JSON(http.StatusOK, sub)
+}
+
+func (h *AdminHandler) ChangeStatus(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+
+	var req changeStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logError(err, "cant bind request to json")
+		c.JSON(http.StatusUnprocessableEntity, "Invalid input")
+		return
+	}
+	if !models.ValidStatus(req.Status) {
+		c.JSON(http.StatusBadRequest, "Unknown status")
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "changed by admin"
+	}
+
+	sub, err := h.store.Subscription.Transition(c.Request.Context(), id, req.Status, req.Reason)
+	if err != nil {
+		h.storeError(c, err, "cant change subscription status")
+		return
+	}
+
+	h.mailerService.SyncTarget(sub)
+
+	c.JSON(http.StatusOK, sub)
+}
+
+func (h *AdminHandler) History(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+
+	events, err := h.store.Subscription.History(c.Request.Context(), id)
+	if err != nil {
+		h.storeError(c, err, "cant get subscription history")
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+func (h *AdminHandler) ResendConfirmation(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+
+	sub, err := h.store.Subscription.GetByID(c.Request.Context(), id)
+	if err != nil {
+		h.storeError(c, err, "cant get subscription")
+		return
+	}
+
+	if sub.Status != models.StatusPending {
+		c.JSON(http.StatusConflict, "Subscription is not pending confirmation")
+		return
+	}
+
+	if err := h.mailerService.SendEmail(sub.Email, "Your token", sub.Token); err != nil {
+		logError(err, "cant resend confirmation email")
+		c.JSON(http.StatusBadGateway, "Failed to send email")
+		return
+	}
+
+	c.JSON(http.StatusOK, "Confirmation email sent")
+}
+
+func (h *AdminHandler) CityStats(c *gin.Context) {
+	stats, err := h.store.Subscription.CountByCity(c.Request.Context())
+	if err != nil {
+		logError(err, "cant count subscriptions per city")
+		c.JSON(http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (h *AdminHandler) storeError(c *gin.Context, err error, message string) {
+	logError(err, message)
+	switch {
+	case errors.Is(err, store.ErrorNotFound):
+		c.JSON(http.StatusNotFound, "Subscription not found")
+	case errors.Is(err, store.ErrorInvalidTransition):
+		c.JSON(http.StatusConflict, "Status change not allowed")
+	default:
+		c.JSON(http.StatusInternalServerError, "Internal error")
+	}
+}
+
+func pathID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.GetString("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, "Invalid id")
+		return 0, false
+	}
+	return id, true
+}
+
+func parseSubscriptionFilter(c *gin.Context) (store.SubscriptionFilter, error) {
+	filter := store.SubscriptionFilter{
+		City:      c.Query("city"),
+		Frequency: c.Query("frequency"),
+		Limit:     defaultPageLimit,
+	}
+
+	if filter.Frequency != "" && filter.Frequency != models.Hourly && filter.Frequency != models.Daily {
+		return filter, errors.New("unknown frequency: " + filter.Frequency)
+	}
+
+	var err error
+	if filter.Confirmed, err = optionalBool(c, "confirmed"); err != nil {
+		return filter, err
+	}
+	if filter.Status = c.Query("status"); filter.Status != "" && !models.ValidStatus(filter.Status) {
+		return filter, errors.New("unknown status: " + filter.Status)
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		if filter.Limit, err = strconv.Atoi(raw); err != nil || filter.Limit <= 0 {
+			return filter, errors.New("invalid limit: " + raw)
+		}
+		filter.Limit = min(filter.Limit, maxPageLimit)
+	}
+	if raw := c.Query("offset"); raw != "" {
+		if filter.Offset, err = strconv.Atoi(raw); err != nil || filter.Offset < 0 {
+			return filter, errors.New("invalid offset: " + raw)
+		}
+	}
+
+	return filter, nil
+}
+
+func optionalBool(c *gin.Context, key string) (*bool, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+
+	val, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &val, nil
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"weather/internal/apikey"
+	"weather/internal/models"
+	"weather/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+type issueAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type issueAPIKeyResponse struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+type APIKeyHandler struct {
+	store store.Storage
+}
+
+func NewAPIKeyHandler(store store.Storage) *APIKeyHandler {
+	return &APIKeyHandler{
+		store: store,
+	}
+}
+
+func (h *APIKeyHandler) Issue(c *gin.Context) {
+	var req issueAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logError(err, "cant bind request to json")
+		c.JSON(http.StatusUnprocessableEntity, "Invalid input")
+		return
+	}
+
+	key, plain, err := apikey.Issue(c.Request.Context(), h.store, req.Name, req.Scopes)
+	if err != nil {
+		logError(err, "cant issue api key")
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, issueAPIKeyResponse{APIKey: key, Key: plain})
+}
+
+func (h *APIKeyHandler) List(c *gin.Context) {
+	keys, err := h.store.APIKey.List(c.Request.Context())
+	if err != nil {
+		logError(err, "cant list api keys")
+		c.JSON(http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+
+	key, err := h.store.APIKey.Revoke(c.Request.Context(), id)
+	if err != nil {
+		logError(err, "cant revoke api key")
+		if errors.Is(err, store.ErrorNotFound) {
+			c.JSON(http.StatusNotFound, "API key not found")
+			return
+		}
+		c.JSON(http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"weather/internal/bounce"
+	"weather/internal/models"
+	"weather/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxWebhookBody = 1 << 20
+
+type addSuppressionRequest struct {
+	Email  string `json:"email"`
+	Reason string `json:"reason"`
+}
+
+type BounceHandler struct {
+	store     store.Storage
+	processor *bounce.Processor
+}
+
+func NewBounceHandler(store store.Storage, processor *bounce.Processor) *BounceHandler {
+	return &BounceHandler{
+		store:     store,
+		processor: processor,
+	}
+}
+
+func (h *BounceHandler) Webhook(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		logError(err, "cant read webhook body")
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	events, err := bounce.ParseWebhook(body)
+	if err != nil {
+		logError(err, "cant parse bounce webhook")
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	if err := h.processor.Process(c.Request.Context(), events); err != nil {
+		logError(err, "cant process bounces")
+		// non-2xx makes the provider retry later
+		c.JSON(http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	c.JSON(http.StatusOK, "Processed")
+}
+
+func (h *BounceHandler) ListSuppressions(c *gin.Context) {
+	list, err := h.store.Suppression.List(c.Request.Context())
+	if err != nil {
+		logError(err, "cant list suppressions")
+		c.JSON(http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *BounceHandler) AddSuppression(c *gin.Context) {
+	var req addSuppressionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logError(err, "cant bind request to json")
+		c.JSON(http.StatusUnprocessableEntity, "Invalid input")
+		return
+	}
+	if req.Email == "" {
+		c.JSON(http.StatusUnprocessableEntity, "Invalid input")
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "added by admin"
+	}
+
+	suppression := models.Suppression{Email: req.Email, Reason: req.Reason, Source: "admin"}
+	if err := h.store.Suppression.Add(c.Request.Context(), &suppression); err != nil {
+		logError(err, "cant add suppression")
+		c.JSON(http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	c.JSON(http.StatusCreated, suppression)
+}
+
+// RemoveSuppression lets mail go to the address again, e.g. once a full
+// mailbox was emptied. The subscription itself is left as it is.
+func (h *BounceHandler) RemoveSuppression(c *gin.Context) {
+	err := h.store.Suppression.Remove(c.Request.Context(), c.Param("email"))
+	if err != nil {
+		logError(err, "cant remove suppression")
+		if errors.Is(err, store.ErrorNotFound) {
+			c.JSON(http.StatusNotFound, "Suppression not found")
+		} else {
+			c.JSON(http.StatusInternalServerError, "Internal error")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, "Suppression removed")
+}
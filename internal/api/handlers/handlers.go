@@ -1,6 +1,12 @@
 package handlers
 
-import "log"
+import (
+	"errors"
+	"log"
+)
+
+// errAborted rolls back a Storage.WithTx whose handler already answered.
+var errAborted = errors.New("request aborted")
 
 func logError(err error, message string) {
 	log.Printf("ERROR: %s: %v", message, err)
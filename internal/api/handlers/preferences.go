@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"embed"
+	"errors"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"weather/internal/models"
+	"weather/internal/store"
+	"weather/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+//go:embed templates/manage.html
+var templatesFS embed.FS
+
+var manageTemplate = template.Must(template.ParseFS(templatesFS, "templates/manage.html"))
+
+type preferencesRequest struct {
+	City      *string `json:"city" form:"city"`
+	Frequency *string `json:"frequency" form:"frequency"`
+	Units     *string `json:"units" form:"units"`
+	// AlertSeverities replaces the severities alerted about, empty turns
+	// alerts off. The manage form sends an empty value along with its
+	// checkboxes so unchecking all of them still counts.
+	AlertSeverities *[]string `json:"alert_severities" form:"alert_severities"`
+	// AirQualityThreshold is a US EPA index, zero turns air alerts off.
+	AirQualityThreshold *int `json:"air_quality_threshold" form:"air_quality_threshold"`
+	// WebhookURL sends digests to an https URL instead of by email, empty
+	// switches back. Setting it again enables a disabled webhook and replaces
+	// its signing secret.
+	WebhookURL *string `json:"webhook_url" form:"webhook_url"`
+}
+
+type preferencesResponse struct {
+	Email               string                 `json:"email"`
+	City                string                 `json:"city"`
+	Frequency           string                 `json:"frequency"`
+	Units               string                 `json:"units"`
+	AlertSeverities     models.AlertSeverities `json:"alert_severities"`
+	AirQualityThreshold int                    `json:"air_quality_threshold"`
+	WebhookURL          string                 `json:"webhook_url"`
+	WebhookDisabledAt   *time.Time             `json:"webhook_disabled_at"`
+	Confirmed           bool                   `json:"confirmed"`
+	Status              string                 `json:"status"`
+	PausedUntil         *time.Time             `json:"paused_until"`
+
+	// WebhookSecret is only in the answer to setting the webhook URL.
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+}
+
+type pauseRequest struct {
+	// Until ends the pause at a given time; Days is a shorthand for it.
+	// With neither set the subscription is paused until resumed.
+	Until *time.Time `json:"until"`
+	Days  int        `json:"days"`
+}
+
+type managePage struct {
+	Subscription models.Subscription
+	Notice       string
+	Error        string
+	Severities   []string
+	// AirQualityLevels are the thresholds offered, the US EPA index levels.
+	AirQualityLevels []airQualityLevel
+}
+
+type airQualityLevel struct {
+	Index    int
+	Category string
+}
+
+const maxPause = 365 * 24 * time.Hour
+
+// defaultWebhookDeliveries and maxWebhookDeliveries bound one page of the
+// webhook delivery log.
+const (
+	defaultWebhookDeliveries = 20
+	maxWebhookDeliveries     = 100
+)
+
+var (
+	errInvalidPreferences = errors.New("invalid preferences")
+	errWebhooksDisabled   = errors.New("webhooks are disabled")
+)
+
+func newPreferencesResponse(sub models.Subscription) preferencesResponse {
+	return preferencesResponse{
+		Email:               sub.Email,
+		City:                sub.City,
+		Frequency:           sub.Frequency,
+		Units:               sub.Units,
+		AlertSeverities:     sub.AlertSeverities,
+		AirQualityThreshold: sub.AirQualityThreshold,
+		WebhookURL:          sub.WebhookURL,
+		WebhookDisabledAt:   sub.WebhookDisabledAt,
+		Confirmed:           sub.Confirmed,
+		Status:              sub.Status,
+		PausedUntil:         sub.PausedUntil,
+	}
+}
+
+func (req preferencesRequest) validate() (store.PreferencesUpdate, error) {
+	update := store.PreferencesUpdate{
+		City:                req.City,
+		Frequency:           req.Frequency,
+		Units:               req.Units,
+		AirQualityThreshold: req.AirQualityThreshold,
+		WebhookURL:          req.WebhookURL,
+	}
+
+	if update.City != nil {
+		city := strings.TrimSpace(*update.City)
+		if city == "" {
+			return update, errInvalidPreferences
+		}
+		update.City = &city
+	}
+	if update.Frequency != nil && *update.Frequency != models.Hourly && *update.Frequency != models.Daily {
+		return update, errInvalidPreferences
+	}
+	if update.Units != nil && *update.Units != models.Metric && *update.Units != models.Imperial {
+		return update, errInvalidPreferences
+	}
+	if req.AlertSeverities != nil {
+		for _, severity := range *req.AlertSeverities {
+			if severity != "" && !models.ValidSeverity(severity) {
+				return update, errInvalidPreferences
+			}
+		}
+		// kept in the order of models.Severities whatever order they came in
+		chosen := models.AlertSeverities{}
+		for _, severity := range models.Severities {
+			if slices.Contains(*req.AlertSeverities, severity) {
+				chosen = append(chosen, severity)
+			}
+		}
+		update.AlertSeverities = &chosen
+	}
+	if t := update.AirQualityThreshold; t != nil && (*t < 0 || *t > models.MaxAirQualityIndex) {
+		return update, errInvalidPreferences
+	}
+	if update.WebhookURL != nil {
+		target := strings.TrimSpace(*update.WebhookURL)
+		if target != "" && !webhook.ValidURL(target) {
+			return update, errInvalidPreferences
+		}
+		update.WebhookURL = &target
+	}
+
+	return update, nil
+}
+
+// RequireIssuedToken refuses a token derived from the subscriber's email,
+// which would let anyone who knows the address act on the subscription.
+// The mailer replaces those with a random token in the next digest, whose
+// links carry the new one. Unknown tokens are left to the handlers.
+func (s *SubscriptionHandler) RequireIssuedToken(c *gin.Context) {
+	sub, err := s.store.Subscription.GetByToken(c.Request.Context(), c.GetString("token"))
+	if err == nil && sub.HasLegacyToken() {
+		c.AbortWithStatusJSON(http.StatusNotFound, "Token not found")
+		return
+	}
+
+	c.Next()
+}
+
+func (s *SubscriptionHandler) GetPreferences(c *gin.Context) {
+	token := c.GetString("token")
+
+	sub, err := s.store.Subscription.GetByToken(c.Request.Context(), token)
+	if err != nil {
+		logError(err, "cant get subscription")
+		c.JSON(http.StatusNotFound, "Token not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, newPreferencesResponse(sub))
+}
+
+func (s *SubscriptionHandler) UpdatePreferences(c *gin.Context) {
+	var req preferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logError(err, "cant bind request to json")
+		c.JSON(http.StatusUnprocessableEntity, "Invalid input")
+		return
+	}
+
+	sub, err := s.applyPreferences(c, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidPreferences):
+			c.JSON(http.StatusBadRequest, "Invalid input")
+		case errors.Is(err, errWebhooksDisabled):
+			c.JSON(http.StatusBadRequest, "Webhooks are not available")
+		case errors.Is(err, store.ErrorNotFound):
+			c.JSON(http.StatusNotFound, "Token not found")
+		default:
+			c.JSON(http.StatusInternalServerError, "Internal error")
+		}
+		return
+	}
+
+	resp := newPreferencesResponse(sub)
+	if req.WebhookURL != nil && sub.UsesWebhook() {
+		resp.WebhookSecret = sub.WebhookSecret
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// WebhookDeliveries lists the latest webhook delivery attempts, newest first.
+func (s *SubscriptionHandler) WebhookDeliveries(c *gin.Context) {
+	limit := defaultWebhookDeliveries
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxWebhookDeliveries {
+			c.JSON(http.StatusBadRequest, "Invalid query")
+			return
+		}
+		limit = n
+	}
+
+	sub, err := s.store.Subscription.GetByToken(c.Request.Context(), c.GetString("token"))
+	if err != nil {
+		logError(err, "cant get subscription")
+		c.JSON(http.StatusNotFound, "Token not found")
+		return
+	}
+
+	deliveries, err := s.store.Webhook.ListDeliveries(c.Request.Context(), sub.ID, limit)
+	if err != nil {
+		logError(err, "cant list webhook deliveries")
+		c.JSON(http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+func (s *SubscriptionHandler) Pause(c *gin.Context) {
+	var req pauseRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			logError(err, "cant bind request to json")
+			c.JSON(http.StatusUnprocessableEntity, "Invalid input")
+			return
+		}
+	}
+
+	now := s.clock.Now()
+	until := req.Until
+	if until == nil && req.Days > 0 {
+		t := now.AddDate(0, 0, req.Days)
+		until = &t
+	}
+	if until != nil && (!until.After(now) || until.After(now.Add(maxPause))) {
+		c.JSON(http.StatusBadRequest, "Pause end must be in the future and within a year")
+		return
+	}
+
+	sub, err := s.store.Subscription.Pause(c.Request.Context(), c.GetString("token"), until)
+	if err != nil {
+		s.transitionError(c, err, "cant pause subscription")
+		return
+	}
+
+	s.mailerService.SyncTarget(sub)
+
+	c.JSON(http.StatusOK, newPreferencesResponse(sub))
+}
+
+func (s *SubscriptionHandler) Resume(c *gin.Context) {
+	sub, err := s.store.Subscription.Resume(c.Request.Context(), c.GetString("token"))
+	if err != nil {
+		s.transitionError(c, err, "cant resume subscription")
+		return
+	}
+
+	s.mailerService.SyncTarget(sub)
+
+	c.JSON(http.StatusOK, newPreferencesResponse(sub))
+}
+
+func (s *SubscriptionHandler) transitionError(c *gin.Context, err error, message string) {
+	logError(err, message)
+	switch {
+	case errors.Is(err, store.ErrorNotFound):
+		c.JSON(http.StatusNotFound, "Token not found")
+	case errors.Is(err, store.ErrorInvalidTransition):
+		c.JSON(http.StatusConflict, "Not possible in the current subscription state")
+	default:
+		c.JSON(http.StatusInternalServerError, "Internal error")
+	}
+}
+
+func (s *SubscriptionHandler) ManagePage(c *gin.Context) {
+	token := c.GetString("token")
+
+	sub, err := s.store.Subscription.GetByToken(c.Request.Context(), token)
+	if err != nil {
+		logError(err, "cant get subscription")
+		c.String(http.StatusNotFound, "Subscription not found")
+		return
+	}
+
+	renderManagePage(c, http.StatusOK, managePage{Subscription: sub})
+}
+
+func (s *SubscriptionHandler) ManageSubmit(c *gin.Context) {
+	var req preferencesRequest
+	if err := c.ShouldBind(&req); err != nil {
+		logError(err, "cant bind form")
+		c.String(http.StatusUnprocessableEntity, "Invalid input")
+		return
+	}
+
+	sub, err := s.applyPreferences(c, req)
+	if err != nil {
+		current, getErr := s.store.Subscription.GetByToken(c.Request.Context(), c.GetString("token"))
+		if getErr != nil {
+			c.String(http.StatusNotFound, "Subscription not found")
+			return
+		}
+		renderManagePage(c, http.StatusBadRequest, managePage{Subscription: current, Error: "Please check the values and try again."})
+		return
+	}
+
+	notice := "Your preferences were saved."
+	if req.WebhookURL != nil && sub.UsesWebhook() {
+		notice += " Your webhook signing secret, shown only this once: " + sub.WebhookSecret
+	}
+	renderManagePage(c, http.StatusOK, managePage{Subscription: sub, Notice: notice})
+}
+
+// applyPreferences updates the stored row and then moves the subscriber to the
+// matching schedule of this replica's mailer. The two are separate steps and
+// the schedule is only a cache of the store: the mailer reloads its targets
+// before each window, which also catches other replicas up.
+func (s *SubscriptionHandler) applyPreferences(c *gin.Context, req preferencesRequest) (models.Subscription, error) {
+	update, err := req.validate()
+	if err != nil {
+		return models.Subscription{}, err
+	}
+	if update.WebhookURL != nil && *update.WebhookURL != "" {
+		if !s.mailerService.HasChannel(models.ChannelWebhook) {
+			return models.Subscription{}, errWebhooksDisabled
+		}
+		if update.WebhookSecret, err = webhook.NewSecret(); err != nil {
+			logError(err, "cant generate webhook secret")
+			return models.Subscription{}, err
+		}
+	}
+
+	sub, err := s.store.Subscription.UpdatePreferences(c.Request.Context(), c.GetString("token"), update)
+	if err != nil {
+		logError(err, "cant update subscription preferences")
+		return models.Subscription{}, err
+	}
+
+	s.mailerService.SyncTarget(sub)
+
+	return sub, nil
+}
+
+func renderManagePage(c *gin.Context, status int, page managePage) {
+	page.Severities = models.Severities
+	for index := 1; index <= models.MaxAirQualityIndex; index++ {
+		page.AirQualityLevels = append(page.AirQualityLevels, airQualityLevel{Index: index, Category: models.AirQualityCategory(index)})
+	}
+	c.Render(status, render.HTML{Template: manageTemplate, Data: page})
+}
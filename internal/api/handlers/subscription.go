@@ -1,12 +1,15 @@
 package handlers
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"weather/internal/clock"
+	"weather/internal/config"
 	"weather/internal/mailer"
 	"weather/internal/models"
+	"weather/internal/outbox"
 	"weather/internal/store"
 
 	"github.com/gin-gonic/gin"
@@ -16,22 +19,26 @@ type subscribeRequest struct {
 	Email     string `json:"email"`
 	City      string `json:"city"`
 	Frequency string `json:"frequency"`
+	Units     string `json:"units"`
 }
 
-func SHA256Token(input string) string {
-	sum := sha256.Sum256([]byte(input))
-	return hex.EncodeToString(sum[:])
+type resendRequest struct {
+	Email string `json:"email"`
 }
 
 type SubscriptionHandler struct {
 	store         store.Storage
 	mailerService *mailer.SmtpMailer
+	optIn         config.OptInConfig
+	clock         clock.Clock
 }
 
-func NewSubscriptionHandler(store store.Storage, mailerService *mailer.SmtpMailer) *SubscriptionHandler {
+func NewSubscriptionHandler(store store.Storage, mailerService *mailer.SmtpMailer, optIn config.OptInConfig, clk clock.Clock) *SubscriptionHandler {
 	return &SubscriptionHandler{
 		store:         store,
 		mailerService: mailerService,
+		optIn:         optIn,
+		clock:         clk,
 	}
 }
 
@@ -43,33 +50,212 @@ func (s *SubscriptionHandler) Subscribe(c *gin.Context) {
 		return
 	}
 
+	if req.Units == "" {
+		req.Units = models.Metric
+	}
+	if req.Units != models.Metric && req.Units != models.Imperial {
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	token, err := models.NewToken()
+	if err != nil {
+		logError(err, "cant generate subscription token")
+		c.JSON(http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	// a resubscribe gets a fresh token as well, replacing the one in any
+	// confirmation sent before
 	subscription := models.Subscription{
 		Email:     req.Email,
 		City:      req.City,
 		Frequency: req.Frequency,
-		Token:     SHA256Token(req.Email),
+		Units:     req.Units,
+		Token:     token,
 	}
 
-	err := s.store.Subscription.Create(c.Request.Context(), &subscription)
-	if err != nil {
-		logError(err, "cant create subscription")
-		if errors.Is(err, store.ErrorAlreadyExists) {
-			c.JSON(http.StatusBadRequest, "Email already subscribed")
-
-		} else {
+	// the row, the confirmation budget and the queued email commit together,
+	// so a failure never leaves a subscription nobody got a token for
+	err = s.store.WithTx(c.Request.Context(), func(tx store.Storage) error {
+		err := tx.Subscription.Create(c.Request.Context(), &subscription)
+		switch {
+		case errors.Is(err, store.ErrorAlreadyExists):
+			if !s.resubscribe(c, tx, &subscription) {
+				return errAborted
+			}
+		case err != nil:
+			logError(err, "cant create subscription")
 			c.JSON(http.StatusBadRequest, "Invalid input")
+			return errAborted
+		default:
+			if !s.reserveConfirmation(c, tx, subscription) {
+				return errAborted
+			}
+		}
+
+		if !s.queueConfirmation(c, tx, subscription) {
+			return errAborted
 		}
+		return nil
+	})
+	if err != nil {
+		s.txError(c, err, "cant commit subscription")
 		return
 	}
 
-	err = s.mailerService.SendEmail(subscription.Email, "Your token", subscription.Token)
+	c.JSON(http.StatusOK, "Subscription successful. Confirmation email sent.")
+}
+
+// resubscribe handles a subscribe for a known email. A pending subscription
+// can be changed, e.g. to fix a mistyped city, once the resend cooldown of the
+// previous confirmation passed. An unsubscribed or bounced one goes back to
+// pending and through double opt-in again.
+func (s *SubscriptionHandler) resubscribe(c *gin.Context, tx store.Storage, subscription *models.Subscription) bool {
+	existing, err := tx.Subscription.GetByEmail(c.Request.Context(), subscription.Email)
 	if err != nil {
+		logError(err, "cant get existing subscription")
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return false
+	}
+
+	switch existing.Status {
+	case models.StatusPending:
+	case models.StatusUnsubscribed, models.StatusBounced:
+		existing, err = tx.Subscription.Transition(c.Request.Context(), existing.ID, models.StatusPending, "resubscribed")
+		if err != nil {
+			logError(err, "cant reactivate subscription")
+			c.JSON(http.StatusBadRequest, "Invalid input")
+			return false
+		}
+	default:
+		c.JSON(http.StatusBadRequest, "Email already subscribed")
+		return false
+	}
+
+	if !s.reserveConfirmation(c, tx, existing) {
+		return false
+	}
+
+	if err := tx.Subscription.UpdatePending(c.Request.Context(), subscription); err != nil {
+		logError(err, "cant update pending subscription")
+		c.JSON(http.StatusBadRequest, "Email already subscribed")
+		return false
+	}
+
+	return true
+}
+
+// resendAnswer is the reply to every resend that passed the limits, whether
+// the address has a pending subscription or not, so it reveals neither.
+const resendAnswer = "If the address has a pending subscription, a confirmation email is on its way."
+
+func (s *SubscriptionHandler) Resend(c *gin.Context) {
+	var req resendRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		logError(err, "cant bind request to json")
 		c.JSON(http.StatusUnprocessableEntity, "Invalid input")
 		return
 	}
+	if req.Email == "" {
+		c.JSON(http.StatusUnprocessableEntity, "Invalid input")
+		return
+	}
 
-	c.JSON(http.StatusOK, "Subscription successful. Confirmation email sent.")
+	err := s.store.WithTx(c.Request.Context(), func(tx store.Storage) error {
+		sub, err := tx.Subscription.GetByEmail(c.Request.Context(), req.Email)
+		if errors.Is(err, store.ErrorNotFound) {
+			return nil
+		}
+		if err != nil {
+			logError(err, "cant get subscription")
+			c.JSON(http.StatusBadRequest, "Invalid input")
+			return errAborted
+		}
+
+		if sub.Status != models.StatusPending {
+			return nil
+		}
+
+		if !s.reserveConfirmation(c, tx, sub) || !s.queueConfirmation(c, tx, sub) {
+			return errAborted
+		}
+		return nil
+	})
+	if err != nil {
+		s.txError(c, err, "cant commit confirmation resend")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, resendAnswer)
+}
+
+// reserveConfirmation counts one confirmation email against the address
+// cooldown and send budget, answering 429 when they are used up.
+func (s *SubscriptionHandler) reserveConfirmation(c *gin.Context, tx store.Storage, sub models.Subscription) bool {
+	limits := store.ConfirmationLimits{
+		Cooldown: s.optIn.ResendCooldown,
+		Window:   s.optIn.SendWindow,
+		MaxSends: s.optIn.MaxSendsInWindow,
+	}
+
+	err := tx.Subscription.ReserveConfirmation(c.Request.Context(), sub.ID, limits)
+	if err != nil {
+		logError(err, "cant reserve confirmation email")
+		if errors.Is(err, store.ErrorLimitExceeded) {
+			c.Header("Retry-After", strconv.Itoa(s.confirmationWait(c, tx, sub, limits)))
+			c.JSON(http.StatusTooManyRequests, "Confirmation email was sent recently, try again later")
+		} else {
+			c.JSON(http.StatusBadRequest, "Invalid input")
+		}
+		return false
+	}
+
+	return true
+}
+
+// confirmationWait returns the seconds until the limits allow the next
+// confirmation email, the cooldown or the reset of a used up send window.
+func (s *SubscriptionHandler) confirmationWait(c *gin.Context, tx store.Storage, sub models.Subscription, limits store.ConfirmationLimits) int {
+	wait, err := tx.Subscription.ConfirmationWait(c.Request.Context(), sub.ID, limits)
+	if err != nil {
+		logError(err, "cant get confirmation wait")
+		wait = limits.Cooldown
+	}
+	return int(math.Ceil(wait.Seconds()))
+}
+
+// queueConfirmation puts the token email in the outbox of tx, the relay sends
+// it once the transaction committed.
+func (s *SubscriptionHandler) queueConfirmation(c *gin.Context, tx store.Storage, sub models.Subscription) bool {
+	suppressed, err := tx.Suppression.IsSuppressed(c.Request.Context(), sub.Email)
+	if err != nil {
+		logError(err, "cant check suppression")
+		c.JSON(http.StatusInternalServerError, "Internal error")
+		return false
+	}
+	if suppressed {
+		c.JSON(http.StatusUnprocessableEntity, "Email address does not accept mail")
+		return false
+	}
+
+	msg := mailer.Message{To: sub.Email, Subject: "Your token", Body: sub.Token}
+	if err := outbox.Add(c.Request.Context(), tx.Outbox, mailer.OutboxTopic, msg); err != nil {
+		logError(err, "cant queue confirmation email")
+		c.JSON(http.StatusInternalServerError, "Internal error")
+		return false
+	}
+
+	return true
+}
+
+// txError answers for a transaction that failed after its handler wrote nothing.
+func (s *SubscriptionHandler) txError(c *gin.Context, err error, message string) {
+	if errors.Is(err, errAborted) {
+		return
+	}
+	logError(err, message)
+	c.JSON(http.StatusInternalServerError, "Internal error")
 }
 
 func (s *SubscriptionHandler) Confirm(c *gin.Context) {
@@ -82,16 +268,15 @@ func (s *SubscriptionHandler) Confirm(c *gin.Context) {
 	sub, err := s.store.Subscription.Confirm(c.Request.Context(), token)
 	if err != nil {
 		logError(err, "cant confirm subscription")
+		if errors.Is(err, store.ErrorInvalidTransition) {
+			c.JSON(http.StatusConflict, "Subscription cant be confirmed in its current state")
+			return
+		}
 		c.JSON(http.StatusBadRequest, "Invalid token")
 		return
 	}
 
-	switch sub.Frequency {
-	case models.Hourly:
-		s.mailerService.AddHourlyTarget(sub)
-	case models.Daily:
-		s.mailerService.AddDailyTarget(sub)
-	}
+	s.mailerService.SyncTarget(sub)
 
 	c.JSON(http.StatusOK, "Subscription confirmed successfully")
 }
@@ -110,12 +295,19 @@ func (s *SubscriptionHandler) Unsubscribe(c *gin.Context) {
 		return
 	}
 
-	switch sub.Frequency {
-	case models.Hourly:
-		s.mailerService.RemoveHourlyTarget(sub.Email)
-	case models.Daily:
-		s.mailerService.RemoveDailyTarget(sub.Email)
-	}
+	s.mailerService.SyncTarget(sub)
 
 	c.JSON(http.StatusOK, "Unsubscribed successfully")
 }
+
+// OneClickUnsubscribe handles RFC 8058 POSTs sent by mail clients for the
+// List-Unsubscribe header. The body must be "List-Unsubscribe=One-Click",
+// other POSTs are refused.
+func (s *SubscriptionHandler) OneClickUnsubscribe(c *gin.Context) {
+	if value, ok := c.GetPostForm("List-Unsubscribe"); !ok || value != "One-Click" {
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	s.Unsubscribe(c)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"weather/internal/telegram"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TelegramHandler struct {
+	bot *telegram.Bot
+}
+
+func NewTelegramHandler(bot *telegram.Bot) *TelegramHandler {
+	return &TelegramHandler{bot: bot}
+}
+
+// Webhook handles an update Telegram posts while the bot runs with a webhook.
+// Failed commands are answered in the chat, so every update is acknowledged,
+// a non-2xx would make Telegram redeliver it.
+func (h *TelegramHandler) Webhook(c *gin.Context) {
+	var update telegram.Update
+	if err := c.ShouldBindJSON(&update); err != nil {
+		logError(err, "cant bind telegram update to json")
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	h.bot.HandleUpdate(c.Request.Context(), update)
+
+	c.JSON(http.StatusOK, "Processed")
+}
@@ -1,13 +1,44 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
+	"weather/internal/models"
 	"weather/internal/store"
 	"weather/internal/weather"
 
 	"github.com/gin-gonic/gin"
 )
 
+// maxHistoryBuckets caps one history request, a month of hours.
+const maxHistoryBuckets = 31 * 24
+
+var historyBuckets = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+}
+
+// defaultAlerts and maxAlerts bound the alert history of one request.
+const (
+	defaultAlerts = 20
+	maxAlerts     = 100
+)
+
+type alertsResponse struct {
+	City   string         `json:"city"`
+	Alerts []models.Alert `json:"alerts"`
+}
+
+type historyResponse struct {
+	City    string                     `json:"city"`
+	Bucket  string                     `json:"bucket"`
+	From    time.Time                  `json:"from"`
+	To      time.Time                  `json:"to"`
+	Buckets []models.ObservationBucket `json:"buckets"`
+}
+
 type WeatherHandler struct {
 	store          store.Storage
 	weatherService *weather.RemoteService
@@ -36,3 +67,106 @@ func (h *WeatherHandler) CityWeather(c *gin.Context) {
 
 	c.JSON(http.StatusOK, weather)
 }
+
+// History aggregates the recorded observations of a city per hour or day,
+// the last day of hours or the last month of days by default.
+func (h *WeatherHandler) History(c *gin.Context) {
+	city := c.GetString("city")
+	if city == "" {
+		c.JSON(http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	res, err := parseHistoryQuery(c)
+	if err != nil {
+		logError(err, "cant parse history query")
+		c.JSON(http.StatusBadRequest, "Invalid query")
+		return
+	}
+	res.City = city
+
+	res.Buckets, err = h.store.Observation.Aggregate(c.Request.Context(), city, res.From, res.To, historyBuckets[res.Bucket])
+	if err != nil {
+		logError(err, "cant aggregate observations")
+		c.JSON(http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// Alerts lists the weather alerts recorded for a city, newest first.
+func (h *WeatherHandler) Alerts(c *gin.Context) {
+	city := c.GetString("city")
+	if city == "" {
+		c.JSON(http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	limit := defaultAlerts
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxAlerts {
+			c.JSON(http.StatusBadRequest, "Invalid query")
+			return
+		}
+		limit = n
+	}
+
+	alerts, err := h.store.Alert.List(c.Request.Context(), city, limit)
+	if err != nil {
+		logError(err, "cant list alerts")
+		c.JSON(http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	c.JSON(http.StatusOK, alertsResponse{City: city, Alerts: alerts})
+}
+
+func parseHistoryQuery(c *gin.Context) (historyResponse, error) {
+	res := historyResponse{Bucket: c.DefaultQuery("bucket", "hour")}
+
+	bucket, ok := historyBuckets[res.Bucket]
+	if !ok {
+		return res, errors.New("unknown bucket: " + res.Bucket)
+	}
+
+	var err error
+	res.To = time.Now().UTC()
+	if raw := c.Query("to"); raw != "" {
+		if res.To, err = parseHistoryTime(raw); err != nil {
+			return res, err
+		}
+	}
+	res.From = res.To.Add(-24 * time.Hour)
+	if bucket > time.Hour {
+		res.From = res.To.AddDate(0, 0, -30)
+	}
+	if raw := c.Query("from"); raw != "" {
+		if res.From, err = parseHistoryTime(raw); err != nil {
+			return res, err
+		}
+	}
+
+	if !res.From.Before(res.To) {
+		return res, errors.New("from must be before to")
+	}
+	if res.To.Sub(res.From) > maxHistoryBuckets*bucket {
+		return res, errors.New("too many buckets requested")
+	}
+
+	return res, nil
+}
+
+// parseHistoryTime accepts RFC 3339 times and dates, which start at UTC midnight.
+func parseHistoryTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, errors.New("invalid time: " + raw)
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"weather/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxKeyedBody caps the body ByJSONField reads, it is buffered before any
+// limit applies.
+const maxKeyedBody = 8 << 10
+
+// KeyFunc picks the bucket a request is counted against. An empty key skips
+// the limit, a KeyFunc may also abort the request.
+type KeyFunc func(c *gin.Context) string
+
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByAPIKey counts authenticated callers per key and everyone else per IP.
+func ByAPIKey(c *gin.Context) string {
+	if key, ok := APIKeyFrom(c); ok && key.ID != 0 {
+		return "key:" + strconv.FormatInt(key.ID, 10)
+	}
+	return ByIP(c)
+}
+
+// ByJSONField counts requests per value of a top-level JSON body field,
+// e.g. the target email. The body is restored for the handler. Bodies over
+// maxKeyedBody are refused with 413.
+func ByJSONField(field string) KeyFunc {
+	return func(c *gin.Context) string {
+		if c.Request.Body == nil {
+			return ""
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxKeyedBody))
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, "Request body too large")
+			return ""
+		}
+		if err != nil {
+			return ""
+		}
+
+		var payload map[string]any
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return ""
+		}
+		value, _ := payload[field].(string)
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			return ""
+		}
+
+		return field + ":" + value
+	}
+}
+
+// RateLimit enforces a token bucket policy and reports it through the
+// RateLimit-* headers. With several limits on a route the tightest one is reported.
+func RateLimit(store ratelimit.Store, policy ratelimit.Policy, keyFunc KeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !policy.Enabled() {
+			c.Next()
+			return
+		}
+
+		key := keyFunc(c)
+		if c.IsAborted() {
+			return
+		}
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		res, err := store.Take(c.Request.Context(), policy.Name+":"+key, policy)
+		if err != nil {
+			// fail open, a broken limiter store shouldnt take the api down
+			log.Printf("ERROR: rate limit %s: %v", policy.Name, err)
+			c.Next()
+			return
+		}
+
+		setRateLimitHeaders(c, res)
+
+		if !res.Allowed {
+			c.Header("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func setRateLimitHeaders(c *gin.Context, res ratelimit.Result) {
+	if current := c.Writer.Header().Get("RateLimit-Remaining"); current != "" && res.Allowed {
+		if remaining, err := strconv.Atoi(current); err == nil && remaining <= res.Remaining {
+			return
+		}
+	}
+
+	c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
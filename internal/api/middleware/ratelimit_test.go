@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"weather/internal/clock"
+	"weather/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newRateLimitRouter(policy ratelimit.Policy) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.POST("/", RateLimit(ratelimit.NewMemoryStore(clock.Real{}), policy, ByJSONField("email")), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+	return router
+}
+
+func post(router *gin.Engine, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	return rec
+}
+
+func TestByJSONFieldRestoresBody(t *testing.T) {
+	router := newRateLimitRouter(ratelimit.Policy{Name: "test", Limit: 1, Period: time.Hour})
+
+	body := `{"email":"User@Example.com"}`
+	if rec := post(router, body); rec.Code != http.StatusOK || rec.Body.String() != body {
+		t.Fatalf("got %d %q, want 200 with the body passed on", rec.Code, rec.Body)
+	}
+	// the key is normalized, the same address in another case shares the bucket
+	if rec := post(router, `{"email":" user@example.com"}`); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("got %d for the same address, want 429", rec.Code)
+	}
+	if rec := post(router, `{"email":"other@example.com"}`); rec.Code != http.StatusOK {
+		t.Errorf("got %d for another address, want 200", rec.Code)
+	}
+}
+
+func TestByJSONFieldRefusesLargeBodies(t *testing.T) {
+	router := newRateLimitRouter(ratelimit.Policy{Name: "test", Limit: 1, Period: time.Hour})
+
+	body := `{"email":"user@example.com","pad":"` + strings.Repeat("x", maxKeyedBody) + `"}`
+	if rec := post(router, body); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got %d, want 413", rec.Code)
+	}
+}
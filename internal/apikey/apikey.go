@@ -0,0 +1,75 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"weather/internal/models"
+	"weather/internal/store"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	keyPrefix   = "wk_"
+	secretBytes = 24
+	prefixLen   = len(keyPrefix) + 8
+)
+
+// Generate returns a new plaintext key together with its display prefix.
+func Generate() (string, string, error) {
+	buf := make([]byte, secretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", errors.Wrap(err, "cant generate api key")
+	}
+
+	plain := keyPrefix + hex.EncodeToString(buf)
+	return plain, plain[:prefixLen], nil
+}
+
+// Hash is what gets stored; the plaintext key is only shown once on issue.
+func Hash(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(models.Scopes, scope) {
+			return errors.New(fmt.Sprintf("unknown scope: %s", scope))
+		}
+	}
+	return nil
+}
+
+// Issue creates and stores a new key and returns it along with the plaintext value.
+func Issue(ctx context.Context, storage store.Storage, name string, scopes []string) (models.APIKey, string, error) {
+	if name == "" {
+		return models.APIKey{}, "", errors.New("name is required")
+	}
+	if err := ValidateScopes(scopes); err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	plain, prefix, err := Generate()
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	key := models.APIKey{
+		Name:   name,
+		Prefix: prefix,
+		Scopes: scopes,
+	}
+	if err := storage.APIKey.Create(ctx, &key, Hash(plain)); err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	return key, plain, nil
+}
@@ -0,0 +1,93 @@
+package apikey
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"weather/internal/store"
+
+	"github.com/pkg/errors"
+)
+
+const usage = `usage:
+  apikey issue -name <name> -scopes <scope,scope>
+  apikey revoke -id <id>
+  apikey list`
+
+// RunCLI handles the "apikey" subcommand of the service binary.
+func RunCLI(ctx context.Context, storage store.Storage, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "issue":
+		fs := flag.NewFlagSet("issue", flag.ContinueOnError)
+		name := fs.String("name", "", "human readable key name")
+		scopes := fs.String("scopes", "", "comma separated scopes")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		key, plain, err := Issue(ctx, storage, *name, splitScopes(*scopes))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "id: %d\nname: %s\nscopes: %s\nkey: %s\n", key.ID, key.Name, strings.Join(key.Scopes, ","), plain)
+		fmt.Fprintln(out, "store the key now, it cant be shown again")
+
+	case "revoke":
+		fs := flag.NewFlagSet("revoke", flag.ContinueOnError)
+		id := fs.Int64("id", 0, "key id")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		key, err := storage.APIKey.Revoke(ctx, *id)
+		if err != nil {
+			return errors.Wrapf(err, "cant revoke key %d", *id)
+		}
+		fmt.Fprintf(out, "revoked key %d (%s)\n", key.ID, key.Name)
+
+	case "list":
+		keys, err := storage.APIKey.List(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tUSES\tLAST USED\tREVOKED")
+		for _, key := range keys {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%s\n",
+				key.ID, key.Name, key.Prefix, strings.Join(key.Scopes, ","),
+				key.UsageCount, formatTime(key.LastUsedAt), formatTime(key.RevokedAt))
+		}
+		return w.Flush()
+
+	default:
+		return errors.New(usage)
+	}
+
+	return nil
+}
+
+func splitScopes(raw string) []string {
+	var scopes []string
+	for _, scope := range strings.Split(raw, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
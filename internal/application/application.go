@@ -10,8 +10,12 @@ import (
 	"time"
 	"weather/internal/api"
 	"weather/internal/config"
+	"weather/internal/janitor"
 	"weather/internal/mailer"
+	"weather/internal/ratelimit"
+	"weather/internal/secrets"
 	"weather/internal/store"
+	"weather/internal/telegram"
 	"weather/internal/weather"
 
 	"github.com/gin-gonic/gin"
@@ -23,7 +27,14 @@ type Application struct {
 	Router         *gin.Engine
 	server         *http.Server
 	WeatherService *weather.RemoteService
+	Recorder       *weather.Recorder
+	Poller         *weather.Poller
 	MailerService  *mailer.SmtpMailer
+	SecretsWatcher *secrets.Watcher
+	RateLimitStore ratelimit.Store
+	Janitor        *janitor.Janitor
+	// Telegram is optional, nil when no bot token is configured.
+	Telegram *telegram.Bot
 }
 
 func (a *Application) Initialize() {
@@ -35,14 +46,21 @@ func (a *Application) Initialize() {
 		IdleTimeout:  a.Config.IdleTimeout,
 	}
 
-	api.Mount(a.Router, a.Store, a.WeatherService, a.MailerService)
+	api.Mount(a.Router, a.Config, a.Store, a.WeatherService, a.MailerService, a.RateLimitStore, a.Telegram)
 }
 
 // very graceful very mindful
 func (a *Application) Run() {
 	a.Initialize()
 
+	a.SecretsWatcher.Start()
+	a.Recorder.Start()
+	a.Poller.Start()
 	a.MailerService.Start()
+	a.Janitor.Start()
+	if a.Telegram != nil {
+		a.Telegram.Start()
+	}
 
 	go func() {
 		log.Printf("Starting server on %s", a.Config.Addr)
@@ -56,7 +74,14 @@ func (a *Application) Run() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	if a.Telegram != nil {
+		a.Telegram.Stop()
+	}
+	a.Janitor.Stop()
 	a.MailerService.Stop()
+	a.Poller.Stop()
+	a.Recorder.Stop()
+	a.SecretsWatcher.Stop()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
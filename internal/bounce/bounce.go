@@ -0,0 +1,106 @@
+package bounce
+
+import (
+	"context"
+	"errors"
+	"log"
+	"weather/internal/models"
+	"weather/internal/store"
+)
+
+// Event is one bounce or complaint for a single recipient.
+type Event struct {
+	Email  string
+	Kind   string
+	Reason string
+	Source string
+}
+
+// Suppresses reports whether the event means we must stop mailing the address.
+func (e Event) Suppresses() bool {
+	return e.Kind == models.BounceHard || e.Kind == models.Complaint
+}
+
+type TargetSyncer interface {
+	SyncTarget(sub models.Subscription)
+}
+
+// Processor suppresses addresses that hard bounced or complained and takes
+// their subscriptions off the schedule. Soft bounces are only logged.
+type Processor struct {
+	store   store.Storage
+	targets TargetSyncer
+}
+
+func NewProcessor(store store.Storage, targets TargetSyncer) *Processor {
+	return &Processor{
+		store:   store,
+		targets: targets,
+	}
+}
+
+func (p *Processor) Process(ctx context.Context, events []Event) error {
+	for _, e := range events {
+		if !e.Suppresses() {
+			log.Printf("%s for %s from %s: %s", e.Kind, e.Email, e.Source, e.Reason)
+			continue
+		}
+
+		if err := p.suppress(ctx, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Processor) suppress(ctx context.Context, e Event) error {
+	reason := e.Kind
+	if e.Reason != "" {
+		reason += ": " + e.Reason
+	}
+
+	to := models.StatusBounced
+	if e.Kind == models.Complaint {
+		to = models.StatusUnsubscribed
+	}
+
+	// the suppression and the status change commit together, the schedule
+	// is only touched once they did
+	var (
+		sub     models.Subscription
+		changed bool
+	)
+	err := p.store.WithTx(ctx, func(tx store.Storage) error {
+		suppression := models.Suppression{Email: e.Email, Reason: reason, Source: e.Source}
+		if err := tx.Suppression.Add(ctx, &suppression); err != nil {
+			return err
+		}
+
+		current, err := tx.Subscription.GetByEmail(ctx, e.Email)
+		if errors.Is(err, store.ErrorNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		sub, err = tx.Subscription.Transition(ctx, current.ID, to, reason)
+		if errors.Is(err, store.ErrorInvalidTransition) {
+			// e.g. already unsubscribed, the suppression alone is enough
+			return nil
+		}
+		changed = err == nil
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		p.targets.SyncTarget(sub)
+		log.Printf("suppressed %s after %s", e.Email, e.Kind)
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package bounce
+
+import (
+	"context"
+	"testing"
+
+	"weather/internal/clock"
+	"weather/internal/models"
+	"weather/internal/store"
+)
+
+// syncedTargets records the subscriptions handed to SyncTarget.
+type syncedTargets []models.Subscription
+
+func (s *syncedTargets) SyncTarget(sub models.Subscription) {
+	*s = append(*s, sub)
+}
+
+func TestProcessMatchesAddressesInAnyCase(t *testing.T) {
+	ctx := context.Background()
+	storage := store.NewMemoryStorage(clock.Real{})
+	targets := &syncedTargets{}
+	processor := NewProcessor(storage, targets)
+
+	subscribe := func(email string) models.Subscription {
+		t.Helper()
+		sub := models.Subscription{Email: email, City: "Kyiv", Frequency: models.Daily, Units: models.Metric, Token: "token-" + email}
+		if err := storage.Subscription.Create(ctx, &sub); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := storage.Subscription.ConfirmByID(ctx, sub.ID); err != nil {
+			t.Fatal(err)
+		}
+		return sub
+	}
+	bounced := subscribe("gone@example.com")
+	complained := subscribe("reader@example.com")
+	soft := subscribe("full@example.com")
+
+	err := processor.Process(ctx, []Event{
+		{Email: "Gone@Example.com", Kind: models.BounceHard, Source: sourceWebhook},
+		{Email: "READER@example.com", Kind: models.Complaint, Source: sourceWebhook},
+		{Email: "Full@Example.com", Kind: models.BounceSoft, Source: sourceWebhook},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		sub        models.Subscription
+		status     string
+		suppressed bool
+	}{
+		{bounced, models.StatusBounced, true},
+		{complained, models.StatusUnsubscribed, true},
+		{soft, models.StatusActive, false},
+	} {
+		got, err := storage.Subscription.GetByID(ctx, tt.sub.ID)
+		if err != nil || got.Status != tt.status {
+			t.Errorf("%s: got status %q, %v, want %q", tt.sub.Email, got.Status, err, tt.status)
+		}
+		if suppressed, err := storage.Suppression.IsSuppressed(ctx, tt.sub.Email); err != nil || suppressed != tt.suppressed {
+			t.Errorf("%s: got suppressed %v, %v, want %v", tt.sub.Email, suppressed, err, tt.suppressed)
+		}
+	}
+	if len(*targets) != 2 {
+		t.Errorf("got %d schedule syncs, want one per suppressed subscription", len(*targets))
+	}
+}
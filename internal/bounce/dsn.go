@@ -0,0 +1,188 @@
+package bounce
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+const sourceMailbox = "mailbox"
+
+// ParseMessage extracts events from a bounce mailbox message. It understands
+// RFC 3464 delivery status notifications and RFC 5965 (ARF) abuse reports,
+// both sent as multipart/report.
+func ParseMessage(r io.Reader) ([]Event, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "cant read message")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, errors.Wrap(err, "cant parse content type")
+	}
+	if mediaType != "multipart/report" {
+		return nil, errors.Errorf("not a report: %s", mediaType)
+	}
+
+	var (
+		parts    = multipart.NewReader(msg.Body, params["boundary"])
+		report   textproto.MIMEHeader
+		statuses []textproto.MIMEHeader
+		original textproto.MIMEHeader
+	)
+
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "cant read report part")
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "message/delivery-status", "message/global-delivery-status", "message/feedback-report":
+			blocks, err := readFieldBlocks(decodePart(part))
+			if err != nil {
+				return nil, errors.Wrap(err, "cant parse "+partType)
+			}
+			if partType == "message/feedback-report" {
+				if len(blocks) > 0 {
+					report = blocks[0]
+				}
+				continue
+			}
+			// the first block describes the message, the rest one recipient each
+			if len(blocks) > 1 {
+				statuses = append(statuses, blocks[1:]...)
+			}
+		case "message/rfc822", "text/rfc822-headers":
+			headers, err := textproto.NewReader(bufio.NewReader(decodePart(part))).ReadMIMEHeader()
+			if err != nil && len(headers) == 0 {
+				continue
+			}
+			original = headers
+		}
+	}
+
+	switch {
+	case report != nil:
+		return complaintEvents(report, original), nil
+	case len(statuses) > 0:
+		return bounceEvents(statuses), nil
+	default:
+		return nil, errors.New("report has no delivery status or feedback report")
+	}
+}
+
+func bounceEvents(statuses []textproto.MIMEHeader) []Event {
+	var events []Event
+
+	for _, fields := range statuses {
+		action := strings.ToLower(strings.TrimSpace(fields.Get("Action")))
+		if action != "failed" && action != "delayed" {
+			continue
+		}
+
+		email := addressField(fields.Get("Final-Recipient"))
+		if email == "" {
+			email = addressField(fields.Get("Original-Recipient"))
+		}
+		if email == "" {
+			continue
+		}
+
+		status := strings.TrimSpace(fields.Get("Status"))
+		kind := models.BounceSoft
+		if action == "failed" && strings.HasPrefix(status, "5.") {
+			kind = models.BounceHard
+		}
+
+		reason := strings.TrimSpace(fields.Get("Diagnostic-Code"))
+		if reason == "" {
+			reason = status
+		}
+
+		events = append(events, Event{Email: email, Kind: kind, Reason: reason, Source: sourceMailbox})
+	}
+
+	return events
+}
+
+func complaintEvents(report, original textproto.MIMEHeader) []Event {
+	feedbackType := strings.ToLower(strings.TrimSpace(report.Get("Feedback-Type")))
+	if feedbackType != "abuse" && feedbackType != "fraud" {
+		return nil
+	}
+
+	var recipients []string
+	for _, rcpt := range report.Values("Original-Rcpt-To") {
+		if email := addressField(rcpt); email != "" {
+			recipients = append(recipients, email)
+		}
+	}
+	if len(recipients) == 0 && original != nil {
+		if list, err := mail.ParseAddressList(original.Get("To")); err == nil {
+			for _, addr := range list {
+				recipients = append(recipients, addr.Address)
+			}
+		}
+	}
+
+	events := make([]Event, 0, len(recipients))
+	for _, email := range recipients {
+		events = append(events, Event{Email: email, Kind: models.Complaint, Reason: feedbackType, Source: sourceMailbox})
+	}
+	return events
+}
+
+// addressField reads fields like "rfc822; user@example.com".
+func addressField(value string) string {
+	if _, addr, ok := strings.Cut(value, ";"); ok {
+		value = addr
+	}
+	return strings.Trim(strings.TrimSpace(value), "<>")
+}
+
+// readFieldBlocks reads header-style field groups separated by blank lines.
+func readFieldBlocks(r io.Reader) ([]textproto.MIMEHeader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	var blocks []textproto.MIMEHeader
+	for _, chunk := range bytes.Split(data, []byte("\n\n")) {
+		chunk = bytes.TrimSpace(chunk)
+		if len(chunk) == 0 {
+			continue
+		}
+		chunk = append(chunk, '\n', '\n')
+		fields, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(chunk))).ReadMIMEHeader()
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, fields)
+	}
+	return blocks, nil
+}
+
+func decodePart(part *multipart.Part) io.Reader {
+	// multipart.Part already decodes quoted-printable on its own
+	if strings.EqualFold(part.Header.Get("Content-Transfer-Encoding"), "base64") {
+		return base64.NewDecoder(base64.StdEncoding, part)
+	}
+	return part
+}
@@ -0,0 +1,74 @@
+package bounce
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"weather/internal/models"
+)
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		file    string
+		want    []Event
+		wantErr bool
+	}{
+		{
+			file: "postfix_hard.eml",
+			want: []Event{{
+				Email:  "Gone.User@Example.com",
+				Kind:   models.BounceHard,
+				Reason: "smtp; 550 5.1.1 <gone.user@example.com>: Recipient address rejected: User unknown",
+				Source: sourceMailbox,
+			}},
+		},
+		{
+			file: "delayed_soft.eml",
+			want: []Event{{Email: "full@example.net", Kind: models.BounceSoft, Reason: "smtp; 452 4.2.2 Mailbox full", Source: sourceMailbox}},
+		},
+		{
+			// a failed delivery with a 4.x status is still soft, delivered
+			// recipients are left out
+			file: "multiple_recipients_base64.eml",
+			want: []Event{
+				{Email: "nobody@example.com", Kind: models.BounceHard, Reason: "smtp;550 5.1.10 RESOLVER.ADR.RecipientNotFound", Source: sourceMailbox},
+				{Email: "busy@example.com", Kind: models.BounceSoft, Reason: "smtp;400 4.4.7 Message delayed", Source: sourceMailbox},
+			},
+		},
+		{
+			file: "arf_abuse.eml",
+			want: []Event{{Email: "Reader@Example.com", Kind: models.Complaint, Reason: "abuse", Source: sourceMailbox}},
+		},
+		{
+			// without Original-Rcpt-To the recipients come from the original headers
+			file: "arf_headers_only.eml",
+			want: []Event{
+				{Email: "first@example.com", Kind: models.Complaint, Reason: "fraud", Source: sourceMailbox},
+				{Email: "second@example.com", Kind: models.Complaint, Reason: "fraud", Source: sourceMailbox},
+			},
+		},
+		{file: "arf_not_spam.eml"},
+		{file: "not_a_report.eml", wantErr: true},
+		{file: "report_without_status.eml", wantErr: true},
+		{file: "truncated.eml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			got, err := ParseMessage(f)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package bounce
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	processedDir = "processed"
+	failedDir    = "failed"
+)
+
+// Mailbox reads bounce and complaint reports dropped as files into a
+// directory, e.g. by a local MTA delivering the bounce address to disk.
+// Handled files are moved to processed/, unreadable ones to failed/.
+type Mailbox struct {
+	Dir       string
+	processor *Processor
+}
+
+func NewMailbox(dir string, processor *Processor) *Mailbox {
+	return &Mailbox{
+		Dir:       dir,
+		processor: processor,
+	}
+}
+
+func (m *Mailbox) Scan(ctx context.Context) error {
+	entries, err := os.ReadDir(m.Dir)
+	if err != nil {
+		return errors.Wrap(err, "cant read bounce mailbox")
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		path := filepath.Join(m.Dir, entry.Name())
+		events, err := m.parse(path)
+		if err != nil {
+			log.Printf("ERROR: cant parse bounce %s: %v", entry.Name(), err)
+			if err := m.move(path, failedDir); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// a store failure leaves the file in place to be retried next scan
+		if err := m.processor.Process(ctx, events); err != nil {
+			return errors.Wrapf(err, "cant process bounce %s", entry.Name())
+		}
+		if err := m.move(path, processedDir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Mailbox) parse(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseMessage(f)
+}
+
+func (m *Mailbox) move(path, subdir string) error {
+	dir := filepath.Join(m.Dir, subdir)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return errors.Wrap(err, "cant create "+subdir+" directory")
+	}
+	return errors.Wrap(os.Rename(path, filepath.Join(dir, filepath.Base(path))), "cant move bounce file")
+}
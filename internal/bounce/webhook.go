@@ -0,0 +1,146 @@
+package bounce
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+const sourceWebhook = "webhook"
+
+// webhookEvent covers the generic format
+//
+//	{"type": "bounce", "bounce_type": "hard", "email": "...", "reason": "..."}
+//
+// as well as SendGrid ("event") and Postmark ("Type": "HardBounce") payloads.
+type webhookEvent struct {
+	Event      string `json:"event"`
+	Type       string `json:"type"`
+	BounceType string `json:"bounce_type"`
+	Email      string `json:"email"`
+	Reason     string `json:"reason"`
+	Details    string `json:"details"`
+}
+
+// sesNotification is an Amazon SES notification, optionally wrapped in SNS.
+type sesNotification struct {
+	NotificationType string `json:"notificationType"`
+	Bounce           struct {
+		BounceType        string `json:"bounceType"`
+		BouncedRecipients []struct {
+			EmailAddress   string `json:"emailAddress"`
+			DiagnosticCode string `json:"diagnosticCode"`
+		} `json:"bouncedRecipients"`
+	} `json:"bounce"`
+	Complaint struct {
+		ComplaintFeedbackType string `json:"complaintFeedbackType"`
+		ComplainedRecipients  []struct {
+			EmailAddress string `json:"emailAddress"`
+		} `json:"complainedRecipients"`
+	} `json:"complaint"`
+}
+
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// ParseWebhook turns a provider notification into events. Unknown event
+// types, e.g. deliveries or opens, are skipped.
+func ParseWebhook(body []byte) ([]Event, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, errors.New("empty webhook body")
+	}
+
+	if body[0] == '[' {
+		var batch []webhookEvent
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return nil, errors.Wrap(err, "cant parse webhook batch")
+		}
+		var events []Event
+		for _, we := range batch {
+			if e, ok := we.event(); ok {
+				events = append(events, e)
+			}
+		}
+		return events, nil
+	}
+
+	var envelope snsEnvelope
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Type == "Notification" && envelope.Message != "" {
+		body = []byte(envelope.Message)
+	}
+
+	var ses sesNotification
+	if err := json.Unmarshal(body, &ses); err == nil && ses.NotificationType != "" {
+		return ses.events(), nil
+	}
+
+	var we webhookEvent
+	if err := json.Unmarshal(body, &we); err != nil {
+		return nil, errors.Wrap(err, "cant parse webhook")
+	}
+	if e, ok := we.event(); ok {
+		return []Event{e}, nil
+	}
+	return nil, nil
+}
+
+func (we webhookEvent) event() (Event, bool) {
+	kind := strings.ToLower(we.Event)
+	if kind == "" {
+		kind = strings.ToLower(we.Type)
+	}
+
+	e := Event{
+		Email:  we.Email,
+		Reason: we.Reason,
+		Source: sourceWebhook,
+	}
+	if e.Reason == "" {
+		e.Reason = we.Details
+	}
+
+	switch kind {
+	case "complaint", "spamreport", "spam_report", "spamcomplaint", "abuse":
+		e.Kind = models.Complaint
+	case "bounce", "hard_bounce", "hardbounce":
+		switch strings.ToLower(we.BounceType) {
+		case "soft", "transient", "blocked":
+			e.Kind = models.BounceSoft
+		default:
+			e.Kind = models.BounceHard
+		}
+	case "soft_bounce", "softbounce", "blocked", "deferred", "transient":
+		e.Kind = models.BounceSoft
+	default:
+		return Event{}, false
+	}
+
+	return e, e.Email != ""
+}
+
+func (n sesNotification) events() []Event {
+	var events []Event
+
+	switch n.NotificationType {
+	case "Bounce":
+		kind := models.BounceSoft
+		if n.Bounce.BounceType == "Permanent" {
+			kind = models.BounceHard
+		}
+		for _, r := range n.Bounce.BouncedRecipients {
+			events = append(events, Event{Email: r.EmailAddress, Kind: kind, Reason: r.DiagnosticCode, Source: sourceWebhook})
+		}
+	case "Complaint":
+		for _, r := range n.Complaint.ComplainedRecipients {
+			events = append(events, Event{Email: r.EmailAddress, Kind: models.Complaint, Reason: n.Complaint.ComplaintFeedbackType, Source: sourceWebhook})
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,83 @@
+package bounce
+
+import (
+	"reflect"
+	"testing"
+
+	"weather/internal/models"
+)
+
+func TestParseWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []Event
+		wantErr bool
+	}{
+		{
+			name: "generic hard bounce",
+			body: `{"type": "bounce", "bounce_type": "hard", "email": "gone@example.com", "reason": "550 5.1.1 user unknown"}`,
+			want: []Event{{Email: "gone@example.com", Kind: models.BounceHard, Reason: "550 5.1.1 user unknown", Source: sourceWebhook}},
+		},
+		{
+			name: "generic soft bounce",
+			body: `{"type": "bounce", "bounce_type": "soft", "email": "full@example.com", "reason": "mailbox full"}`,
+			want: []Event{{Email: "full@example.com", Kind: models.BounceSoft, Reason: "mailbox full", Source: sourceWebhook}},
+		},
+		{
+			name: "sendgrid batch",
+			body: `[
+				{"email": "gone@example.com", "timestamp": 1760861702, "event": "bounce", "type": "bounce", "reason": "550 5.1.1 The email account does not exist", "status": "5.1.1"},
+				{"email": "blocked@example.com", "timestamp": 1760861702, "event": "bounce", "type": "blocked", "bounce_type": "blocked", "reason": "421 try again later"},
+				{"email": "reader@example.com", "timestamp": 1760861702, "event": "spamreport"},
+				{"email": "opened@example.com", "timestamp": 1760861702, "event": "open"}
+			]`,
+			want: []Event{
+				{Email: "gone@example.com", Kind: models.BounceHard, Reason: "550 5.1.1 The email account does not exist", Source: sourceWebhook},
+				{Email: "blocked@example.com", Kind: models.BounceSoft, Reason: "421 try again later", Source: sourceWebhook},
+				{Email: "reader@example.com", Kind: models.Complaint, Source: sourceWebhook},
+			},
+		},
+		{
+			name: "postmark hard bounce",
+			body: `{"RecordType": "Bounce", "Type": "HardBounce", "TypeCode": 1, "Email": "gone@example.com", "Details": "smtp;550 5.1.1 user unknown"}`,
+			want: []Event{{Email: "gone@example.com", Kind: models.BounceHard, Reason: "smtp;550 5.1.1 user unknown", Source: sourceWebhook}},
+		},
+		{
+			name: "postmark spam complaint",
+			body: `{"RecordType": "SpamComplaint", "Type": "SpamComplaint", "Email": "reader@example.com"}`,
+			want: []Event{{Email: "reader@example.com", Kind: models.Complaint, Source: sourceWebhook}},
+		},
+		{
+			name: "ses permanent bounce in sns",
+			body: `{"Type": "Notification", "MessageId": "1", "Message": "{\"notificationType\":\"Bounce\",\"bounce\":{\"bounceType\":\"Permanent\",\"bounceSubType\":\"General\",\"bouncedRecipients\":[{\"emailAddress\":\"Gone@Example.com\",\"action\":\"failed\",\"status\":\"5.1.1\",\"diagnosticCode\":\"smtp; 550 5.1.1 user unknown\"}]}}"}`,
+			want: []Event{{Email: "Gone@Example.com", Kind: models.BounceHard, Reason: "smtp; 550 5.1.1 user unknown", Source: sourceWebhook}},
+		},
+		{
+			name: "ses transient bounce",
+			body: `{"notificationType": "Bounce", "bounce": {"bounceType": "Transient", "bouncedRecipients": [{"emailAddress": "full@example.com"}]}}`,
+			want: []Event{{Email: "full@example.com", Kind: models.BounceSoft, Source: sourceWebhook}},
+		},
+		{
+			name: "ses complaint",
+			body: `{"notificationType": "Complaint", "complaint": {"complaintFeedbackType": "abuse", "complainedRecipients": [{"emailAddress": "reader@example.com"}]}}`,
+			want: []Event{{Email: "reader@example.com", Kind: models.Complaint, Reason: "abuse", Source: sourceWebhook}},
+		},
+		{name: "delivery is skipped", body: `{"event": "delivered", "email": "fine@example.com"}`},
+		{name: "bounce without email is skipped", body: `{"type": "bounce", "bounce_type": "hard"}`},
+		{name: "empty", body: "  ", wantErr: true},
+		{name: "not json", body: "bounce for gone@example.com", wantErr: true},
+		{name: "broken batch", body: `[{"event": "bounce"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWebhook([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
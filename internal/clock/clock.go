@@ -0,0 +1,123 @@
+// Package clock lets time-driven code such as the digest scheduler run
+// against a fake clock.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// Real is the system clock.
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+func (Real) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Fake only moves when told to. Channels returned by After fire once Advance
+// or Set moves the clock past their deadline.
+type Fake struct {
+	mx      sync.Mutex
+	now     time.Time
+	waiters []waiter
+	changed chan struct{}
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now, changed: make(chan struct{})}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return f.now
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+
+	f.waiters = append(f.waiters, waiter{at: f.now.Add(d), ch: ch})
+	f.notify()
+	return ch
+}
+
+// Advance moves the clock forward by d.
+func (f *Fake) Advance(d time.Duration) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.set(f.now.Add(d))
+}
+
+// Set moves the clock to t, which may also be in the past, e.g. to mimic an
+// NTP correction.
+func (f *Fake) Set(t time.Time) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.set(t)
+}
+
+func (f *Fake) set(t time.Time) {
+	f.now = t
+
+	sort.Slice(f.waiters, func(i, j int) bool { return f.waiters[i].at.Before(f.waiters[j].at) })
+
+	pending := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(t) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- t
+	}
+	f.waiters = pending
+	f.notify()
+}
+
+// Waiters is the number of After channels that have not fired yet.
+func (f *Fake) Waiters() int {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil waits until at least n After channels are pending, so a test
+// knows the code under test went to sleep before advancing the clock.
+func (f *Fake) BlockUntil(n int) {
+	for {
+		f.mx.Lock()
+		if len(f.waiters) >= n {
+			f.mx.Unlock()
+			return
+		}
+		changed := f.changed
+		f.mx.Unlock()
+		<-changed
+	}
+}
+
+func (f *Fake) notify() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
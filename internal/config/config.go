@@ -2,6 +2,8 @@ package config
 
 import (
 	"time"
+	"weather/internal/ratelimit"
+	"weather/internal/secrets"
 )
 
 type Config struct {
@@ -10,11 +12,71 @@ type Config struct {
 	WriteTimeout time.Duration
 	ReadTimeout  time.Duration
 	IdleTimeout  time.Duration
+	AdminToken   *secrets.Secret
+	// TrustedProxies are the addresses or CIDRs whose X-Forwarded-For is
+	// believed, empty trusts none and uses the peer address.
+	TrustedProxies []string
+	// Storage is "database", backed by DB.Driver, or "memory" for local runs
+	// without one.
+	Storage string
+	// WeatherRequireAuth gates /api/weather behind the weather:read scope.
+	WeatherRequireAuth bool
+	RateLimit          RateLimitConfig
+	OptIn              OptInConfig
+	// BounceWebhookSecret is expected in X-Webhook-Secret, empty disables the webhook.
+	BounceWebhookSecret *secrets.Secret
 }
 
 type DBConfig struct {
-	Addr         string
+	// Driver is "postgres" or "sqlite".
+	Driver string
+	// Path is the SQLite database file, ":memory:" keeps it in process.
+	Path         string
+	Host         string
+	Port         int
+	User         string
+	Password     *secrets.Secret
+	Name         string
+	SSLMode      string
 	MaxOpenConns int
 	MaxIdleConns int
 	MaxIdleTime  string
 }
+
+type SMTPConfig struct {
+	User     *secrets.Secret
+	Password *secrets.Secret
+	Host     string
+	Port     string
+	// Security is "tls" (implicit, port 465), "starttls" (port 587) or
+	// "none" for plaintext local relays.
+	Security string
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string
+	// PoolSize caps concurrent SMTP sessions, each sending many messages.
+	PoolSize    int
+	IdleTimeout time.Duration
+	// Timeout bounds each SMTP transaction, from connecting to QUIT.
+	Timeout time.Duration
+	// MaxPerConn is how many messages go over one session before reconnecting.
+	MaxPerConn int
+}
+
+type RateLimitConfig struct {
+	// Store is either "memory" or "postgres".
+	Store          string
+	Subscribe      ratelimit.Policy
+	SubscribeEmail ratelimit.Policy
+	Weather        ratelimit.Policy
+}
+
+type OptInConfig struct {
+	// ResendCooldown is the minimum time between two confirmation emails to one address.
+	ResendCooldown time.Duration
+	// MaxSendsInWindow caps confirmation emails per address within SendWindow.
+	MaxSendsInWindow int
+	SendWindow       time.Duration
+	// PurgeAfter is how long unconfirmed subscriptions are kept.
+	PurgeAfter    time.Duration
+	PurgeInterval time.Duration
+}
@@ -3,21 +3,78 @@ package database
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
 	"time"
 	"weather/internal/config"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
-const driver = "postgres"
+const (
+	driverName       = "postgres"
+	sqliteDriverName = "sqlite"
+)
 
-func New(cfg config.DBConfig) (*sql.DB, error) {
-	db, err := sql.Open(driver, cfg.Addr)
+// connector builds the DSN on every new connection so the password never
+// sits in a long-lived string and a rotated secret is used for new conns.
+type connector struct {
+	cfg config.DBConfig
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	pqConnector, err := pq.NewConnector(c.dsn())
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to open %s connection", driver)
+		return nil, errors.Wrapf(err, "failed to build %s connector", driverName)
+	}
+	return pqConnector.Connect(ctx)
+}
+
+func (c connector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+func (c connector) dsn() string {
+	password := ""
+	if c.cfg.Password != nil {
+		password = c.cfg.Password.Get()
 	}
 
+	return fmt.Sprintf(
+		"user=%s password=%s host=%s port=%d dbname=%s sslmode=%s",
+		quote(c.cfg.User),
+		quote(password),
+		quote(c.cfg.Host),
+		c.cfg.Port,
+		quote(c.cfg.Name),
+		quote(c.cfg.SSLMode),
+	)
+}
+
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+// New opens the database selected by cfg.Driver. Postgres is migrated with the
+// migrate CLI, SQLite applies its embedded migrations itself.
+func New(cfg config.DBConfig) (*sql.DB, error) {
+	switch cfg.Driver {
+	case driverName, "":
+		return newPostgres(cfg)
+	case sqliteDriverName:
+		return newSQLite(cfg)
+	default:
+		return nil, errors.Errorf("unknown database driver: %s", cfg.Driver)
+	}
+}
+
+func newPostgres(cfg config.DBConfig) (*sql.DB, error) {
+	db := sql.OpenDB(connector{cfg})
+
 	db.SetMaxOpenConns(cfg.MaxOpenConns)
 	db.SetMaxIdleConns(cfg.MaxIdleConns)
 
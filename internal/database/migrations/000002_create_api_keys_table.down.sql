@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS weather."api_keys_key_hash";
+
+DROP TABLE IF EXISTS weather.api_keys;
\ No newline at end of file
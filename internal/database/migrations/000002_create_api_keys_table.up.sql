@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS weather.api_keys (
+    id           bigserial PRIMARY KEY,
+    name         character varying(255)             NOT NULL,
+    prefix       character varying(16)              NOT NULL,
+    key_hash     character(64)                      NOT NULL UNIQUE,
+    scopes       text[]       DEFAULT '{}'          NOT NULL,
+    usage_count  bigint       DEFAULT 0             NOT NULL,
+    last_used_at timestamp with time zone,
+    created_at   timestamp with time zone DEFAULT now() NOT NULL,
+    revoked_at   timestamp with time zone
+);
+
+CREATE INDEX "api_keys_key_hash" ON weather.api_keys("key_hash");
\ No newline at end of file
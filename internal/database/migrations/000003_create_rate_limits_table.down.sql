@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS weather."rate_limits_updated_at";
+
+DROP TABLE IF EXISTS weather.rate_limits;
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS weather.rate_limits (
+    key        character varying(512)             PRIMARY KEY,
+    tokens     double precision                   NOT NULL,
+    allowed    boolean                            NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX "rate_limits_updated_at" ON weather.rate_limits("updated_at");
\ No newline at end of file
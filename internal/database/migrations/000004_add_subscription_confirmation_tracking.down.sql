@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS weather."subscriptions_unconfirmed_created_at";
+
+ALTER TABLE weather.subscriptions
+    DROP COLUMN IF EXISTS confirmation_window_started_at,
+    DROP COLUMN IF EXISTS confirmation_sends,
+    DROP COLUMN IF EXISTS confirmation_sent_at,
+    DROP COLUMN IF EXISTS created_at;
\ No newline at end of file
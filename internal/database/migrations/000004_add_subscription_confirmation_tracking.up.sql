@@ -0,0 +1,7 @@
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS created_at                     timestamp with time zone DEFAULT now() NOT NULL,
+    ADD COLUMN IF NOT EXISTS confirmation_sent_at           timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS confirmation_sends             integer DEFAULT 0 NOT NULL,
+    ADD COLUMN IF NOT EXISTS confirmation_window_started_at timestamp with time zone;
+
+CREATE INDEX "subscriptions_unconfirmed_created_at" ON weather.subscriptions("created_at") WHERE confirmed = false;
\ No newline at end of file
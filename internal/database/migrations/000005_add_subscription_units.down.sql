@@ -0,0 +1,2 @@
+ALTER TABLE weather.subscriptions
+    DROP COLUMN IF EXISTS units;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS units character varying(16) DEFAULT 'metric' NOT NULL
+        CHECK (units IN ('metric', 'imperial'));
\ No newline at end of file
@@ -0,0 +1,16 @@
+DROP INDEX IF EXISTS weather."subscription_history_subscription_id";
+
+DROP TABLE IF EXISTS weather.subscription_history;
+
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS subscribed boolean DEFAULT false NOT NULL;
+
+UPDATE weather.subscriptions SET subscribed = (status = 'active');
+
+DROP INDEX IF EXISTS weather."subscriptions_status";
+
+ALTER TABLE weather.subscriptions
+    DROP COLUMN IF EXISTS status_changed_at,
+    DROP COLUMN IF EXISTS status;
+
+DROP TYPE IF EXISTS weather.subscription_status;
\ No newline at end of file
@@ -0,0 +1,38 @@
+CREATE TYPE weather.subscription_status AS ENUM (
+    'pending',
+    'active',
+    'paused',
+    'unsubscribed',
+    'bounced'
+);
+
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS status            weather.subscription_status DEFAULT 'pending' NOT NULL,
+    ADD COLUMN IF NOT EXISTS status_changed_at timestamp with time zone DEFAULT now() NOT NULL;
+
+UPDATE weather.subscriptions
+SET status = CASE
+    WHEN confirmed AND subscribed THEN 'active'::weather.subscription_status
+    WHEN confirmed THEN 'unsubscribed'::weather.subscription_status
+    ELSE 'pending'::weather.subscription_status
+END;
+
+ALTER TABLE weather.subscriptions DROP COLUMN IF EXISTS subscribed;
+
+CREATE INDEX "subscriptions_status" ON weather.subscriptions("status");
+
+CREATE TABLE IF NOT EXISTS weather.subscription_history (
+    id              bigserial PRIMARY KEY,
+    subscription_id bigint                             NOT NULL,
+    email           character varying(255)             NOT NULL,
+    from_status     weather.subscription_status,
+    to_status       weather.subscription_status        NOT NULL,
+    reason          text                               NOT NULL,
+    changed_at      timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX "subscription_history_subscription_id" ON weather.subscription_history("subscription_id");
+
+INSERT INTO weather.subscription_history (subscription_id, email, from_status, to_status, reason)
+SELECT id, email, NULL, status, 'migrated'
+FROM weather.subscriptions;
\ No newline at end of file
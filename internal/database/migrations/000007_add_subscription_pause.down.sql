@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS weather."subscriptions_paused_until";
+
+ALTER TABLE weather.subscriptions
+    DROP COLUMN IF EXISTS paused_until;
\ No newline at end of file
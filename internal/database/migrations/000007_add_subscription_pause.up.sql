@@ -0,0 +1,4 @@
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS paused_until timestamp with time zone;
+
+CREATE INDEX "subscriptions_paused_until" ON weather.subscriptions("paused_until") WHERE status = 'paused';
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS weather.suppressions;
\ No newline at end of file
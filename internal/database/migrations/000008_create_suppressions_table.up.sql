@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS weather.suppressions (
+    email      character varying(255)             PRIMARY KEY,
+    reason     text                               NOT NULL,
+    source     character varying(64)              NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
\ No newline at end of file
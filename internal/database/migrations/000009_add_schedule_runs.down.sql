@@ -0,0 +1,4 @@
+ALTER TABLE weather.subscriptions
+    DROP COLUMN IF EXISTS last_sent_window;
+
+DROP TABLE IF EXISTS weather.schedule_runs;
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS weather.schedule_runs (
+    frequency   character varying(16)              PRIMARY KEY,
+    last_window timestamp with time zone           NOT NULL,
+    finished_at timestamp with time zone DEFAULT now() NOT NULL,
+    sent        integer                            NOT NULL DEFAULT 0,
+    skipped     integer                            NOT NULL DEFAULT 0,
+    failed      integer                            NOT NULL DEFAULT 0
+);
+
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS last_sent_window timestamp with time zone;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS weather.digest_deliveries;
\ No newline at end of file
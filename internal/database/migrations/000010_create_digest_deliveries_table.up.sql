@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS weather.digest_deliveries (
+    idempotency_key character varying(128)             PRIMARY KEY,
+    subscription_id bigint                             NOT NULL,
+    window_start    timestamp with time zone           NOT NULL,
+    created_at      timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX "digest_deliveries_created_at" ON weather.digest_deliveries("created_at");
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS weather.outbox;
\ No newline at end of file
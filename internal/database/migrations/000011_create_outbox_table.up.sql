@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS weather.outbox (
+    id           bigserial PRIMARY KEY,
+    topic        character varying(64)              NOT NULL,
+    payload      jsonb                              NOT NULL,
+    attempts     integer      DEFAULT 0             NOT NULL,
+    available_at timestamp with time zone DEFAULT now() NOT NULL,
+    created_at   timestamp with time zone DEFAULT now() NOT NULL,
+    sent_at      timestamp with time zone,
+    failed_at    timestamp with time zone,
+    last_error   text         DEFAULT ''           NOT NULL
+);
+
+CREATE INDEX "outbox_pending" ON weather.outbox("available_at", "id") WHERE sent_at IS NULL AND failed_at IS NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS weather.observations;
\ No newline at end of file
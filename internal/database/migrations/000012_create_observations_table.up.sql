@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS weather.observations (
+    id          bigserial PRIMARY KEY,
+    city        character varying(255)             NOT NULL,
+    provider    character varying(64)              NOT NULL,
+    temperature double precision                   NOT NULL,
+    humidity    integer                            NOT NULL,
+    condition   character varying(255) DEFAULT ''  NOT NULL,
+    raw         jsonb                              NOT NULL,
+    observed_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX "observations_city_observed_at" ON weather.observations(lower(city), "observed_at");
+CREATE INDEX "observations_observed_at" ON weather.observations("observed_at");
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE weather.subscriptions
+    DROP COLUMN IF EXISTS alert_severities;
\ No newline at end of file
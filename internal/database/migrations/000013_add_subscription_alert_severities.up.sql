@@ -0,0 +1,2 @@
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS alert_severities character varying(64) DEFAULT 'extreme,severe' NOT NULL;
\ No newline at end of file
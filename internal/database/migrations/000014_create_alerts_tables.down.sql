@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS weather.alert_deliveries;
+DROP TABLE IF EXISTS weather.alerts;
\ No newline at end of file
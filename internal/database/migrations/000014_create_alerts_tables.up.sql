@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS weather.alerts (
+    id           character varying(64)              NOT NULL,
+    city         character varying(255)             NOT NULL,
+    event        character varying(255)             NOT NULL,
+    headline     text                               NOT NULL,
+    severity     character varying(16)              NOT NULL,
+    urgency      character varying(32)              NOT NULL,
+    areas        text                               NOT NULL,
+    description  text                               NOT NULL,
+    instruction  text                               NOT NULL,
+    effective_at timestamp with time zone,
+    expires_at   timestamp with time zone,
+    received_at  timestamp with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (id, city)
+);
+
+CREATE INDEX "alerts_city_received_at" ON weather.alerts(lower(city), "received_at");
+
+CREATE TABLE IF NOT EXISTS weather.alert_deliveries (
+    alert_id        character varying(64)              NOT NULL,
+    subscription_id bigint                             NOT NULL,
+    created_at      timestamp with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (alert_id, subscription_id)
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE weather.subscriptions
+    DROP COLUMN IF EXISTS air_quality_threshold;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS air_quality_threshold smallint DEFAULT 0 NOT NULL;
\ No newline at end of file
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS weather.webhook_deliveries;
+
+ALTER TABLE weather.subscriptions
+    DROP COLUMN IF EXISTS webhook_disabled_at,
+    DROP COLUMN IF EXISTS webhook_failures,
+    DROP COLUMN IF EXISTS webhook_url;
\ No newline at end of file
@@ -0,0 +1,19 @@
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS webhook_url character varying(2048) DEFAULT '' NOT NULL,
+    ADD COLUMN IF NOT EXISTS webhook_failures integer DEFAULT 0 NOT NULL,
+    ADD COLUMN IF NOT EXISTS webhook_disabled_at timestamp with time zone;
+
+CREATE TABLE IF NOT EXISTS weather.webhook_deliveries (
+    id              bigserial PRIMARY KEY,
+    subscription_id bigint                             NOT NULL,
+    delivery_id     character varying(64)              NOT NULL,
+    event           character varying(32)              NOT NULL,
+    url             character varying(2048)            NOT NULL,
+    status_code     integer                            NOT NULL,
+    error           text                               NOT NULL,
+    duration_ms     bigint                             NOT NULL,
+    created_at      timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX "webhook_deliveries_subscription_id_created_at" ON weather.webhook_deliveries("subscription_id", "created_at");
+CREATE INDEX "webhook_deliveries_created_at" ON weather.webhook_deliveries("created_at");
\ No newline at end of file
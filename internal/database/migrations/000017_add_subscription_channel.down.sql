@@ -0,0 +1,3 @@
+ALTER TABLE weather.subscriptions
+    DROP COLUMN IF EXISTS chat_id,
+    DROP COLUMN IF EXISTS channel;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS channel character varying(16) DEFAULT 'email' NOT NULL,
+    ADD COLUMN IF NOT EXISTS chat_id bigint DEFAULT 0 NOT NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS weather."subscriptions_email_lower";
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE weather.digest_deliveries
+    DROP COLUMN IF EXISTS previous_window;
\ No newline at end of file
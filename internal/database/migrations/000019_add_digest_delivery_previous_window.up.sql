@@ -0,0 +1,2 @@
+ALTER TABLE weather.digest_deliveries
+    ADD COLUMN IF NOT EXISTS previous_window timestamp with time zone;
\ No newline at end of file
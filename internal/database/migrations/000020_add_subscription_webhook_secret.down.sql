@@ -0,0 +1,2 @@
+ALTER TABLE weather.subscriptions
+    DROP COLUMN IF EXISTS webhook_secret;
\ No newline at end of file
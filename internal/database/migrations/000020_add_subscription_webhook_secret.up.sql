@@ -0,0 +1,2 @@
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS webhook_secret character varying(64) DEFAULT '' NOT NULL;
\ No newline at end of file
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS digest_deliveries;
+DROP TABLE IF EXISTS schedule_runs;
+DROP TABLE IF EXISTS suppressions;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS subscription_history;
+DROP TABLE IF EXISTS subscriptions;
\ No newline at end of file
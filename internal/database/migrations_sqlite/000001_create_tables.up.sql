@@ -0,0 +1,71 @@
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id                             INTEGER PRIMARY KEY AUTOINCREMENT,
+    email                          TEXT      NOT NULL UNIQUE,
+    city                           TEXT      NOT NULL,
+    frequency                      TEXT      NOT NULL CHECK (frequency IN ('hourly', 'daily')),
+    units                          TEXT      NOT NULL DEFAULT 'metric' CHECK (units IN ('metric', 'imperial')),
+    token                          TEXT      NOT NULL UNIQUE,
+    confirmed                      BOOLEAN   NOT NULL DEFAULT 0,
+    status                         TEXT      NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'active', 'paused', 'unsubscribed', 'bounced')),
+    status_changed_at              TIMESTAMP NOT NULL,
+    paused_until                   TIMESTAMP,
+    created_at                     TIMESTAMP NOT NULL,
+    confirmation_sent_at           TIMESTAMP,
+    confirmation_sends             INTEGER   NOT NULL DEFAULT 0,
+    confirmation_window_started_at TIMESTAMP,
+    last_sent_window               TIMESTAMP
+);
+
+CREATE INDEX subscriptions_status ON subscriptions(status);
+CREATE INDEX subscriptions_unconfirmed_created_at ON subscriptions(created_at) WHERE confirmed = 0;
+CREATE INDEX subscriptions_paused_until ON subscriptions(paused_until) WHERE status = 'paused';
+
+CREATE TABLE IF NOT EXISTS subscription_history (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscription_id INTEGER   NOT NULL,
+    email           TEXT      NOT NULL,
+    from_status     TEXT,
+    to_status       TEXT      NOT NULL,
+    reason          TEXT      NOT NULL,
+    changed_at      TIMESTAMP NOT NULL
+);
+
+CREATE INDEX subscription_history_subscription_id ON subscription_history(subscription_id);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    name         TEXT      NOT NULL,
+    prefix       TEXT      NOT NULL,
+    key_hash     TEXT      NOT NULL UNIQUE,
+    scopes       TEXT      NOT NULL DEFAULT '[]',
+    usage_count  INTEGER   NOT NULL DEFAULT 0,
+    last_used_at TIMESTAMP,
+    created_at   TIMESTAMP NOT NULL,
+    revoked_at   TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS suppressions (
+    email      TEXT      PRIMARY KEY,
+    reason     TEXT      NOT NULL,
+    source     TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS schedule_runs (
+    frequency   TEXT      PRIMARY KEY,
+    last_window TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    sent        INTEGER   NOT NULL DEFAULT 0,
+    skipped     INTEGER   NOT NULL DEFAULT 0,
+    failed      INTEGER   NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS digest_deliveries (
+    idempotency_key TEXT      PRIMARY KEY,
+    subscription_id INTEGER   NOT NULL,
+    window_start    TIMESTAMP NOT NULL,
+    created_at      TIMESTAMP NOT NULL
+);
+
+CREATE INDEX digest_deliveries_created_at ON digest_deliveries(created_at);
\ No newline at end of file
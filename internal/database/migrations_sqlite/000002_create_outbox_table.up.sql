@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS outbox (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    topic        TEXT      NOT NULL,
+    payload      TEXT      NOT NULL,
+    attempts     INTEGER   NOT NULL DEFAULT 0,
+    available_at TIMESTAMP NOT NULL,
+    created_at   TIMESTAMP NOT NULL,
+    sent_at      TIMESTAMP,
+    failed_at    TIMESTAMP,
+    last_error   TEXT      NOT NULL DEFAULT ''
+);
+
+CREATE INDEX outbox_pending ON outbox(available_at, id) WHERE sent_at IS NULL AND failed_at IS NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS observations;
\ No newline at end of file
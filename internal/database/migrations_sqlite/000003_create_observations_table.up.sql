@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS observations (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    city        TEXT      NOT NULL,
+    provider    TEXT      NOT NULL,
+    temperature REAL      NOT NULL,
+    humidity    INTEGER   NOT NULL,
+    condition   TEXT      NOT NULL DEFAULT '',
+    raw         TEXT      NOT NULL,
+    observed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX observations_city_observed_at ON observations(lower(city), observed_at);
+CREATE INDEX observations_observed_at ON observations(observed_at);
\ No newline at end of file
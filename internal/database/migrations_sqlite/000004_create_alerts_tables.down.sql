@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS alert_deliveries;
+DROP TABLE IF EXISTS alerts;
+
+ALTER TABLE subscriptions DROP COLUMN alert_severities;
\ No newline at end of file
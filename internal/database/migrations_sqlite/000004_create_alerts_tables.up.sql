@@ -0,0 +1,26 @@
+ALTER TABLE subscriptions ADD COLUMN alert_severities TEXT NOT NULL DEFAULT 'extreme,severe';
+
+CREATE TABLE IF NOT EXISTS alerts (
+    id           TEXT      NOT NULL,
+    city         TEXT      NOT NULL,
+    event        TEXT      NOT NULL,
+    headline     TEXT      NOT NULL,
+    severity     TEXT      NOT NULL,
+    urgency      TEXT      NOT NULL,
+    areas        TEXT      NOT NULL,
+    description  TEXT      NOT NULL,
+    instruction  TEXT      NOT NULL,
+    effective_at TIMESTAMP,
+    expires_at   TIMESTAMP,
+    received_at  TIMESTAMP NOT NULL,
+    PRIMARY KEY (id, city)
+);
+
+CREATE INDEX alerts_city_received_at ON alerts(lower(city), received_at);
+
+CREATE TABLE IF NOT EXISTS alert_deliveries (
+    alert_id        TEXT      NOT NULL,
+    subscription_id INTEGER   NOT NULL,
+    created_at      TIMESTAMP NOT NULL,
+    PRIMARY KEY (alert_id, subscription_id)
+);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE subscriptions DROP COLUMN air_quality_threshold;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE subscriptions ADD COLUMN air_quality_threshold INTEGER NOT NULL DEFAULT 0;
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS webhook_deliveries;
+
+ALTER TABLE subscriptions DROP COLUMN webhook_disabled_at;
+ALTER TABLE subscriptions DROP COLUMN webhook_failures;
+ALTER TABLE subscriptions DROP COLUMN webhook_url;
\ No newline at end of file
@@ -0,0 +1,18 @@
+ALTER TABLE subscriptions ADD COLUMN webhook_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE subscriptions ADD COLUMN webhook_failures INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE subscriptions ADD COLUMN webhook_disabled_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id              INTEGER   PRIMARY KEY AUTOINCREMENT,
+    subscription_id INTEGER   NOT NULL,
+    delivery_id     TEXT      NOT NULL,
+    event           TEXT      NOT NULL,
+    url             TEXT      NOT NULL,
+    status_code     INTEGER   NOT NULL,
+    error           TEXT      NOT NULL,
+    duration_ms     INTEGER   NOT NULL,
+    created_at      TIMESTAMP NOT NULL
+);
+
+CREATE INDEX webhook_deliveries_subscription_id_created_at ON webhook_deliveries(subscription_id, created_at);
+CREATE INDEX webhook_deliveries_created_at ON webhook_deliveries(created_at);
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE subscriptions DROP COLUMN chat_id;
+ALTER TABLE subscriptions DROP COLUMN channel;
\ No newline at end of file
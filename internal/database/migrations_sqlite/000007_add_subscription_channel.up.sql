@@ -0,0 +1,2 @@
+ALTER TABLE subscriptions ADD COLUMN channel TEXT NOT NULL DEFAULT 'email';
+ALTER TABLE subscriptions ADD COLUMN chat_id INTEGER NOT NULL DEFAULT 0;
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS "subscriptions_email_lower" ON subscriptions(lower(email));
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE digest_deliveries DROP COLUMN previous_window;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE digest_deliveries ADD COLUMN previous_window TIMESTAMP;
\ No newline at end of file
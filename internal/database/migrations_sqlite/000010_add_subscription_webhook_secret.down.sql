@@ -0,0 +1 @@
+ALTER TABLE subscriptions DROP COLUMN webhook_secret;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE subscriptions ADD COLUMN webhook_secret TEXT NOT NULL DEFAULT '';
\ No newline at end of file
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"weather/internal/config"
+
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed migrations_sqlite/*.up.sql
+var sqliteMigrations embed.FS
+
+// newSQLite opens the database file at cfg.Path and brings its schema up to
+// date. Times are stored as sortable UTC text and every transaction takes the
+// write lock up front, so a read-then-update never fails half way with BUSY.
+func newSQLite(cfg config.DBConfig) (*sql.DB, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("sqlite needs a database path")
+	}
+
+	dsn := "file:" + cfg.Path +
+		"?_pragma=busy_timeout(5000)" +
+		"&_pragma=journal_mode(WAL)" +
+		"&_time_format=sqlite" +
+		"&_txlock=immediate"
+
+	db, err := sql.Open(sqliteDriverName, dsn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cant open sqlite database %s", cfg.Path)
+	}
+
+	// SQLite has a single writer, one connection serializes the writes
+	// instead of making them wait on busy_timeout, and keeps :memory: alive.
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxIdleTime(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "ping wasn't successful")
+	}
+
+	if err = migrateSQLite(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// migrateSQLite applies the embedded up migrations newer than the recorded
+// version. The version table has the layout of the migrate CLI, so the same
+// database can be handed to it later.
+func migrateSQLite(ctx context.Context, db *sql.DB) error {
+	const createQuery = `
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version INTEGER NOT NULL PRIMARY KEY,
+            dirty   BOOLEAN NOT NULL
+        );
+    `
+	const versionQuery = `
+        SELECT version, dirty FROM schema_migrations LIMIT 1;
+    `
+
+	if _, err := db.ExecContext(ctx, createQuery); err != nil {
+		return errors.Wrap(err, "cant create schema_migrations")
+	}
+
+	var (
+		current int64
+		dirty   bool
+	)
+	err := db.QueryRowContext(ctx, versionQuery).Scan(&current, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return errors.Wrap(err, "cant read schema version")
+	}
+	if dirty {
+		return errors.Errorf("schema version %d is dirty, fix it by hand", current)
+	}
+
+	files, err := fs.Glob(sqliteMigrations, "migrations_sqlite/*.up.sql")
+	if err != nil {
+		return errors.Wrap(err, "cant list sqlite migrations")
+	}
+
+	for _, file := range files {
+		name := path.Base(file)
+		version, err := strconv.ParseInt(name[:strings.IndexByte(name, '_')], 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "bad migration name %s", name)
+		}
+		if version <= current {
+			continue
+		}
+
+		if err := applySQLiteMigration(ctx, db, file, version); err != nil {
+			return errors.Wrapf(err, "cant apply migration %s", name)
+		}
+	}
+
+	return nil
+}
+
+func applySQLiteMigration(ctx context.Context, db *sql.DB, file string, version int64) error {
+	body, err := sqliteMigrations.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, string(body)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations;`); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES (?, 0);`, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,99 @@
+package janitor
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Task is a periodic housekeeping job, e.g. purging stale rows.
+type Task struct {
+	Name     string
+	Interval time.Duration
+	// Timeout bounds one run, zero bounds it by Interval.
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// Janitor runs housekeeping tasks in the background, each on its own interval.
+type Janitor struct {
+	mx    sync.Mutex
+	tasks []Task
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	running  bool
+}
+
+func New() *Janitor {
+	return &Janitor{
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Add registers a task. Tasks added after Start run from the next Start on.
+func (j *Janitor) Add(task Task) {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	j.tasks = append(j.tasks, task)
+}
+
+func (j *Janitor) Start() {
+	j.mx.Lock()
+	if j.running {
+		j.mx.Unlock()
+		return
+	}
+	j.running = true
+	j.stopChan = make(chan struct{})
+	tasks := append([]Task(nil), j.tasks...)
+	j.mx.Unlock()
+
+	for _, task := range tasks {
+		if task.Interval <= 0 {
+			continue
+		}
+
+		j.wg.Add(1)
+		go func(task Task) {
+			defer j.wg.Done()
+			ticker := time.NewTicker(task.Interval)
+			defer ticker.Stop()
+			for {
+				j.run(task)
+				select {
+				case <-ticker.C:
+				case <-j.stopChan:
+					return
+				}
+			}
+		}(task)
+	}
+}
+
+func (j *Janitor) Stop() {
+	j.mx.Lock()
+	if !j.running {
+		j.mx.Unlock()
+		return
+	}
+	j.running = false
+	close(j.stopChan)
+	j.mx.Unlock()
+	j.wg.Wait()
+}
+
+func (j *Janitor) run(task Task) {
+	timeout := task.Timeout
+	if timeout <= 0 {
+		timeout = task.Interval
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := task.Run(ctx); err != nil {
+		log.Printf("ERROR: janitor task %s: %v", task.Name, err)
+	}
+}
@@ -0,0 +1,40 @@
+// Package lock provides named locks that keep work such as a digest window
+// to one replica at a time.
+package lock
+
+import (
+	"context"
+	"sync"
+)
+
+// Locker hands out non-blocking named locks. TryLock reports false when
+// another holder has the lock; the returned unlock must be called otherwise.
+type Locker interface {
+	TryLock(ctx context.Context, name string) (unlock func(), ok bool, err error)
+}
+
+// Local locks within one process, for single instance deployments.
+type Local struct {
+	mx   sync.Mutex
+	held map[string]bool
+}
+
+func NewLocal() *Local {
+	return &Local{held: make(map[string]bool)}
+}
+
+func (l *Local) TryLock(_ context.Context, name string) (func(), bool, error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.held[name] {
+		return nil, false, nil
+	}
+	l.held[name] = true
+
+	return func() {
+		l.mx.Lock()
+		defer l.mx.Unlock()
+		delete(l.held, name)
+	}, true, nil
+}
@@ -0,0 +1,67 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"hash/fnv"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const queryTimeout = 5 * time.Second
+
+// Postgres uses session level advisory locks. The lock lives on a connection
+// taken out of the pool, so if the holder dies its session ends and the lock
+// is released for another replica to take over.
+type Postgres struct {
+	db *sql.DB
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+func (p *Postgres) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	key := lockKey(name)
+
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to get lock connection")
+	}
+
+	qctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var ok bool
+	if err := conn.QueryRowContext(qctx, `SELECT pg_try_advisory_lock($1);`, key).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, false, errors.Wrap(err, "failed to take advisory lock")
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	unlock := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+		defer cancel()
+
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1);`, key); err != nil {
+			log.Printf("ERROR: cant release lock %s: %v", name, err)
+			// drop the session instead of pooling it, that frees the lock
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+
+	return unlock, true, nil
+}
+
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("weather:" + name))
+	return int64(h.Sum64())
+}
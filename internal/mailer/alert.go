@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"weather/internal/models"
+)
+
+var alertTemplate = template.Must(template.New("alert.txt").Funcs(template.FuncMap{
+	"title": func(s string) string {
+		if s == "" {
+			return s
+		}
+		return strings.ToUpper(s[:1]) + s[1:]
+	},
+	"join": func(s models.AlertSeverities, sep string) string {
+		return strings.Join(s, sep)
+	},
+}).ParseFS(templatesFS, "templates/alert.txt"))
+
+// AlertMessage is the notification of alert to sub. It carries the same
+// footer and unsubscribe headers as digests, and a Message-ID derived from the
+// alert so a resent notification is recognised as the same message.
+func (m *SmtpMailer) AlertMessage(sub models.Subscription, alert models.Alert) (Message, error) {
+	var b strings.Builder
+	err := alertTemplate.Execute(&b, struct {
+		Subscription    models.Subscription
+		Alert           models.Alert
+		AirQualityEvent string
+	}{sub, alert, models.AirQualityEvent})
+	if err != nil {
+		return Message{}, fmt.Errorf("render alert: %w", err)
+	}
+
+	subject := fmt.Sprintf("Weather alert for %s – %s", sub.City, alert.Event)
+	msg := m.digestMessage(sub, subject, b.String())
+	msg.Headers["Message-ID"] = m.messageID("alert." + alert.ID + "." + strconv.FormatInt(sub.ID, 10))
+
+	return msg, nil
+}
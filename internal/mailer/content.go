@@ -0,0 +1,277 @@
+package mailer
+
+import (
+	"embed"
+	"fmt"
+	"math"
+	"strings"
+	"text/template"
+	"time"
+
+	"weather/internal/models"
+)
+
+//go:embed templates/*.txt
+var templatesFS embed.FS
+
+// digestTemplate greets the subscriber and renders the body shared with chat
+// digests, digestBodyTemplate is only the body.
+var (
+	digestTemplate     = template.Must(template.ParseFS(templatesFS, "templates/digest.txt", "templates/digest_body.txt"))
+	digestBodyTemplate = digestTemplate.Lookup("digest_body.txt")
+)
+
+// wetChance is the chance of rain or snow from which an hour counts as wet.
+const wetChance = 50
+
+// CityReport is everything known about a city when its digest goes out.
+// Forecast and Yesterday are nil when they could not be had.
+type CityReport struct {
+	Current   models.Weather
+	Forecast  *models.Forecast
+	Yesterday *models.ObservationBucket
+}
+
+// DigestContent is what one digest says. Sections without data stay nil, so
+// templates render only what is there. Temperatures are in °C, Temperature
+// and Difference format them in the subscriber's units.
+type DigestContent struct {
+	Subscription  models.Subscription
+	Current       models.Weather
+	Today         *DaySummary
+	Comparison    *Comparison
+	Sun           *SunTimes
+	Precipitation *PrecipitationOutlook
+	AirQuality    *models.AirQuality
+	Advice        []string
+}
+
+type DaySummary struct {
+	Condition string
+	Min       float64
+	Max       float64
+}
+
+// Comparison sets today against yesterday's recorded observations. Change is
+// today's forecast high minus yesterday's recorded high, or the current
+// temperature minus yesterday's average without a forecast.
+type Comparison struct {
+	Yesterday models.Aggregate
+	Change    float64
+}
+
+type SunTimes struct {
+	Sunrise *time.Time
+	Sunset  *time.Time
+}
+
+// PrecipitationOutlook lists when rain or snow is likely, in local time.
+type PrecipitationOutlook struct {
+	ChanceOfRain int
+	ChanceOfSnow int
+	Total        float64
+	Windows      []TimeWindow
+}
+
+// TimeWindow spans whole hours, To is the end of the last one.
+type TimeWindow struct {
+	From time.Time
+	To   time.Time
+}
+
+func (c DigestContent) Temperature(celsius float64) string {
+	if c.Subscription.Units == models.Imperial {
+		return fmt.Sprintf("%.0f°F", celsius*9/5+32)
+	}
+	return fmt.Sprintf("%.0f°C", celsius)
+}
+
+// Difference phrases a temperature change, e.g. "3°C warmer".
+func (c DigestContent) Difference(celsius float64) string {
+	unit, delta := "°C", celsius
+	if c.Subscription.Units == models.Imperial {
+		unit, delta = "°F", celsius*9/5
+	}
+
+	rounded := math.Round(delta)
+	switch {
+	case rounded > 0:
+		return fmt.Sprintf("%.0f%s warmer", rounded, unit)
+	case rounded < 0:
+		return fmt.Sprintf("%.0f%s colder", -rounded, unit)
+	default:
+		return "about as warm"
+	}
+}
+
+// Section fills one part of content from report and leaves it out when the
+// report lacks the data.
+type Section func(content *DigestContent, report CityReport)
+
+// ContentBuilder composes a digest from sections, applied in order so later
+// ones such as advice can read what earlier ones filled in.
+type ContentBuilder struct {
+	sections []Section
+}
+
+func NewContentBuilder(sections ...Section) *ContentBuilder {
+	return &ContentBuilder{sections: sections}
+}
+
+func (b *ContentBuilder) Build(sub models.Subscription, report CityReport) DigestContent {
+	content := DigestContent{Subscription: sub, Current: report.Current}
+	for _, section := range b.sections {
+		section(&content, report)
+	}
+	return content
+}
+
+// DailySections make up the default daily digest.
+func DailySections() []Section {
+	return []Section{TodaySection, ComparisonSection, SunSection, PrecipitationSection, AirQualitySection, AdviceSection(DefaultAdvice...)}
+}
+
+// HourlySections make up the default hourly digest.
+func HourlySections() []Section {
+	return []Section{AirQualitySection}
+}
+
+func TodaySection(content *DigestContent, report CityReport) {
+	if f := report.Forecast; f != nil {
+		content.Today = &DaySummary{Condition: f.Condition, Min: f.MinTemperature, Max: f.MaxTemperature}
+	}
+}
+
+func ComparisonSection(content *DigestContent, report CityReport) {
+	if report.Yesterday == nil || report.Yesterday.Count == 0 {
+		return
+	}
+
+	yesterday := report.Yesterday.Temperature
+	change := float64(report.Current.Temperature) - yesterday.Avg
+	if report.Forecast != nil {
+		change = report.Forecast.MaxTemperature - yesterday.Max
+	}
+	content.Comparison = &Comparison{Yesterday: yesterday, Change: change}
+}
+
+func SunSection(content *DigestContent, report CityReport) {
+	if f := report.Forecast; f != nil && (f.Sunrise != nil || f.Sunset != nil) {
+		content.Sun = &SunTimes{Sunrise: f.Sunrise, Sunset: f.Sunset}
+	}
+}
+
+// PrecipitationSection groups consecutive wet hours into windows.
+func PrecipitationSection(content *DigestContent, report CityReport) {
+	f := report.Forecast
+	if f == nil {
+		return
+	}
+
+	outlook := &PrecipitationOutlook{ChanceOfRain: f.ChanceOfRain, ChanceOfSnow: f.ChanceOfSnow, Total: f.Precipitation}
+	for _, hour := range f.Hours {
+		if hour.ChanceOfRain < wetChance && hour.ChanceOfSnow < wetChance {
+			continue
+		}
+		end := hour.Time.Add(time.Hour)
+		if n := len(outlook.Windows); n > 0 && outlook.Windows[n-1].To.Equal(hour.Time) {
+			outlook.Windows[n-1].To = end
+			continue
+		}
+		outlook.Windows = append(outlook.Windows, TimeWindow{From: hour.Time, To: end})
+	}
+	content.Precipitation = outlook
+}
+
+// AirQualitySection reports the current air quality when the provider sent it.
+func AirQualitySection(content *DigestContent, report CityReport) {
+	content.AirQuality = report.Current.AirQuality
+}
+
+// AdviceRule suggests something based on the content built so far.
+type AdviceRule func(content DigestContent) (string, bool)
+
+// DefaultAdvice covers rain, snow, frost, heat, sharp changes and poor air.
+var DefaultAdvice = []AdviceRule{UmbrellaAdvice, SnowAdvice, FrostAdvice, HeatAdvice, ChangeAdvice, AirQualityAdvice}
+
+func AdviceSection(rules ...AdviceRule) Section {
+	return func(content *DigestContent, _ CityReport) {
+		for _, rule := range rules {
+			if advice, ok := rule(*content); ok {
+				content.Advice = append(content.Advice, advice)
+			}
+		}
+	}
+}
+
+func UmbrellaAdvice(c DigestContent) (string, bool) {
+	p := c.Precipitation
+	if p == nil || p.ChanceOfRain < wetChance {
+		return "", false
+	}
+	if len(p.Windows) > 0 {
+		return "Take an umbrella, rain is likely from " + p.Windows[0].From.Format("15:04") + ".", true
+	}
+	return "Take an umbrella, rain is likely today.", true
+}
+
+func SnowAdvice(c DigestContent) (string, bool) {
+	if c.Precipitation == nil || c.Precipitation.ChanceOfSnow < wetChance {
+		return "", false
+	}
+	return "Snow is likely, allow extra time for travel.", true
+}
+
+func FrostAdvice(c DigestContent) (string, bool) {
+	if c.Today == nil || c.Today.Min > 0 {
+		return "", false
+	}
+	return "Frost warning: temperatures drop to " + c.Temperature(c.Today.Min) + ", watch for ice.", true
+}
+
+func HeatAdvice(c DigestContent) (string, bool) {
+	if c.Today == nil || c.Today.Max < 30 {
+		return "", false
+	}
+	return "Hot day ahead with up to " + c.Temperature(c.Today.Max) + ", stay hydrated.", true
+}
+
+func ChangeAdvice(c DigestContent) (string, bool) {
+	if c.Comparison == nil || math.Abs(c.Comparison.Change) < 8 {
+		return "", false
+	}
+	if c.Comparison.Change < 0 {
+		return "Much colder than yesterday, dress warmly.", true
+	}
+	return "Much warmer than yesterday, dress lighter.", true
+}
+
+// AirQualityAdvice speaks up from "unhealthy for sensitive groups" on.
+func AirQualityAdvice(c DigestContent) (string, bool) {
+	if c.AirQuality == nil || c.AirQuality.USEPAIndex < 3 {
+		return "", false
+	}
+	if c.AirQuality.USEPAIndex == 3 {
+		return "Air quality is poor for sensitive groups, keep your inhaler at hand.", true
+	}
+	return "Air quality is " + c.AirQuality.Category() + ", limit time outdoors.", true
+}
+
+// renderDigest renders content with the digest template.
+func renderDigest(content DigestContent) (string, error) {
+	var b strings.Builder
+	if err := digestTemplate.Execute(&b, content); err != nil {
+		return "", fmt.Errorf("render digest: %w", err)
+	}
+	return b.String(), nil
+}
+
+// RenderDigestBody renders content without the email greeting, for channels
+// that deliver digests as chat messages.
+func RenderDigestBody(content DigestContent) (string, error) {
+	var b strings.Builder
+	if err := digestBodyTemplate.Execute(&b, content); err != nil {
+		return "", fmt.Errorf("render digest: %w", err)
+	}
+	return b.String(), nil
+}
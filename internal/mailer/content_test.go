@@ -0,0 +1,170 @@
+package mailer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"weather/internal/clock"
+	"weather/internal/models"
+	"weather/internal/weather"
+)
+
+func fullReport() CityReport {
+	day := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	sunrise, sunset := day.Add(7*time.Hour+12*time.Minute), day.Add(17*time.Hour+48*time.Minute)
+	return CityReport{
+		Current: models.Weather{
+			Temperature:  5,
+			TemperatureF: 41,
+			Humidity:     80,
+			Description:  "Light rain",
+			AirQuality:   &models.AirQuality{USEPAIndex: 4},
+		},
+		Forecast: &models.Forecast{
+			Condition:      "Rain",
+			MinTemperature: 2,
+			MaxTemperature: 9,
+			ChanceOfRain:   80,
+			ChanceOfSnow:   60,
+			Precipitation:  4.5,
+			Sunrise:        &sunrise,
+			Sunset:         &sunset,
+			Hours: []models.ForecastHour{
+				{Time: day.Add(9 * time.Hour), ChanceOfRain: 70},
+				{Time: day.Add(10 * time.Hour), ChanceOfRain: 60},
+				{Time: day.Add(11 * time.Hour), ChanceOfRain: 10},
+				{Time: day.Add(15 * time.Hour), ChanceOfSnow: 55},
+			},
+		},
+		Yesterday: &models.ObservationBucket{Count: 24, Temperature: models.Aggregate{Min: 10, Max: 18, Avg: 14}},
+	}
+}
+
+func TestDailyContent(t *testing.T) {
+	sub := models.Subscription{City: "Kyiv", Units: models.Metric}
+	content := NewContentBuilder(DailySections()...).Build(sub, fullReport())
+
+	if content.Today == nil || content.Today.Min != 2 || content.Today.Max != 9 {
+		t.Errorf("got today %+v, want 2 to 9", content.Today)
+	}
+	if content.Comparison == nil || content.Comparison.Change != -9 {
+		t.Errorf("got comparison %+v, want the forecast high 9 below yesterday's", content.Comparison)
+	}
+	if content.Sun == nil || content.Sun.Sunrise == nil || content.Sun.Sunset == nil {
+		t.Errorf("got sun %+v, want sunrise and sunset", content.Sun)
+	}
+	if p := content.Precipitation; p == nil || len(p.Windows) != 2 {
+		t.Errorf("got precipitation %+v, want two wet windows", p)
+	}
+	if content.AirQuality == nil {
+		t.Errorf("got no air quality, want the current one")
+	}
+
+	body, err := RenderDigestBody(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Today: Rain, 2°C to 9°C",
+		"Compared with yesterday: 9°C colder (yesterday 10°C to 18°C)",
+		"Sunrise: 07:12, sunset: 17:48",
+		"Precipitation likely 09:00–11:00, 15:00–16:00, 4.5 mm in total",
+		"* Take an umbrella, rain is likely from 09:00.",
+		"* Snow is likely, allow extra time for travel.",
+		"* Much colder than yesterday, dress warmly.",
+		"limit time outdoors.",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("got body\n%s\nwant it to contain %q", body, want)
+		}
+	}
+}
+
+func TestHourlyContent(t *testing.T) {
+	sub := models.Subscription{City: "Kyiv", Units: models.Imperial}
+	content := NewContentBuilder(HourlySections()...).Build(sub, fullReport())
+
+	if content.Today != nil || content.Comparison != nil || content.Sun != nil || content.Precipitation != nil || content.Advice != nil {
+		t.Errorf("got %+v, want only the current weather and air quality", content)
+	}
+	if content.AirQuality == nil {
+		t.Errorf("got no air quality, want the current one")
+	}
+
+	body, err := RenderDigestBody(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body, "Temperature: 41°F") {
+		t.Errorf("got body\n%s\nwant the temperature in °F", body)
+	}
+	for _, unwanted := range []string{"Today:", "Compared with yesterday", "Sunrise", "Precipitation", "*"} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("got body\n%s\nwant no %q in an hourly digest", body, unwanted)
+		}
+	}
+}
+
+// currentOnly is a snapshot that polled the current weather but no forecast.
+type currentOnly struct{}
+
+func (currentOnly) Get(string) (models.Weather, bool) {
+	return models.Weather{Temperature: 5, Humidity: 80, Description: "Light rain"}, true
+}
+
+func (currentOnly) Forecast(string) (models.Forecast, bool) {
+	return models.Forecast{}, false
+}
+
+// noForecast is a provider whose forecasts fail.
+type noForecast struct {
+	weather.APIInterface
+	calls int
+}
+
+func (p *noForecast) GetCityForecast(string) (models.Forecast, error) {
+	p.calls++
+	return models.Forecast{}, errors.New("forecast unavailable")
+}
+
+func TestDailyContentWithoutForecast(t *testing.T) {
+	provider := &noForecast{}
+	m := &SmtpMailer{
+		Clock:          clock.NewFake(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)),
+		Snapshot:       currentOnly{},
+		WeatherService: weather.NewRemoteService(provider),
+	}
+
+	report, err := m.cityReport(dailyDigest, "Kyiv")
+	if err != nil {
+		t.Fatalf("got %v, want the digest to go out without a forecast", err)
+	}
+	if provider.calls != 1 || report.Forecast != nil {
+		t.Fatalf("got forecast %+v after %d provider calls, want none after one", report.Forecast, provider.calls)
+	}
+
+	sub := models.Subscription{City: "Kyiv", Units: models.Metric}
+	content := NewContentBuilder(DailySections()...).Build(sub, report)
+	if content.Today != nil || content.Sun != nil || content.Precipitation != nil || content.Advice != nil {
+		t.Errorf("got %+v, want the forecast sections left out", content)
+	}
+
+	body, err := RenderDigestBody(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body, "- Light rain") || strings.Contains(body, "Today:") || strings.Contains(body, "Precipitation") {
+		t.Errorf("got body\n%s\nwant the current weather only", body)
+	}
+}
+
+func TestHourlyReportSkipsForecast(t *testing.T) {
+	provider := &noForecast{}
+	m := &SmtpMailer{Snapshot: currentOnly{}, WeatherService: weather.NewRemoteService(provider)}
+
+	if _, err := m.cityReport(hourlyDigest, "Kyiv"); err != nil || provider.calls != 0 {
+		t.Errorf("got %v after %d forecast calls, want none for an hourly digest", err, provider.calls)
+	}
+}
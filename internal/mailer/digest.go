@@ -0,0 +1,286 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"weather/internal/models"
+)
+
+const defaultWorkers = 8
+
+var (
+	errAlreadySent     = errors.New("digest already sent for this window")
+	errWebhookDisabled = errors.New("webhook is disabled")
+	errNoChannel       = errors.New("delivery channel is not configured")
+)
+
+type digestKind struct {
+	frequency  string
+	title      string
+	timeLayout string
+}
+
+var (
+	dailyDigest  = digestKind{frequency: models.Daily, title: "Daily", timeLayout: "2006-01-02"}
+	hourlyDigest = digestKind{frequency: models.Hourly, title: "Hourly", timeLayout: "2006-01-02 15:04"}
+)
+
+// RunSummary counts what happened to each subscriber in one digest run.
+// Skipped covers inactive and suppressed subscribers, disabled webhooks,
+// channels that are not configured and those who already got the window,
+// Failed covers weather, store, SMTP, queueing and channel errors.
+type RunSummary struct {
+	Frequency string
+	Window    time.Time
+	Cities    int
+	Sent      int
+	Skipped   int
+	Failed    int
+	Duration  time.Duration
+}
+
+func (s RunSummary) String() string {
+	return fmt.Sprintf("%s digest: sent %d, skipped %d, failed %d across %d cities in %s",
+		s.Frequency, s.Sent, s.Skipped, s.Failed, s.Cities, s.Duration.Round(time.Millisecond))
+}
+
+type digestJob struct {
+	sub    models.Subscription
+	report CityReport
+}
+
+// runDigest builds the report once per distinct city and fans it out to that
+// city's subscribers.
+// Fetches and sends each run on at most Workers goroutines. Subscribers who
+// already got window are skipped.
+func (m *SmtpMailer) runDigest(kind digestKind, window time.Time) RunSummary {
+	started := m.Clock.Now()
+
+	m.mx.RLock()
+	subs := append([]models.Subscription(nil), m.targets[kind.frequency]...)
+	m.mx.RUnlock()
+
+	var (
+		summary = RunSummary{Frequency: kind.frequency, Window: window}
+		mx      sync.Mutex
+		batches = make(map[string][]models.Subscription)
+	)
+	for _, sub := range subs {
+		if !sub.Active() {
+			summary.Skipped++
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(sub.City))
+		batches[key] = append(batches[key], sub)
+	}
+	summary.Cities = len(batches)
+
+	workers := m.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+
+	cities := make(chan []models.Subscription)
+	jobs := make(chan digestJob)
+
+	var fetchers sync.WaitGroup
+	for range min(workers, len(batches)) {
+		fetchers.Add(1)
+		go func() {
+			defer fetchers.Done()
+			for batch := range cities {
+				report, err := m.cityReport(kind, batch[0].City)
+				if err != nil {
+					log.Printf("ERROR: cant get weather for %q: %v", batch[0].City, err)
+					mx.Lock()
+					summary.Failed += len(batch)
+					mx.Unlock()
+					continue
+				}
+				for _, sub := range batch {
+					jobs <- digestJob{sub: sub, report: report}
+				}
+			}
+		}()
+	}
+
+	var senders sync.WaitGroup
+	for range workers {
+		senders.Add(1)
+		go func() {
+			defer senders.Done()
+			for job := range jobs {
+				claimed, err := m.claim(kind, job.sub, window)
+				if err == nil && !claimed {
+					err = errAlreadySent
+				}
+				if err == nil {
+					err = m.sendDigest(kind, job, window)
+				}
+
+				mx.Lock()
+				switch {
+				case err == nil:
+					summary.Sent++
+				case errors.Is(err, ErrSuppressed), errors.Is(err, errAlreadySent), errors.Is(err, errWebhookDisabled), errors.Is(err, errNoChannel):
+					summary.Skipped++
+				default:
+					summary.Failed++
+					log.Printf("ERROR: cant send %s digest to %s: %v", kind.frequency, job.sub.Email, err)
+				}
+				mx.Unlock()
+			}
+		}()
+	}
+
+	for _, batch := range batches {
+		cities <- batch
+	}
+	close(cities)
+	fetchers.Wait()
+	close(jobs)
+	senders.Wait()
+
+	summary.Duration = m.Clock.Now().Sub(started)
+	log.Println(summary)
+
+	return summary
+}
+
+// cityReport gets the current weather and forecast, from the snapshot when it
+// has fresh ones. Daily digests also get today's forecast and yesterday's recorded
+// observations, without them the digest just leaves those parts out.
+func (m *SmtpMailer) cityReport(kind digestKind, city string) (CityReport, error) {
+	report := CityReport{}
+
+	var err error
+	if report.Current, err = m.cityWeather(city); err != nil {
+		return report, err
+	}
+	if kind.frequency != models.Daily {
+		return report, nil
+	}
+
+	if forecast, err := m.cityForecast(city); err != nil {
+		log.Printf("ERROR: cant get forecast for %q: %v", city, err)
+	} else {
+		report.Forecast = &forecast
+	}
+
+	if m.History != nil {
+		today := m.Clock.Now().UTC().Truncate(24 * time.Hour)
+		buckets, err := m.History.Aggregate(context.Background(), city, today.Add(-24*time.Hour), today, 24*time.Hour)
+		if err != nil {
+			log.Printf("ERROR: cant get yesterday's observations for %q: %v", city, err)
+		} else if len(buckets) > 0 {
+			report.Yesterday = &buckets[0]
+		}
+	}
+
+	return report, nil
+}
+
+func (m *SmtpMailer) cityWeather(city string) (models.Weather, error) {
+	if m.Snapshot != nil {
+		if weatherData, ok := m.Snapshot.Get(city); ok {
+			return weatherData, nil
+		}
+	}
+	return m.WeatherService.GetCityWeather(city)
+}
+
+func (m *SmtpMailer) cityForecast(city string) (models.Forecast, error) {
+	if m.Snapshot != nil {
+		if forecast, ok := m.Snapshot.Forecast(city); ok {
+			return forecast, nil
+		}
+	}
+	return m.WeatherService.GetCityForecast(city)
+}
+
+// sendDigest sends the digest of a claimed window by email or hands it to the
+// subscription's channel, releasing the claim when it could not be sent.
+func (m *SmtpMailer) sendDigest(kind digestKind, job digestJob, window time.Time) error {
+	var err error
+	job.sub, err = m.issueToken(job.sub)
+	if err == nil {
+		channel, ok := m.Channels[job.sub.DeliveryChannel()]
+		switch {
+		case ok:
+			err = m.sendChannel(kind, job, window, channel)
+		case job.sub.HasEmail():
+			err = m.sendEmail(kind, job, window)
+		default:
+			err = errNoChannel
+		}
+	}
+	if err != nil {
+		m.release(kind, job.sub, window)
+	}
+
+	return err
+}
+
+// issueToken replaces a token derived from the subscriber's email, which
+// opens none of the token links, and updates the schedule with the new one.
+func (m *SmtpMailer) issueToken(sub models.Subscription) (models.Subscription, error) {
+	if m.Tokens == nil || !sub.HasLegacyToken() {
+		return sub, nil
+	}
+
+	token, err := models.NewToken()
+	if err != nil {
+		return sub, err
+	}
+	updated, err := m.Tokens.ReplaceToken(context.Background(), sub.ID, sub.Token, token)
+	if err != nil {
+		return sub, fmt.Errorf("replace legacy token: %w", err)
+	}
+
+	m.SyncTarget(updated)
+	return updated, nil
+}
+
+func (m *SmtpMailer) sendEmail(kind digestKind, job digestJob, window time.Time) error {
+	body, err := renderDigest(m.content(kind, job))
+	if err != nil {
+		return err
+	}
+
+	msg := m.digestMessage(job.sub, kind.subject(job.sub, window), body)
+	msg.Headers["Message-ID"] = m.messageID(idempotencyKey(kind, job.sub, window))
+	return m.Send(msg)
+}
+
+func (m *SmtpMailer) sendChannel(kind digestKind, job digestJob, window time.Time, channel Channel) error {
+	if job.sub.DeliveryChannel() == models.ChannelWebhook && job.sub.WebhookDisabledAt != nil {
+		return errWebhookDisabled
+	}
+
+	return channel.SendDigest(context.Background(), Digest{
+		Subscription: job.sub,
+		Frequency:    kind.frequency,
+		Window:       window,
+		Subject:      kind.subject(job.sub, window),
+		Report:       job.report,
+		Content:      m.content(kind, job),
+	})
+}
+
+func (m *SmtpMailer) content(kind digestKind, job digestJob) DigestContent {
+	builder := m.HourlyContent
+	if kind.frequency == models.Daily {
+		builder = m.DailyContent
+	}
+	return builder.Build(job.sub, job.report)
+}
+
+func (k digestKind) subject(sub models.Subscription, window time.Time) string {
+	return fmt.Sprintf("%s Weather for %s – %s", k.title, sub.City, window.Format(k.timeLayout))
+}
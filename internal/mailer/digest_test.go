@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"weather/internal/clock"
+	"weather/internal/models"
+	"weather/internal/store"
+)
+
+// lastDigestChannel keeps the digest handed to it last.
+type lastDigestChannel struct {
+	digest Digest
+}
+
+func (c *lastDigestChannel) SendDigest(_ context.Context, digest Digest) error {
+	c.digest = digest
+	return nil
+}
+
+func TestSendDigestReplacesLegacyToken(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	m, _, _ := newTestMailer(start)
+	m.HourlyContent = NewContentBuilder(HourlySections()...)
+	channel := &lastDigestChannel{}
+	m.Channels = map[string]Channel{models.ChannelTelegram: channel}
+
+	storage := store.NewMemoryStorage(clock.NewFake(start))
+	m.Tokens = storage.Subscription
+
+	sub := chatSubscription(1, models.StatusPending)
+	sub.Units = models.Metric
+	sub.Token = models.LegacyToken(sub.Email)
+	if err := storage.Subscription.Create(ctx, &sub); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := storage.Subscription.ConfirmByID(ctx, sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddHourlyTarget(sub)
+
+	if err := m.sendDigest(hourlyDigest, digestJob{sub: sub}, start); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := channel.digest.Subscription
+	if sent.Token == sub.Token || sent.HasLegacyToken() {
+		t.Fatalf("digest went out with token %q, want a new random one", sent.Token)
+	}
+	if stored, err := storage.Subscription.GetByID(ctx, sub.ID); err != nil || stored.Token != sent.Token {
+		t.Errorf("stored token %q, %v, want the one in the digest %q", stored.Token, err, sent.Token)
+	}
+	if targets := m.targets[models.Hourly]; len(targets) != 1 || targets[0].Token != sent.Token {
+		t.Errorf("got targets %+v, want the subscription with its new token", targets)
+	}
+
+	// the footer links carry the new token
+	msg := m.digestMessage(sent, "subject", "body")
+	if want := m.ManageURL(sent); !strings.Contains(msg.Body, want) {
+		t.Errorf("got footer %q, want it to link %s", msg.Body, want)
+	}
+}
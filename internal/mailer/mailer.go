@@ -1,23 +1,101 @@
 package mailer
 
 import (
-	"crypto/tls"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"net/smtp"
 	"strings"
 	"sync"
 	"time"
 
+	"weather/internal/clock"
+	"weather/internal/config"
+	"weather/internal/lock"
 	"weather/internal/models"
+	"weather/internal/outbox"
+	"weather/internal/secrets"
 	"weather/internal/weather"
 )
 
+// ErrSuppressed is returned for recipients on the suppression list.
+var ErrSuppressed = errors.New("recipient is suppressed")
+
+// SuppressionList tells which addresses hard bounced or complained.
+type SuppressionList interface {
+	IsSuppressed(ctx context.Context, email string) (bool, error)
+}
+
+// TokenStore replaces the token of a subscription.
+type TokenStore interface {
+	ReplaceToken(ctx context.Context, id int64, old, replacement string) (models.Subscription, error)
+}
+
+// ObservationHistory aggregates recorded observations, e.g. yesterday's.
+type ObservationHistory interface {
+	Aggregate(ctx context.Context, city string, from, to time.Time, bucket time.Duration) ([]models.ObservationBucket, error)
+}
+
+// Digest is one subscriber's digest of a window, handed to a Channel.
+type Digest struct {
+	Subscription models.Subscription
+	Frequency    string
+	Window       time.Time
+	Subject      string
+	Report       CityReport
+	Content      DigestContent
+}
+
+// Channel delivers digests other than by email, e.g. to a webhook or a chat.
+type Channel interface {
+	SendDigest(ctx context.Context, digest Digest) error
+}
+
+// WeatherSnapshot serves recently polled weather and forecasts.
+type WeatherSnapshot interface {
+	Get(city string) (models.Weather, bool)
+	Forecast(city string) (models.Forecast, bool)
+}
+
 type SmtpMailer struct {
-	User           string
-	Password       string
-	Host           string
-	Port           string
+	User           *secrets.Secret
+	Password       *secrets.Secret
+	PublicURL      string
 	WeatherService *weather.RemoteService
+	// Snapshot is optional, when set digests use its readings and forecasts
+	// and only fetch cities it has none fresh for.
+	Snapshot WeatherSnapshot
+	// History is optional, when set daily digests compare with yesterday.
+	History ObservationHistory
+	// DailyContent and HourlyContent compose the digest bodies.
+	DailyContent  *ContentBuilder
+	HourlyContent *ContentBuilder
+	// Channels deliver the digests of subscriptions whose DeliveryChannel is
+	// their key. Webhook subscriptions without one fall back to email, so new
+	// webhooks are refused then, see HasChannel.
+	Channels map[string]Channel
+	// Suppressions is optional, when set suppressed recipients are never mailed.
+	Suppressions SuppressionList
+	// Tokens is optional, when set a subscription still holding the token
+	// derived from its email gets a random one with its next digest, and the
+	// digest links carry the new token.
+	Tokens TokenStore
+	// Workers bounds both concurrent weather fetches and concurrent sends of a digest run.
+	Workers int
+	// Schedule is optional, when set delivered windows are persisted so a
+	// restart can catch up a missed window without sending anyone two digests.
+	Schedule ScheduleStore
+	// CatchUpGrace is how late a missed window may still be delivered.
+	CatchUpGrace time.Duration
+	// Locker is optional, when set only the replica holding a schedule's
+	// lock delivers its window.
+	Locker lock.Locker
+	// Targets is optional, when set the schedule is reloaded before each window.
+	Targets TargetSource
+	// Clock drives the scheduler, tests swap in a fake one.
+	Clock clock.Clock
+
+	pool *pool
 
 	mx      sync.RWMutex
 	targets map[string][]models.Subscription
@@ -27,16 +105,26 @@ type SmtpMailer struct {
 	running  bool
 }
 
-func New(user, password, host, port string, weatherService *weather.RemoteService) *SmtpMailer {
+func New(cfg config.SMTPConfig, publicURL string, weatherService *weather.RemoteService) (*SmtpMailer, error) {
+	clk := clock.Real{}
+	pool, err := newPool(cfg, clk)
+	if err != nil {
+		return nil, err
+	}
+
 	return &SmtpMailer{
-		User:           user,
-		Password:       password,
-		Host:           host,
-		Port:           port,
+		User:           cfg.User,
+		Password:       cfg.Password,
+		PublicURL:      strings.TrimRight(publicURL, "/"),
 		WeatherService: weatherService,
+		DailyContent:   NewContentBuilder(DailySections()...),
+		HourlyContent:  NewContentBuilder(HourlySections()...),
+		pool:           pool,
+		Clock:          clk,
+		Channels:       make(map[string]Channel),
 		targets:        make(map[string][]models.Subscription),
 		stopChan:       make(chan struct{}),
-	}
+	}, nil
 }
 
 func (m *SmtpMailer) AddDailyTarget(sub models.Subscription) {
@@ -67,30 +155,63 @@ func (m *SmtpMailer) RemoveDailyTarget(email string) {
 	m.mx.Lock()
 	defer m.mx.Unlock()
 
-	subs := m.targets["daily"]
-	for i, sub := range subs {
-		if sub.Email == email {
-			subs[i] = subs[len(subs)-1]
-			m.targets["daily"] = subs[:len(subs)-1]
-			return
-		}
-	}
+	m.removeTarget("daily", email)
 }
 
 func (m *SmtpMailer) RemoveHourlyTarget(email string) {
 	m.mx.Lock()
 	defer m.mx.Unlock()
 
-	subs := m.targets["hourly"]
+	m.removeTarget("hourly", email)
+}
+
+// SyncTarget puts sub on the schedule matching its frequency, or takes it off
+// when it is not active, under one lock so a tick never sees it half moved.
+func (m *SmtpMailer) SyncTarget(sub models.Subscription) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.removeTarget("hourly", sub.Email)
+	m.removeTarget("daily", sub.Email)
+
+	if sub.Active() {
+		m.targets[sub.Frequency] = append(m.targets[sub.Frequency], sub)
+	}
+}
+
+// LoadTargets replaces the whole schedule, e.g. with the active
+// subscriptions from the database before a window is delivered.
+func (m *SmtpMailer) LoadTargets(subs []models.Subscription) {
+	targets := make(map[string][]models.Subscription)
+	for _, sub := range subs {
+		if sub.Active() {
+			targets[sub.Frequency] = append(targets[sub.Frequency], sub)
+		}
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.targets = targets
+}
+
+func (m *SmtpMailer) removeTarget(frequency, email string) {
+	subs := m.targets[frequency]
 	for i, sub := range subs {
 		if sub.Email == email {
 			subs[i] = subs[len(subs)-1]
-			m.targets["hourly"] = subs[:len(subs)-1]
+			m.targets[frequency] = subs[:len(subs)-1]
 			return
 		}
 	}
 }
 
+// HasChannel reports whether digests of the channel name are delivered on it
+// rather than by email.
+func (m *SmtpMailer) HasChannel(name string) bool {
+	_, ok := m.Channels[name]
+	return ok
+}
+
 func (m *SmtpMailer) Start() {
 	m.mx.Lock()
 	if m.running {
@@ -101,53 +222,13 @@ func (m *SmtpMailer) Start() {
 	m.stopChan = make(chan struct{})
 	m.mx.Unlock()
 
-	// Daily
-	m.wg.Add(1)
-	go func() {
-		defer m.wg.Done()
-		now := time.Now()
-		nextMidnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
-		select {
-		case <-time.After(nextMidnight.Sub(now)):
-		case <-m.stopChan:
-			return
-		}
-		m.sendDailyEmails()
-		ticker := time.NewTicker(24 * time.Hour)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				m.sendDailyEmails()
-			case <-m.stopChan:
-				return
-			}
-		}
-	}()
-
-	// Hourly
-	m.wg.Add(1)
-	go func() {
-		defer m.wg.Done()
-		now := time.Now()
-		nextHour := time.Date(now.Year(), now.Month(), now.Day(), now.Hour()+1, 0, 0, 0, now.Location())
-		select {
-		case <-time.After(nextHour.Sub(now)):
-		case <-m.stopChan:
-			return
-		}
-		m.sendHourlyEmails()
-		ticker := time.NewTicker(time.Hour)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				m.sendHourlyEmails()
-			case <-m.stopChan:
-				return
-			}
-		}
-	}()
+	for _, kind := range []digestKind{dailyDigest, hourlyDigest} {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.schedule(kind)
+		}()
+	}
 }
 
 func (m *SmtpMailer) Stop() {
@@ -160,107 +241,48 @@ func (m *SmtpMailer) Stop() {
 	close(m.stopChan)
 	m.mx.Unlock()
 	m.wg.Wait()
+	m.pool.close()
 }
 
-func (m *SmtpMailer) sendDailyEmails() {
-	m.mx.RLock()
-	subs := append([]models.Subscription(nil), m.targets["daily"]...)
-	m.mx.RUnlock()
-
-	for _, sub := range subs {
-		weatherData, err := m.WeatherService.GetCityWeather(sub.City)
-		if err != nil {
-			fmt.Printf("weather fetch error for %q: %v\n", sub.City, err)
-			continue
-		}
-		subject := fmt.Sprintf("Daily Weather for %s – %s", sub.City, time.Now().Format("2006-01-02"))
-		body := fmt.Sprintf(
-			"Hello %s,\n\nCurrent weather in %s:\n"+
-				"- %s\n- Temperature: %d°C\n- Humidity: %d%%\n",
-			sub.Email, sub.City,
-			weatherData.Description,
-			weatherData.Temperature,
-			weatherData.Humidity,
-		)
-
-		go func(email, subj, msg string) {
-			if err := m.SendEmail(email, subj, msg); err != nil {
-				fmt.Printf("daily email error to %s: %v\n", email, err)
-			}
-		}(sub.Email, subject, body)
-	}
+func (m *SmtpMailer) SendEmail(to, subject, body string) error {
+	return m.Send(Message{To: to, Subject: subject, Body: body})
 }
 
-func (m *SmtpMailer) sendHourlyEmails() {
-	m.mx.RLock()
-	subs := append([]models.Subscription(nil), m.targets["hourly"]...)
-	m.mx.RUnlock()
-
-	for _, sub := range subs {
-		weatherData, err := m.WeatherService.GetCityWeather(sub.City)
+func (m *SmtpMailer) Send(msg Message) error {
+	if m.Suppressions != nil {
+		suppressed, err := m.Suppressions.IsSuppressed(context.Background(), msg.To)
 		if err != nil {
-			fmt.Printf("weather fetch error for %q: %v\n", sub.City, err)
-			continue
+			return fmt.Errorf("check suppression: %w", err)
+		}
+		if suppressed {
+			return ErrSuppressed
 		}
-		subject := fmt.Sprintf("Hourly Weather for %s – %s", sub.City, time.Now().Format("2006-01-02 15:04"))
-		body := fmt.Sprintf(
-			"Hello %s,\n\nCurrent weather in %s:\n"+
-				"- %s\n- Temperature: %d°C\n- Humidity: %d%%\n",
-			sub.Email, sub.City,
-			weatherData.Description,
-			weatherData.Temperature,
-			weatherData.Humidity,
-		)
-
-		go func(email, subj, msg string) {
-			if err := m.SendEmail(email, subj, msg); err != nil {
-				fmt.Printf("hourly email error to %s: %v\n", email, err)
-			}
-		}(sub.Email, subject, body)
 	}
-}
-
-func (m *SmtpMailer) SendEmail(to, subject, body string) error {
-	var msg strings.Builder
-	msg.WriteString(fmt.Sprintf("From: %s\r\n", m.User))
-	msg.WriteString(fmt.Sprintf("To: %s\r\n", to))
-	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
-	msg.WriteString("\r\n")
-	msg.WriteString(body)
 
-	auth := smtp.PlainAuth("", m.User, m.Password, m.Host)
-	tlsConf := &tls.Config{InsecureSkipVerify: true, ServerName: m.Host}
+	// credentials are read once so a rotation never splits a single send
+	user, password := m.User.Get(), m.Password.Get()
 
-	conn, err := tls.Dial("tcp", fmt.Sprintf("%s:%s", m.Host, m.Port), tlsConf)
-	if err != nil {
-		return fmt.Errorf("connect SMTP: %w", err)
-	}
-	defer conn.Close()
+	return m.pool.send(user, password, msg.To, msg.bytes(user))
+}
 
-	client, err := smtp.NewClient(conn, m.Host)
-	if err != nil {
-		return fmt.Errorf("new SMTP client: %w", err)
-	}
-	defer client.Quit()
+// OutboxTopic is the topic of a Message queued with outbox.Add.
+const OutboxTopic = "email"
 
-	if err := client.Auth(auth); err != nil {
-		return fmt.Errorf("SMTP auth: %w", err)
-	}
-	if err := client.Mail(m.User); err != nil {
-		return fmt.Errorf("set sender: %w", err)
-	}
-	if err := client.Rcpt(to); err != nil {
-		return fmt.Errorf("set recipient: %w", err)
-	}
+// HandleOutbox makes relay send the messages queued under OutboxTopic.
+func (m *SmtpMailer) HandleOutbox(relay *outbox.Relay) {
+	relay.Handle(OutboxTopic, m.SendQueued)
+}
 
-	wc, err := client.Data()
-	if err != nil {
-		return fmt.Errorf("get data writer: %w", err)
+// SendQueued is the outbox handler of OutboxTopic.
+func (m *SmtpMailer) SendQueued(_ context.Context, payload json.RawMessage) error {
+	var msg Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return outbox.Permanent(fmt.Errorf("decode queued message: %w", err))
 	}
-	defer wc.Close()
 
-	if _, err := wc.Write([]byte(msg.String())); err != nil {
-		return fmt.Errorf("write email body: %w", err)
+	err := m.Send(msg)
+	if errors.Is(err, ErrSuppressed) {
+		return outbox.Permanent(err)
 	}
-	return nil
+	return err
 }
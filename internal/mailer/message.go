@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"weather/internal/models"
+)
+
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	// Headers are extra header fields, e.g. List-Unsubscribe.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+func (msg Message) bytes(from string) []byte {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("From: %s\r\n", from))
+	b.WriteString(fmt.Sprintf("To: %s\r\n", msg.To))
+	b.WriteString(fmt.Sprintf("Subject: %s\r\n", msg.Subject))
+	b.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+
+	keys := make([]string, 0, len(msg.Headers))
+	for key := range msg.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b.WriteString(fmt.Sprintf("%s: %s\r\n", key, msg.Headers[key]))
+	}
+
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
+
+// UnsubscribeURL is the per-subscriber link used both in the digest footer and
+// in the List-Unsubscribe header; POSTing to it unsubscribes in one click.
+func (m *SmtpMailer) UnsubscribeURL(sub models.Subscription) string {
+	return m.PublicURL + "/api/unsubscribe/" + sub.Token
+}
+
+func (m *SmtpMailer) ManageURL(sub models.Subscription) string {
+	return m.PublicURL + "/manage/" + sub.Token
+}
+
+// messageID builds a Message-ID in the domain of PublicURL.
+func (m *SmtpMailer) messageID(local string) string {
+	host := "localhost"
+	if u, err := url.Parse(m.PublicURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	return "<" + local + "@" + host + ">"
+}
+
+// digestMessage wraps a digest body with the unsubscribe footer and the
+// RFC 8058 one-click unsubscribe headers required by bulk mail receivers.
+func (m *SmtpMailer) digestMessage(sub models.Subscription, subject, body string) Message {
+	unsubscribeURL := m.UnsubscribeURL(sub)
+
+	body += fmt.Sprintf(
+		"\n--\nManage your subscription: %s\nUnsubscribe: %s\n",
+		m.ManageURL(sub),
+		unsubscribeURL,
+	)
+
+	return Message{
+		To:      sub.Email,
+		Subject: subject,
+		Body:    body,
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}
+}
@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"weather/internal/models"
+	"weather/internal/outbox"
+	"weather/internal/store"
+)
+
+// ResumeExpired puts subscribers whose pause ended back on their schedule
+// and lets them know the digests are coming again. The notices are queued in
+// the transaction that resumes the subscriptions, so none is lost to a
+// shutdown or an SMTP error once the resume is committed.
+func (m *SmtpMailer) ResumeExpired(ctx context.Context, storage store.Storage) error {
+	var subs []models.Subscription
+	err := storage.WithTx(ctx, func(tx store.Storage) error {
+		var err error
+		subs, err = tx.Subscription.ResumeExpired(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, sub := range subs {
+			if !sub.HasEmail() {
+				continue
+			}
+
+			subject := fmt.Sprintf("Your %s weather digest for %s is back", sub.Frequency, sub.City)
+			body := fmt.Sprintf(
+				"Hello %s,\n\nYour pause has ended and your %s weather updates for %s are resuming.\n",
+				sub.Email, sub.Frequency, sub.City,
+			)
+			if err := outbox.Add(ctx, tx.Outbox, OutboxTopic, m.digestMessage(sub, subject, body)); err != nil {
+				return fmt.Errorf("queue pause notice to %s: %w", sub.Email, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		m.SyncTarget(sub)
+	}
+
+	return nil
+}
@@ -0,0 +1,278 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sync"
+	"time"
+
+	"weather/internal/clock"
+	"weather/internal/config"
+)
+
+const (
+	SecurityTLS      = "tls"
+	SecurityStartTLS = "starttls"
+	SecurityNone     = "none"
+
+	dialTimeout = 10 * time.Second
+	// defaultTimeout bounds one SMTP transaction when SMTPConfig.Timeout is unset.
+	defaultTimeout = 30 * time.Second
+)
+
+// pool keeps authenticated SMTP sessions open between messages. A session is
+// reused after RSET; one that saw a network error is thrown away.
+type pool struct {
+	cfg       config.SMTPConfig
+	tlsConfig *tls.Config
+	clock     clock.Clock
+
+	sem chan struct{}
+
+	mx   sync.Mutex
+	idle []*session
+}
+
+type session struct {
+	client *smtp.Client
+	// conn is the connection under client, deadlines set on it also hold
+	// for a TLS session started on top.
+	conn     net.Conn
+	user     string
+	password string
+	sent     int
+	lastUsed time.Time
+}
+
+func newPool(cfg config.SMTPConfig, clk clock.Clock) (*pool, error) {
+	switch cfg.Security {
+	case SecurityTLS, SecurityStartTLS, SecurityNone:
+	default:
+		return nil, fmt.Errorf("unknown SMTP security mode %q", cfg.Security)
+	}
+
+	tlsConfig, err := newTLSConfig(cfg.Host, cfg.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pool{
+		cfg:       cfg,
+		tlsConfig: tlsConfig,
+		clock:     clk,
+		sem:       make(chan struct{}, max(cfg.PoolSize, 1)),
+	}, nil
+}
+
+func newTLSConfig(host, caFile string) (*tls.Config, error) {
+	conf := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return conf, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read SMTP CA file: %w", err)
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in SMTP CA file %s", caFile)
+	}
+	conf.RootCAs = roots
+
+	return conf, nil
+}
+
+// send delivers raw to one recipient over a pooled session, waiting for a
+// free slot when PoolSize sessions are busy.
+func (p *pool) send(user, password, to string, raw []byte) error {
+	p.sem <- struct{}{}
+	defer func() { <-p.sem }()
+
+	s, err := p.get(user, password)
+	if err != nil {
+		return err
+	}
+
+	err = p.extend(s.conn)
+	if err == nil {
+		err = s.deliver(user, to, raw)
+	}
+	s.sent++
+	s.lastUsed = p.clock.Now()
+
+	var protoErr *textproto.Error
+	if err == nil || errors.As(err, &protoErr) {
+		// the server answered, so the session is still in sync
+		p.put(s)
+	} else {
+		s.client.Close()
+	}
+
+	return err
+}
+
+func (s *session) deliver(from, to string, raw []byte) error {
+	if err := s.client.Mail(from); err != nil {
+		return fmt.Errorf("set sender: %w", err)
+	}
+	if err := s.client.Rcpt(to); err != nil {
+		return fmt.Errorf("set recipient: %w", err)
+	}
+
+	wc, err := s.client.Data()
+	if err != nil {
+		return fmt.Errorf("get data writer: %w", err)
+	}
+	if _, err := wc.Write(raw); err != nil {
+		wc.Close()
+		return fmt.Errorf("write email body: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("finish email body: %w", err)
+	}
+	return nil
+}
+
+// get hands out an idle session reset with RSET, or dials a new one. Sessions
+// opened with rotated credentials are not reused.
+func (p *pool) get(user, password string) (*session, error) {
+	for {
+		p.mx.Lock()
+		if len(p.idle) == 0 {
+			p.mx.Unlock()
+			break
+		}
+		s := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mx.Unlock()
+
+		if s.user != user || s.password != password || p.expired(s) {
+			p.quit(s)
+			continue
+		}
+		if err := p.extend(s.conn); err != nil {
+			s.client.Close()
+			continue
+		}
+		if err := s.client.Reset(); err != nil {
+			s.client.Close()
+			continue
+		}
+		return s, nil
+	}
+
+	client, conn, err := p.dial(user, password)
+	if err != nil {
+		return nil, err
+	}
+	return &session{client: client, conn: conn, user: user, password: password}, nil
+}
+
+func (p *pool) put(s *session) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if p.cfg.MaxPerConn > 0 && s.sent >= p.cfg.MaxPerConn {
+		go p.quit(s)
+		return
+	}
+	p.idle = append(p.idle, s)
+}
+
+func (p *pool) expired(s *session) bool {
+	return p.cfg.IdleTimeout > 0 && p.clock.Now().Sub(s.lastUsed) > p.cfg.IdleTimeout
+}
+
+// extend gives conn Timeout for the next transaction, so a stalled server
+// fails the send instead of holding its pool slot forever. Deadlines are
+// wall-clock time, whatever clock the pool runs on.
+func (p *pool) extend(conn net.Conn) error {
+	timeout := p.cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return conn.SetDeadline(time.Now().Add(timeout))
+}
+
+func (p *pool) dial(user, password string) (*smtp.Client, net.Conn, error) {
+	addr := net.JoinHostPort(p.cfg.Host, p.cfg.Port)
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if p.cfg.Security == SecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, p.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect SMTP: %w", err)
+	}
+	// the greeting, STARTTLS and AUTH are one transaction
+	if err := p.extend(conn); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("set SMTP deadline: %w", err)
+	}
+
+	client, err := smtp.NewClient(conn, p.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("new SMTP client: %w", err)
+	}
+
+	if p.cfg.Security == SecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, nil, errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(p.tlsConfig); err != nil {
+			client.Close()
+			return nil, nil, fmt.Errorf("SMTP STARTTLS: %w", err)
+		}
+	}
+
+	// local relays usually accept mail without AUTH
+	if ok, _ := client.Extension("AUTH"); ok && password != "" {
+		if err := client.Auth(smtp.PlainAuth("", user, password, p.cfg.Host)); err != nil {
+			client.Close()
+			return nil, nil, fmt.Errorf("SMTP auth: %w", err)
+		}
+	}
+
+	return client, conn, nil
+}
+
+func (p *pool) quit(s *session) {
+	if err := p.extend(s.conn); err != nil {
+		s.client.Close()
+		return
+	}
+	if err := s.client.Quit(); err != nil {
+		s.client.Close()
+	}
+}
+
+// close ends every idle session. The pool stays usable, e.g. for
+// confirmation emails sent while the server drains.
+func (p *pool) close() {
+	p.mx.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mx.Unlock()
+
+	for _, s := range idle {
+		p.quit(s)
+	}
+}
@@ -0,0 +1,242 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"weather/internal/clock"
+	"weather/internal/config"
+	"weather/internal/mailer/smtptest"
+)
+
+func newTestPool(t *testing.T, server *smtptest.Server, security string) *pool {
+	t.Helper()
+
+	cfg := config.SMTPConfig{Host: server.Host, Port: server.Port, Security: security, PoolSize: 1}
+	if pem := server.CertPEM(); pem != nil {
+		cfg.CAFile = filepath.Join(t.TempDir(), "ca.pem")
+		if err := os.WriteFile(cfg.CAFile, pem, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := newPool(cfg, clock.Real{})
+	if err != nil {
+		t.Fatalf("newPool: %v", err)
+	}
+	t.Cleanup(p.close)
+
+	return p
+}
+
+func sendTest(t *testing.T, p *pool, user, password, to string) error {
+	t.Helper()
+
+	msg := Message{To: to, Subject: "Test", Body: "Hello " + to}
+	return p.send(user, password, to, msg.bytes(user))
+}
+
+func startServer(t *testing.T, start func() (*smtptest.Server, error)) *smtptest.Server {
+	t.Helper()
+
+	server, err := start()
+	if err != nil {
+		t.Fatalf("start smtp server: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestPoolStartTLSWithCustomCA(t *testing.T) {
+	server := startServer(t, smtptest.NewStartTLSServer)
+	server.SetAuth("user", "secret")
+	p := newTestPool(t, server, SecurityStartTLS)
+
+	if err := sendTest(t, p, "user", "secret", "a@example.com"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 || messages[0].From != "user" || messages[0].To[0] != "a@example.com" {
+		t.Fatalf("got messages %+v, want one from user to a@example.com", messages)
+	}
+	if !strings.Contains(messages[0].Data, "Subject: Test") {
+		t.Errorf("got data %q, want the subject header", messages[0].Data)
+	}
+}
+
+func TestPoolStartTLSRejectsUnknownCA(t *testing.T) {
+	server := startServer(t, smtptest.NewStartTLSServer)
+
+	p, err := newPool(config.SMTPConfig{Host: server.Host, Port: server.Port, Security: SecurityStartTLS, PoolSize: 1}, clock.Real{})
+	if err != nil {
+		t.Fatalf("newPool: %v", err)
+	}
+
+	if err := sendTest(t, p, "user", "secret", "a@example.com"); err == nil {
+		t.Fatal("send: got no error, want the self-signed certificate refused")
+	}
+	if n := len(server.Messages()); n != 0 {
+		t.Errorf("got %d messages, want none", n)
+	}
+}
+
+func TestPoolImplicitTLS(t *testing.T) {
+	server := startServer(t, smtptest.NewTLSServer)
+	server.SetAuth("user", "secret")
+	p := newTestPool(t, server, SecurityTLS)
+
+	if err := sendTest(t, p, "user", "secret", "a@example.com"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if n := len(server.Messages()); n != 1 {
+		t.Errorf("got %d messages, want 1", n)
+	}
+}
+
+func TestPoolPlaintextWithoutAuth(t *testing.T) {
+	server := startServer(t, smtptest.NewServer)
+	p := newTestPool(t, server, SecurityNone)
+
+	// the relay offers no AUTH, so the credentials are not used
+	if err := sendTest(t, p, "user", "secret", "a@example.com"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if n := len(server.Messages()); n != 1 {
+		t.Errorf("got %d messages, want 1", n)
+	}
+}
+
+func TestPoolReusesSessionWithReset(t *testing.T) {
+	server := startServer(t, smtptest.NewStartTLSServer)
+	server.SetAuth("user", "secret")
+	p := newTestPool(t, server, SecurityStartTLS)
+
+	for i := range 5 {
+		if err := sendTest(t, p, "user", "secret", "a@example.com"); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+
+	if got := server.Sessions(); got != 1 {
+		t.Errorf("got %d sessions, want 1", got)
+	}
+	if got := server.Resets(); got != 4 {
+		t.Errorf("got %d resets, want 4", got)
+	}
+	if got := len(server.Messages()); got != 5 {
+		t.Errorf("got %d messages, want 5", got)
+	}
+}
+
+func TestPoolRejectedRecipientKeepsSession(t *testing.T) {
+	server := startServer(t, smtptest.NewServer)
+	server.Reject("gone@example.com")
+	p := newTestPool(t, server, SecurityNone)
+
+	if err := sendTest(t, p, "user", "", "gone@example.com"); err == nil {
+		t.Fatal("send to rejected recipient: got no error")
+	}
+	if err := sendTest(t, p, "user", "", "a@example.com"); err != nil {
+		t.Fatalf("send after rejection: %v", err)
+	}
+
+	if got := server.Sessions(); got != 1 {
+		t.Errorf("got %d sessions, want the session kept after the 550", got)
+	}
+	messages := server.Messages()
+	if len(messages) != 1 || messages[0].To[0] != "a@example.com" {
+		t.Errorf("got messages %+v, want only the one to a@example.com", messages)
+	}
+}
+
+func TestPoolDropsSessionsAfterCredentialRotation(t *testing.T) {
+	server := startServer(t, smtptest.NewServer)
+	server.SetAuth("user", "old")
+	p := newTestPool(t, server, SecurityNone)
+
+	if err := sendTest(t, p, "user", "old", "a@example.com"); err != nil {
+		t.Fatalf("send with old password: %v", err)
+	}
+	// the relay takes the new password, the pooled session still has the old one
+	server.SetAuth("user", "new")
+	if err := sendTest(t, p, "user", "new", "a@example.com"); err != nil {
+		t.Fatalf("send with new password: %v", err)
+	}
+	if err := sendTest(t, p, "user", "new", "a@example.com"); err != nil {
+		t.Fatalf("send again with new password: %v", err)
+	}
+
+	if got := server.Sessions(); got != 2 {
+		t.Errorf("got %d sessions, want a new one for the rotated password only", got)
+	}
+	if got := server.Resets(); got != 1 {
+		t.Errorf("got %d resets, want the new session reused once", got)
+	}
+}
+
+func TestPoolRedialsAfterIdleTimeout(t *testing.T) {
+	server := startServer(t, smtptest.NewServer)
+	fake := clock.NewFake(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	cfg := config.SMTPConfig{Host: server.Host, Port: server.Port, Security: SecurityNone, PoolSize: 1, IdleTimeout: time.Minute}
+	p, err := newPool(cfg, fake)
+	if err != nil {
+		t.Fatalf("newPool: %v", err)
+	}
+	t.Cleanup(p.close)
+
+	for i, idle := range []time.Duration{0, 30 * time.Second, 2 * time.Minute} {
+		fake.Advance(idle)
+		if err := sendTest(t, p, "user", "", "a@example.com"); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+
+	if got := server.Sessions(); got != 2 {
+		t.Errorf("got %d sessions, want a new one only after the idle timeout", got)
+	}
+}
+
+func TestPoolTimesOutStalledServer(t *testing.T) {
+	for _, verb := range []string{"EHLO", "MAIL", "DATA", "RSET"} {
+		t.Run(verb, func(t *testing.T) {
+			server := startServer(t, smtptest.NewServer)
+			cfg := config.SMTPConfig{Host: server.Host, Port: server.Port, Security: SecurityNone, PoolSize: 1, Timeout: 100 * time.Millisecond}
+			p, err := newPool(cfg, clock.Real{})
+			if err != nil {
+				t.Fatalf("newPool: %v", err)
+			}
+			t.Cleanup(p.close)
+
+			if verb == "RSET" {
+				// RSET only goes out when a pooled session is reused
+				if err := sendTest(t, p, "user", "", "a@example.com"); err != nil {
+					t.Fatalf("send before stall: %v", err)
+				}
+			}
+
+			server.Stall(verb)
+			done := make(chan error, 1)
+			go func() { done <- sendTest(t, p, "user", "", "b@example.com") }()
+			select {
+			case err := <-done:
+				// a stalled RSET only costs the session, the send redials
+				if (err == nil) != (verb == "RSET") {
+					t.Fatalf("send to a server stalled on %s: got error %v", verb, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("send to a server stalled on %s did not time out", verb)
+			}
+
+			// the stalled send gave its pool slot back
+			server.Stall("")
+			if err := sendTest(t, p, "user", "", "c@example.com"); err != nil {
+				t.Fatalf("send after stall: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"weather/internal/models"
+	"weather/internal/store"
+)
+
+const (
+	// schedulePoll bounds how long the scheduler sleeps, so a window is
+	// noticed soon after the host wakes up or the wall clock jumps.
+	schedulePoll = time.Minute
+	// onTimeSlack is how late a window still counts as on time rather than
+	// a catch-up.
+	onTimeSlack = 5 * time.Minute
+	// scheduleMinSleep keeps the scheduler from spinning should the next
+	// window ever compute as not in the future.
+	scheduleMinSleep = time.Second
+)
+
+// ScheduleStore persists delivered windows per schedule and per subscription.
+type ScheduleStore interface {
+	LastRun(ctx context.Context, frequency string) (models.ScheduleRun, error)
+	RecordRun(ctx context.Context, run models.ScheduleRun) error
+	ClaimDigest(ctx context.Context, key string, id int64, window time.Time) (bool, error)
+	ReleaseDigest(ctx context.Context, key string, id int64, window time.Time) error
+}
+
+// TargetSource lists the subscriptions digests go to.
+type TargetSource interface {
+	ListActive(ctx context.Context) ([]models.Subscription, error)
+}
+
+// window is the wall-clock slot t falls in. Daily slots are computed with
+// time.Date so they start at local midnight across DST changes. Hourly slots
+// go back from t by the wall-clock minutes instead: time.Date picks the first
+// of the two 01:00 in a fall-back hour, which would put 01:30 EST in the
+// 01:00 EDT slot and its next slot in the past.
+func (k digestKind) window(t time.Time) time.Time {
+	if k.frequency == models.Daily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return t.Add(-time.Duration(t.Minute())*time.Minute -
+		time.Duration(t.Second())*time.Second -
+		time.Duration(t.Nanosecond()))
+}
+
+func (k digestKind) next(t time.Time) time.Time {
+	w := k.window(t)
+	if k.frequency == models.Daily {
+		return time.Date(w.Year(), w.Month(), w.Day()+1, 0, 0, 0, 0, w.Location())
+	}
+	return w.Add(time.Hour)
+}
+
+func (m *SmtpMailer) schedule(kind digestKind) {
+	done := m.lastWindow(kind)
+
+	for {
+		// Round(0) drops the monotonic reading, sleep does not advance it
+		now := m.Clock.Now().Round(0)
+
+		if w := kind.window(now); w.After(done) {
+			late := now.Sub(w)
+			if late > max(onTimeSlack, m.CatchUpGrace) {
+				log.Printf("missed %s digest window %s, %s late", kind.frequency, w.Format(time.RFC3339), late.Round(time.Second))
+				done = w
+			} else if m.runWindow(kind, w, late) {
+				done = w
+			}
+		}
+
+		sleep := min(max(kind.next(now).Sub(now), scheduleMinSleep), schedulePoll)
+		select {
+		case <-m.Clock.After(sleep):
+		case <-m.stopChan:
+			return
+		}
+	}
+}
+
+// lastWindow is the last delivered window. Without history the current
+// window counts as done so a first start never sends out of schedule.
+func (m *SmtpMailer) lastWindow(kind digestKind) time.Time {
+	current := kind.window(m.Clock.Now())
+	if m.Schedule == nil {
+		return current
+	}
+
+	run, err := m.Schedule.LastRun(context.Background(), kind.frequency)
+	if err != nil {
+		if !errors.Is(err, store.ErrorNotFound) {
+			log.Printf("ERROR: cant load last %s run: %v", kind.frequency, err)
+		}
+		return current
+	}
+
+	return run.LastWindow.In(current.Location())
+}
+
+// runWindow delivers w unless another replica holds the schedule lock or
+// already recorded the window. It reports false when w should be tried again
+// on the next poll, which is how a replica takes over from a dead leader.
+func (m *SmtpMailer) runWindow(kind digestKind, w time.Time, late time.Duration) bool {
+	if m.Locker != nil {
+		unlock, ok, err := m.Locker.TryLock(context.Background(), "digest:"+kind.frequency)
+		if err != nil {
+			log.Printf("ERROR: cant lock %s schedule: %v", kind.frequency, err)
+			return false
+		}
+		if !ok {
+			return false
+		}
+		defer unlock()
+	}
+
+	if m.Schedule != nil {
+		run, err := m.Schedule.LastRun(context.Background(), kind.frequency)
+		if err == nil && !run.LastWindow.Before(w) {
+			return true
+		}
+		if err != nil && !errors.Is(err, store.ErrorNotFound) {
+			log.Printf("ERROR: cant load last %s run: %v", kind.frequency, err)
+			return false
+		}
+	}
+
+	// another replica may have served the subscribe or unsubscribe requests
+	if m.Targets != nil {
+		subs, err := m.Targets.ListActive(context.Background())
+		if err != nil {
+			log.Printf("ERROR: cant refresh targets, using cached ones: %v", err)
+		} else {
+			m.LoadTargets(subs)
+		}
+	}
+
+	if late > onTimeSlack {
+		log.Printf("catching up %s digest window %s, %s late", kind.frequency, w.Format(time.RFC3339), late.Round(time.Second))
+	}
+	m.deliver(kind, w)
+
+	return true
+}
+
+func (m *SmtpMailer) deliver(kind digestKind, window time.Time) {
+	summary := m.runDigest(kind, window)
+	if m.Schedule == nil {
+		return
+	}
+
+	run := models.ScheduleRun{
+		Frequency:  kind.frequency,
+		LastWindow: window,
+		Sent:       summary.Sent,
+		Skipped:    summary.Skipped,
+		Failed:     summary.Failed,
+	}
+	if err := m.Schedule.RecordRun(context.Background(), run); err != nil {
+		log.Printf("ERROR: cant record %s run: %v", kind.frequency, err)
+	}
+}
+
+// claim reserves the window for sub. Without a ScheduleStore every send is
+// allowed.
+func (m *SmtpMailer) claim(kind digestKind, sub models.Subscription, window time.Time) (bool, error) {
+	if m.Schedule == nil {
+		return true, nil
+	}
+	return m.Schedule.ClaimDigest(context.Background(), idempotencyKey(kind, sub, window), sub.ID, window)
+}
+
+func (m *SmtpMailer) release(kind digestKind, sub models.Subscription, window time.Time) {
+	if m.Schedule == nil {
+		return
+	}
+	if err := m.Schedule.ReleaseDigest(context.Background(), idempotencyKey(kind, sub, window), sub.ID, window); err != nil {
+		log.Printf("ERROR: cant release %s digest for %s: %v", window.Format(time.RFC3339), sub.Email, err)
+	}
+}
+
+// idempotencyKey names one digest: a subscription, a schedule and a window.
+// It doubles as the Message-ID so receivers can drop duplicates too.
+func idempotencyKey(kind digestKind, sub models.Subscription, window time.Time) string {
+	return fmt.Sprintf("digest.%d.%s.%d", sub.ID, kind.frequency, window.Unix())
+}
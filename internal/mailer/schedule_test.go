@@ -0,0 +1,339 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"weather/internal/clock"
+	"weather/internal/models"
+	"weather/internal/store"
+)
+
+// scheduleStore records delivered windows in memory.
+type scheduleStore struct {
+	mx   sync.Mutex
+	runs []models.ScheduleRun
+}
+
+func (s *scheduleStore) LastRun(_ context.Context, frequency string) (models.ScheduleRun, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		if s.runs[i].Frequency == frequency {
+			return s.runs[i], nil
+		}
+	}
+	return models.ScheduleRun{}, store.ErrorNotFound
+}
+
+func (s *scheduleStore) RecordRun(_ context.Context, run models.ScheduleRun) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.runs = append(s.runs, run)
+	return nil
+}
+
+func (s *scheduleStore) ClaimDigest(context.Context, string, int64, time.Time) (bool, error) {
+	return true, nil
+}
+
+func (s *scheduleStore) ReleaseDigest(context.Context, string, int64, time.Time) error {
+	return nil
+}
+
+// windows lists the delivered windows of frequency in UTC.
+func (s *scheduleStore) windows(frequency string) []time.Time {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	var windows []time.Time
+	for _, run := range s.runs {
+		if run.Frequency == frequency {
+			windows = append(windows, run.LastWindow.UTC())
+		}
+	}
+	return windows
+}
+
+func newTestMailer(now time.Time) (*SmtpMailer, *clock.Fake, *scheduleStore) {
+	fake := clock.NewFake(now)
+	schedule := &scheduleStore{}
+	m := &SmtpMailer{
+		Clock:    fake,
+		Schedule: schedule,
+		targets:  make(map[string][]models.Subscription),
+		stopChan: make(chan struct{}),
+	}
+	return m, fake, schedule
+}
+
+// runSchedule runs the scheduler of kind until stop is called or the test
+// ends. stop returns once the scheduler did.
+func runSchedule(t *testing.T, m *SmtpMailer, kind digestKind) (stop func()) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.schedule(kind)
+	}()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			close(m.stopChan)
+			<-done
+		})
+	}
+	t.Cleanup(stop)
+
+	return stop
+}
+
+// advanceTo moves fake to t a sleep at a time, waiting for the scheduler to
+// go back to sleep before each step.
+func advanceTo(fake *clock.Fake, t time.Time) {
+	for fake.Now().Before(t) {
+		fake.BlockUntil(1)
+		fake.Advance(min(schedulePoll, t.Sub(fake.Now())))
+	}
+	fake.BlockUntil(1)
+}
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("no tzdata for %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestDigestKindWindowAcrossFallBack(t *testing.T) {
+	ny := loadLocation(t, "America/New_York")
+	// 01:30 EST, the second 01:30 of the day
+	now := time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC).In(ny)
+
+	w, next := hourlyDigest.window(now), hourlyDigest.next(now)
+	if want := time.Date(2026, 11, 1, 6, 0, 0, 0, time.UTC); !w.Equal(want) {
+		t.Errorf("got window %s, want %s", w, want.In(ny))
+	}
+	if d := next.Sub(now); d != 30*time.Minute {
+		t.Errorf("got next window in %s, want 30m", d)
+	}
+}
+
+func TestScheduleHourlyAcrossFallBack(t *testing.T) {
+	ny := loadLocation(t, "America/New_York")
+	// 00:30 EDT, the clocks go back from 02:00 EDT to 01:00 EST
+	start := time.Date(2026, 11, 1, 4, 30, 0, 0, time.UTC).In(ny)
+	m, fake, schedule := newTestMailer(start)
+	runSchedule(t, m, hourlyDigest)
+
+	advanceTo(fake, start.Add(3*time.Hour))
+
+	want := []time.Time{
+		time.Date(2026, 11, 1, 5, 0, 0, 0, time.UTC), // 01:00 EDT
+		time.Date(2026, 11, 1, 6, 0, 0, 0, time.UTC), // 01:00 EST
+		time.Date(2026, 11, 1, 7, 0, 0, 0, time.UTC), // 02:00 EST
+	}
+	assertWindows(t, schedule.windows(models.Hourly), want)
+}
+
+func TestScheduleHourlyAcrossSpringForward(t *testing.T) {
+	ny := loadLocation(t, "America/New_York")
+	// 00:30 EST, the clocks go forward from 02:00 EST to 03:00 EDT
+	start := time.Date(2026, 3, 8, 5, 30, 0, 0, time.UTC).In(ny)
+	m, fake, schedule := newTestMailer(start)
+	runSchedule(t, m, hourlyDigest)
+
+	advanceTo(fake, start.Add(3*time.Hour))
+
+	want := []time.Time{
+		time.Date(2026, 3, 8, 6, 0, 0, 0, time.UTC), // 01:00 EST
+		time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC), // 03:00 EDT
+		time.Date(2026, 3, 8, 8, 0, 0, 0, time.UTC), // 04:00 EDT
+	}
+	assertWindows(t, schedule.windows(models.Hourly), want)
+}
+
+func TestScheduleDailyMidnightRollover(t *testing.T) {
+	kyiv := loadLocation(t, "Europe/Kyiv")
+	start := time.Date(2026, 10, 19, 23, 58, 0, 0, kyiv)
+	m, fake, schedule := newTestMailer(start)
+	runSchedule(t, m, dailyDigest)
+
+	advanceTo(fake, start.Add(time.Minute+59*time.Second))
+	if got := schedule.windows(models.Daily); len(got) != 0 {
+		t.Fatalf("got windows %v before midnight, want none", got)
+	}
+
+	advanceTo(fake, start.Add(5*time.Minute))
+	assertWindows(t, schedule.windows(models.Daily), []time.Time{
+		time.Date(2026, 10, 20, 0, 0, 0, 0, kyiv).UTC(),
+	})
+}
+
+func TestScheduleDailyMidnightAcrossDST(t *testing.T) {
+	kyiv := loadLocation(t, "Europe/Kyiv")
+	// the clocks go back at 04:00 on the 25th, that day has 25 hours
+	start := time.Date(2026, 10, 24, 23, 30, 0, 0, kyiv)
+	m, fake, schedule := newTestMailer(start)
+	runSchedule(t, m, dailyDigest)
+
+	advanceTo(fake, time.Date(2026, 10, 26, 0, 30, 0, 0, kyiv))
+
+	assertWindows(t, schedule.windows(models.Daily), []time.Time{
+		time.Date(2026, 10, 25, 0, 0, 0, 0, kyiv).UTC(),
+		time.Date(2026, 10, 26, 0, 0, 0, 0, kyiv).UTC(),
+	})
+}
+
+func TestScheduleStopDuringWait(t *testing.T) {
+	start := time.Date(2026, 10, 19, 12, 30, 0, 0, time.UTC)
+	m, fake, schedule := newTestMailer(start)
+	stop := runSchedule(t, m, hourlyDigest)
+
+	fake.BlockUntil(1)
+	if got := fake.Waiters(); got != 1 {
+		t.Fatalf("got %d waiters, want the scheduler asleep on one", got)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduler did not stop while waiting")
+	}
+
+	// the abandoned sleep fires into its buffer, nobody delivers the window
+	fake.Advance(time.Hour)
+	if got := fake.Waiters(); got != 0 {
+		t.Errorf("got %d waiters after stop, want none", got)
+	}
+	if got := schedule.windows(models.Hourly); len(got) != 0 {
+		t.Errorf("got windows %v after stop, want none", got)
+	}
+}
+
+// snapshot serves the same reading and forecast for every city.
+type snapshot struct{}
+
+func (snapshot) Get(string) (models.Weather, bool) {
+	return models.Weather{Temperature: 20, Humidity: 50, Description: "Sunny"}, true
+}
+
+func (snapshot) Forecast(string) (models.Forecast, bool) {
+	return models.Forecast{Condition: "Sunny", MinTemperature: 12, MaxTemperature: 22}, true
+}
+
+// recordingChannel records the digests handed to it.
+type recordingChannel struct {
+	mx      sync.Mutex
+	digests map[string][]time.Time
+}
+
+func (c *recordingChannel) SendDigest(_ context.Context, digest Digest) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.digests[digest.Subscription.Email] = append(c.digests[digest.Subscription.Email], digest.Window.UTC())
+	return nil
+}
+
+func (c *recordingChannel) windows(email string) []time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return append([]time.Time(nil), c.digests[email]...)
+}
+
+func chatSubscription(id int64, status string) models.Subscription {
+	return models.Subscription{
+		ID:        id,
+		Email:     models.ChatAddress(models.ChannelTelegram, id),
+		City:      "Kyiv",
+		Frequency: models.Hourly,
+		Status:    status,
+		Channel:   models.ChannelTelegram,
+		ChatID:    id,
+	}
+}
+
+func TestScheduleTargetsChangingDuringRuns(t *testing.T) {
+	start := time.Date(2026, 10, 19, 12, 30, 0, 0, time.UTC)
+	m, fake, _ := newTestMailer(start)
+	m.Snapshot = snapshot{}
+	m.HourlyContent = NewContentBuilder(HourlySections()...)
+	channel := &recordingChannel{digests: make(map[string][]time.Time)}
+	m.Channels = map[string]Channel{models.ChannelTelegram: channel}
+
+	steady := chatSubscription(1, models.StatusActive)
+	m.AddHourlyTarget(steady)
+	runSchedule(t, m, hourlyDigest)
+
+	churn := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := int64(0); ; n++ {
+				select {
+				case <-churn:
+					return
+				default:
+				}
+				sub := chatSubscription(int64(100+i), models.StatusActive)
+				switch n % 4 {
+				case 0:
+					m.AddHourlyTarget(sub)
+				case 1:
+					m.RemoveHourlyTarget(sub.Email)
+				case 2:
+					m.SyncTarget(sub)
+				case 3:
+					sub.Status = models.StatusUnsubscribed
+					m.SyncTarget(sub)
+				}
+			}
+		}()
+	}
+
+	advanceTo(fake, start.Add(3*time.Hour))
+	close(churn)
+	wg.Wait()
+
+	// the churning subscriptions may or may not make a window, the steady
+	// one gets each window exactly once
+	assertWindows(t, channel.windows(steady.Email), []time.Time{
+		time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 19, 14, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC),
+	})
+	for i := range 4 {
+		email := chatSubscription(int64(100+i), "").Email
+		if got := channel.windows(email); len(got) > 3 {
+			t.Errorf("got %d digests to %s, want at most one per window", len(got), email)
+		}
+	}
+}
+
+func assertWindows(t *testing.T, got, want []time.Time) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got windows %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Fatalf("got windows %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+// Package smtptest provides an in-process SMTP server for exercising the
+// mailer without a real relay, in the spirit of net/http/httptest.
+package smtptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	From string
+	To   []string
+	Data string
+}
+
+// Server accepts any mail on 127.0.0.1 and records it.
+type Server struct {
+	Addr string
+	Host string
+	Port string
+
+	listener  net.Listener
+	tlsConfig *tls.Config
+	startTLS  bool
+	certPEM   []byte
+
+	mx        sync.Mutex
+	user      string
+	password  string
+	messages  []Message
+	sessions  int
+	resets    int
+	rejectFor map[string]bool
+	stallOn   string
+	conns     map[net.Conn]struct{}
+
+	wg sync.WaitGroup
+}
+
+// NewServer starts a plaintext server.
+func NewServer() (*Server, error) {
+	return start(false, false)
+}
+
+// NewStartTLSServer starts a server that advertises STARTTLS.
+func NewStartTLSServer() (*Server, error) {
+	return start(true, false)
+}
+
+// NewTLSServer starts an implicit TLS server, like port 465.
+func NewTLSServer() (*Server, error) {
+	return start(false, true)
+}
+
+func start(startTLS, implicitTLS bool) (*Server, error) {
+	s := &Server{startTLS: startTLS, rejectFor: make(map[string]bool), conns: make(map[net.Conn]struct{})}
+
+	if startTLS || implicitTLS {
+		cert, certPEM, err := selfSigned()
+		if err != nil {
+			return nil, err
+		}
+		s.certPEM = certPEM
+		s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	var err error
+	if implicitTLS {
+		s.listener, err = tls.Listen("tcp", "127.0.0.1:0", s.tlsConfig)
+	} else {
+		s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.Addr = s.listener.Addr().String()
+	s.Host, s.Port, _ = net.SplitHostPort(s.Addr)
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+// CertPEM is the self-signed certificate of a TLS server, to be used as CA.
+func (s *Server) CertPEM() []byte {
+	return s.certPEM
+}
+
+// SetAuth makes the server require AUTH PLAIN with user and password, for
+// the sessions opened from then on.
+func (s *Server) SetAuth(user, password string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.user, s.password = user, password
+}
+
+// Reject makes RCPT TO for addr fail with a permanent error.
+func (s *Server) Reject(addr string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.rejectFor[addr] = true
+}
+
+// Stall makes the server stop answering once a session sends the command
+// verb, e.g. "DATA", keeping the connection open until the client hangs up.
+// An empty verb answers everything again.
+func (s *Server) Stall(verb string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.stallOn = strings.ToUpper(verb)
+}
+
+func (s *Server) Messages() []Message {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Sessions is the number of connections accepted so far.
+func (s *Server) Sessions() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.sessions
+}
+
+// Resets is the number of RSET commands received.
+func (s *Server) Resets() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.resets
+}
+
+// Close stops listening and drops open sessions, including idle pooled ones.
+func (s *Server) Close() {
+	s.listener.Close()
+
+	s.mx.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mx.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mx.Lock()
+		s.sessions++
+		s.conns[conn] = struct{}{}
+		s.mx.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mx.Lock()
+				delete(s.conns, conn)
+				s.mx.Unlock()
+				conn.Close()
+			}()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	s.mx.Lock()
+	user, password := s.user, s.password
+	s.mx.Unlock()
+
+	var (
+		tp     = textproto.NewConn(conn)
+		secure = s.tlsConfig != nil && !s.startTLS
+		authed = user == ""
+		msg    Message
+	)
+
+	tp.PrintfLine("220 smtptest ready")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+
+		s.mx.Lock()
+		stalled := verb == s.stallOn
+		s.mx.Unlock()
+		if stalled {
+			for {
+				if _, err := tp.ReadLine(); err != nil {
+					return
+				}
+			}
+		}
+
+		switch verb {
+		case "EHLO", "HELO":
+			lines := []string{"250-smtptest", "250-8BITMIME"}
+			if s.startTLS && !secure {
+				lines = append(lines, "250-STARTTLS")
+			}
+			if user != "" {
+				lines = append(lines, "250-AUTH PLAIN")
+			}
+			lines = append(lines, "250 SIZE 10485760")
+			for _, l := range lines {
+				tp.PrintfLine("%s", l)
+			}
+		case "STARTTLS":
+			if !s.startTLS || secure {
+				tp.PrintfLine("502 not supported")
+				continue
+			}
+			tp.PrintfLine("220 go ahead")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, secure = tlsConn, true
+			tp = textproto.NewConn(conn)
+		case "AUTH":
+			if checkPlain(arg, user, password) {
+				authed = true
+				tp.PrintfLine("235 authenticated")
+			} else {
+				tp.PrintfLine("535 bad credentials")
+			}
+		case "MAIL":
+			if !authed {
+				tp.PrintfLine("530 authentication required")
+				continue
+			}
+			msg = Message{From: address(arg)}
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			to := address(arg)
+			s.mx.Lock()
+			rejected := s.rejectFor[to]
+			s.mx.Unlock()
+			if rejected {
+				tp.PrintfLine("550 no such user")
+				continue
+			}
+			msg.To = append(msg.To, to)
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			if len(msg.To) == 0 {
+				tp.PrintfLine("503 need RCPT")
+				continue
+			}
+			tp.PrintfLine("354 end with .")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.Data = string(data)
+			s.mx.Lock()
+			s.messages = append(s.messages, msg)
+			s.mx.Unlock()
+			msg = Message{}
+			tp.PrintfLine("250 queued")
+		case "RSET":
+			msg = Message{}
+			s.mx.Lock()
+			s.resets++
+			s.mx.Unlock()
+			tp.PrintfLine("250 ok")
+		case "NOOP":
+			tp.PrintfLine("250 ok")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func checkPlain(arg, user, password string) bool {
+	mech, initial, _ := strings.Cut(arg, " ")
+	if !strings.EqualFold(mech, "PLAIN") {
+		return false
+	}
+	raw, err := base64.StdEncoding.DecodeString(initial)
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(string(raw), "\x00")
+	return len(parts) == 3 && parts[1] == user && parts[2] == password
+}
+
+// address reads "FROM:<a@b>" or "TO:<a@b> SIZE=1".
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr, _, _ = strings.Cut(strings.TrimSpace(addr), " ")
+	return strings.Trim(addr, "<>")
+}
+
+func selfSigned() (tls.Certificate, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "smtptest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, certPEM, nil
+}
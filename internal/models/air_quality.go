@@ -0,0 +1,50 @@
+package models
+
+import "fmt"
+
+// AirQualityEvent is the event of alerts raised for a subscriber's air
+// quality threshold rather than published by the provider.
+const AirQualityEvent = "Poor air quality"
+
+// MaxAirQualityIndex is the top of the US EPA index, hazardous air.
+const MaxAirQualityIndex = 6
+
+// airQualityCategories names the US EPA index levels, 1 to 6.
+var airQualityCategories = []string{
+	"good",
+	"moderate",
+	"unhealthy for sensitive groups",
+	"unhealthy",
+	"very unhealthy",
+	"hazardous",
+}
+
+// AirQuality holds pollutant concentrations in μg/m³. USEPAIndex runs from 1
+// (good) to 6 (hazardous), GBDEFRAIndex from 1 (low) to 10 (very high); zero
+// means the provider did not say.
+type AirQuality struct {
+	PM25         float64 `json:"pm2_5"`
+	PM10         float64 `json:"pm10"`
+	O3           float64 `json:"o3"`
+	NO2          float64 `json:"no2"`
+	USEPAIndex   int     `json:"us_epa_index"`
+	GBDEFRAIndex int     `json:"gb_defra_index"`
+}
+
+// Category names the US EPA index, e.g. "unhealthy for sensitive groups".
+func (a AirQuality) Category() string {
+	return AirQualityCategory(a.USEPAIndex)
+}
+
+func AirQualityCategory(index int) string {
+	if index < 1 || index > len(airQualityCategories) {
+		return "unknown"
+	}
+	return airQualityCategories[index-1]
+}
+
+// Summary is a one line description for digests and alerts.
+func (a AirQuality) Summary() string {
+	return fmt.Sprintf("%s (US EPA %d, DEFRA %d), PM2.5 %.1f, PM10 %.1f, O3 %.1f, NO2 %.1f μg/m³",
+		a.Category(), a.USEPAIndex, a.GBDEFRAIndex, a.PM25, a.PM10, a.O3, a.NO2)
+}
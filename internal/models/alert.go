@@ -0,0 +1,88 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	SeverityExtreme  = "extreme"
+	SeveritySevere   = "severe"
+	SeverityModerate = "moderate"
+	SeverityMinor    = "minor"
+	SeverityUnknown  = "unknown"
+)
+
+// Severities are the CAP alert severities, most severe first.
+var Severities = []string{
+	SeverityExtreme,
+	SeveritySevere,
+	SeverityModerate,
+	SeverityMinor,
+	SeverityUnknown,
+}
+
+func ValidSeverity(severity string) bool {
+	return slices.Contains(Severities, severity)
+}
+
+// DefaultAlertSeverities are the alerts a new subscription gets.
+var DefaultAlertSeverities = AlertSeverities{SeverityExtreme, SeveritySevere}
+
+// AlertSeverities is the set of severities a subscriber is alerted about. It
+// is stored as a comma separated list, so every backend keeps it in one text
+// column.
+type AlertSeverities []string
+
+func (s AlertSeverities) Has(severity string) bool {
+	return slices.Contains(s, severity)
+}
+
+func (s AlertSeverities) Value() (driver.Value, error) {
+	return strings.Join(s, ","), nil
+}
+
+func (s *AlertSeverities) Scan(src any) error {
+	var raw string
+	switch v := src.(type) {
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("cant scan %T into alert severities", src)
+	}
+
+	*s = AlertSeverities{}
+	for _, severity := range strings.Split(raw, ",") {
+		if severity != "" {
+			*s = append(*s, severity)
+		}
+	}
+	return nil
+}
+
+// Alert is an official warning published for a city, e.g. a storm warning.
+// ID is the same for every city the alert was seen in.
+type Alert struct {
+	ID          string     `json:"id" db:"id"`
+	City        string     `json:"city" db:"city"`
+	Event       string     `json:"event" db:"event"`
+	Headline    string     `json:"headline" db:"headline"`
+	Severity    string     `json:"severity" db:"severity"`
+	Urgency     string     `json:"urgency" db:"urgency"`
+	Areas       string     `json:"areas" db:"areas"`
+	Description string     `json:"description" db:"description"`
+	Instruction string     `json:"instruction" db:"instruction"`
+	EffectiveAt *time.Time `json:"effective_at" db:"effective_at"`
+	ExpiresAt   *time.Time `json:"expires_at" db:"expires_at"`
+	ReceivedAt  time.Time  `json:"received_at" db:"received_at"`
+}
+
+// Expired reports whether the alert no longer applies at t.
+func (a Alert) Expired(t time.Time) bool {
+	return a.ExpiresAt != nil && !a.ExpiresAt.After(t)
+}
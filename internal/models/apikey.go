@@ -0,0 +1,36 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	ScopeAll                = "*"
+	ScopeWeatherRead        = "weather:read"
+	ScopeSubscriptionsAdmin = "subscriptions:admin"
+	ScopeMailSend           = "mail:send"
+	ScopeKeysAdmin          = "keys:admin"
+)
+
+var Scopes = []string{
+	ScopeWeatherRead,
+	ScopeSubscriptionsAdmin,
+	ScopeMailSend,
+	ScopeKeysAdmin,
+}
+
+type APIKey struct {
+	ID         int64      `json:"id" db:"id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	UsageCount int64      `json:"usage_count" db:"usage_count"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at" db:"revoked_at"`
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, ScopeAll) || slices.Contains(k.Scopes, scope)
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Forecast is the outlook of a city for one day. Times are the city's local
+// wall clock and temperatures are in °C.
+type Forecast struct {
+	Date           time.Time      `json:"date"`
+	Condition      string         `json:"condition"`
+	MinTemperature float64        `json:"min_temperature"`
+	MaxTemperature float64        `json:"max_temperature"`
+	ChanceOfRain   int            `json:"chance_of_rain"`
+	ChanceOfSnow   int            `json:"chance_of_snow"`
+	Precipitation  float64        `json:"precipitation_mm"`
+	Sunrise        *time.Time     `json:"sunrise"`
+	Sunset         *time.Time     `json:"sunset"`
+	Hours          []ForecastHour `json:"hours"`
+}
+
+type ForecastHour struct {
+	Time          time.Time `json:"time"`
+	Temperature   float64   `json:"temperature"`
+	Condition     string    `json:"condition"`
+	ChanceOfRain  int       `json:"chance_of_rain"`
+	ChanceOfSnow  int       `json:"chance_of_snow"`
+	Precipitation float64   `json:"precipitation_mm"`
+}
+
+// Outlook is the current weather of a city along with the forecast of its
+// days from today on. TimeZone is the city's IANA zone, e.g. "Europe/Kyiv".
+type Outlook struct {
+	Weather  Weather    `json:"weather"`
+	Forecast []Forecast `json:"forecast"`
+	TimeZone string     `json:"time_zone"`
+}
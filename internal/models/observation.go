@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Observation is one successful fetch from a weather provider.
+type Observation struct {
+	ID          int64           `json:"id" db:"id"`
+	City        string          `json:"city" db:"city"`
+	Provider    string          `json:"provider" db:"provider"`
+	Temperature float64         `json:"temperature" db:"temperature"`
+	Humidity    int             `json:"humidity" db:"humidity"`
+	Condition   string          `json:"condition" db:"condition"`
+	Raw         json.RawMessage `json:"raw" db:"raw"`
+	ObservedAt  time.Time       `json:"observed_at" db:"observed_at"`
+}
+
+// ObservationBucket aggregates the observations of a city within one hour or day.
+type ObservationBucket struct {
+	Start       time.Time `json:"start"`
+	Count       int       `json:"count"`
+	Temperature Aggregate `json:"temperature"`
+	Humidity    Aggregate `json:"humidity"`
+}
+
+type Aggregate struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	Avg float64 `json:"avg"`
+}
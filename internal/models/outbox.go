@@ -0,0 +1,20 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxMessage is a side effect, e.g. an email, written in the same
+// transaction as the change causing it and delivered after the commit.
+type OutboxMessage struct {
+	ID          int64           `json:"id" db:"id"`
+	Topic       string          `json:"topic" db:"topic"`
+	Payload     json.RawMessage `json:"payload" db:"payload"`
+	Attempts    int             `json:"attempts" db:"attempts"`
+	AvailableAt time.Time       `json:"available_at" db:"available_at"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+	SentAt      *time.Time      `json:"sent_at" db:"sent_at"`
+	FailedAt    *time.Time      `json:"failed_at" db:"failed_at"`
+	LastError   string          `json:"last_error" db:"last_error"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ScheduleRun is the last delivered window of a digest schedule.
+type ScheduleRun struct {
+	Frequency  string    `json:"frequency" db:"frequency"`
+	LastWindow time.Time `json:"last_window" db:"last_window"`
+	FinishedAt time.Time `json:"finished_at" db:"finished_at"`
+	Sent       int       `json:"sent" db:"sent"`
+	Skipped    int       `json:"skipped" db:"skipped"`
+	Failed     int       `json:"failed" db:"failed"`
+}
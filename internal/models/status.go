@@ -0,0 +1,45 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	StatusPending      = "pending"
+	StatusActive       = "active"
+	StatusPaused       = "paused"
+	StatusUnsubscribed = "unsubscribed"
+	StatusBounced      = "bounced"
+)
+
+// transitions lists the states a subscription may move to from each state.
+// Staying in the same state is always allowed and is a no-op. An unsubscribed
+// subscription only becomes active again through pending, so an old
+// confirmation link cannot skip double opt-in.
+var transitions = map[string][]string{
+	StatusPending:      {StatusActive, StatusUnsubscribed, StatusBounced},
+	StatusActive:       {StatusPaused, StatusUnsubscribed, StatusBounced},
+	StatusPaused:       {StatusActive, StatusUnsubscribed, StatusBounced},
+	StatusUnsubscribed: {StatusPending},
+	StatusBounced:      {StatusPending, StatusUnsubscribed},
+}
+
+func ValidStatus(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+func CanTransition(from, to string) bool {
+	return from == to || slices.Contains(transitions[from], to)
+}
+
+type SubscriptionEvent struct {
+	ID             int64     `json:"id" db:"id"`
+	SubscriptionID int64     `json:"subscription_id" db:"subscription_id"`
+	Email          string    `json:"email" db:"email"`
+	FromStatus     *string   `json:"from_status" db:"from_status"`
+	ToStatus       string    `json:"to_status" db:"to_status"`
+	Reason         string    `json:"reason" db:"reason"`
+	ChangedAt      time.Time `json:"changed_at" db:"changed_at"`
+}
@@ -1,14 +1,130 @@
 package models
 
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
 const (
 	Hourly = "hourly"
 	Daily  = "daily"
 )
 
+const (
+	Metric   = "metric"
+	Imperial = "imperial"
+)
+
+// Channels a subscription gets its digests on. Webhook is not stored, it is
+// an email subscription with a WebhookURL.
+const (
+	ChannelEmail    = "email"
+	ChannelWebhook  = "webhook"
+	ChannelTelegram = "telegram"
+)
+
 type Subscription struct {
 	ID        int64  `db:"id"`
 	Email     string `json:"email" db:"email"`
 	City      string `json:"city" db:"city"`
 	Frequency string `json:"frequency" db:"frequency"`
+	Units     string `json:"units" db:"units"`
 	Token     string
+	Confirmed bool   `json:"confirmed" db:"confirmed"`
+	Status    string `json:"status" db:"status"`
+
+	StatusChangedAt    time.Time  `json:"status_changed_at" db:"status_changed_at"`
+	PausedUntil        *time.Time `json:"paused_until" db:"paused_until"`
+	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
+	ConfirmationSentAt *time.Time `json:"confirmation_sent_at" db:"confirmation_sent_at"`
+	ConfirmationSends  int        `json:"confirmation_sends" db:"confirmation_sends"`
+
+	AlertSeverities AlertSeverities `json:"alert_severities" db:"alert_severities"`
+	// AirQualityThreshold is the US EPA index from which the subscriber is
+	// alerted about poor air, zero turns these alerts off.
+	AirQualityThreshold int `json:"air_quality_threshold" db:"air_quality_threshold"`
+
+	// WebhookURL, when set, receives digests instead of the email address.
+	// After repeated failed deliveries the webhook is disabled until the URL
+	// is set again.
+	WebhookURL        string     `json:"webhook_url" db:"webhook_url"`
+	WebhookFailures   int        `json:"webhook_failures" db:"webhook_failures"`
+	WebhookDisabledAt *time.Time `json:"webhook_disabled_at" db:"webhook_disabled_at"`
+	// WebhookSecret signs the deliveries to WebhookURL. A new one comes with
+	// every URL set and is shown to the subscriber only then.
+	WebhookSecret string `json:"-" db:"webhook_secret"`
+
+	// Channel is where the subscription was made, email or a chat bot. Chat
+	// subscriptions have a placeholder Email, see ChatAddress.
+	Channel string `json:"channel" db:"channel"`
+	ChatID  int64  `json:"chat_id" db:"chat_id"`
+}
+
+type CityStats struct {
+	City      string `json:"city" db:"city"`
+	Total     int64  `json:"total"`
+	Confirmed int64  `json:"confirmed"`
+	Active    int64  `json:"active"`
+}
+
+// NewToken returns a random subscription token. The token is the only
+// credential of the confirm, unsubscribe and preferences links, so it must
+// not be derivable from anything about the subscriber.
+func NewToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// LegacyToken is how tokens used to be derived from the email address.
+// Anyone can compute it, so it opens none of the token links, see
+// Subscription.HasLegacyToken.
+func LegacyToken(email string) string {
+	sum := sha256.Sum256([]byte(email))
+	return hex.EncodeToString(sum[:])
+}
+
+// ChatAddress is the placeholder email of a chat subscription, unique per
+// channel and chat and never delivered to.
+func ChatAddress(channel string, chatID int64) string {
+	return fmt.Sprintf("%s-%d@%s.invalid", channel, chatID, channel)
+}
+
+// DeliveryChannel is where digests go: the chat of a chat subscription, the
+// webhook if one is set, or email.
+func (s Subscription) DeliveryChannel() string {
+	switch {
+	case s.Channel != "" && s.Channel != ChannelEmail:
+		return s.Channel
+	case s.UsesWebhook():
+		return ChannelWebhook
+	default:
+		return ChannelEmail
+	}
+}
+
+// HasEmail reports whether Email is a real address, not a chat placeholder.
+func (s Subscription) HasEmail() bool {
+	return s.Channel == "" || s.Channel == ChannelEmail
+}
+
+// UsesWebhook reports whether digests go to WebhookURL rather than by email.
+func (s Subscription) UsesWebhook() bool {
+	return s.WebhookURL != ""
+}
+
+// HasLegacyToken reports whether Token is still the one derived from Email.
+// Such tokens are replaced by a random one with the next digest.
+func (s Subscription) HasLegacyToken() bool {
+	return s.Token == LegacyToken(s.Email)
+}
+
+// Active reports whether digests should be sent to the subscription.
+func (s Subscription) Active() bool {
+	return s.Status == StatusActive
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+const (
+	BounceHard = "hard_bounce"
+	BounceSoft = "soft_bounce"
+	Complaint  = "complaint"
+)
+
+// Suppression is an address we must not send to anymore.
+type Suppression struct {
+	Email     string    `json:"email" db:"email"`
+	Reason    string    `json:"reason" db:"reason"`
+	Source    string    `json:"source" db:"source"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
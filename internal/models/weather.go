@@ -1,7 +1,20 @@
 package models
 
+import "fmt"
+
 type Weather struct {
-	Temperature int    `json:"temperature"`
-	Humidity    int    `json:"humidity"`
-	Description string `json:"description"`
+	Temperature  int    `json:"temperature"`
+	TemperatureF int    `json:"temperature_f"`
+	Humidity     int    `json:"humidity"`
+	Description  string `json:"description"`
+	// AirQuality is nil when the provider sent none.
+	AirQuality *AirQuality `json:"air_quality,omitempty"`
+}
+
+// FormatTemperature renders the temperature in the subscriber's units.
+func (w Weather) FormatTemperature(units string) string {
+	if units == Imperial {
+		return fmt.Sprintf("%d°F", w.TemperatureF)
+	}
+	return fmt.Sprintf("%d°C", w.Temperature)
 }
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// WebhookDelivery logs one attempt to deliver to a subscription's webhook.
+// DeliveryID is the same for every retry of one payload. StatusCode is zero
+// when no response came back.
+type WebhookDelivery struct {
+	ID             int64     `json:"id" db:"id"`
+	SubscriptionID int64     `json:"subscription_id" db:"subscription_id"`
+	DeliveryID     string    `json:"delivery_id" db:"delivery_id"`
+	Event          string    `json:"event" db:"event"`
+	URL            string    `json:"url" db:"url"`
+	StatusCode     int       `json:"status_code" db:"status_code"`
+	Error          string    `json:"error" db:"error"`
+	DurationMs     int64     `json:"duration_ms" db:"duration_ms"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// Succeeded reports whether the webhook answered with a 2xx status.
+func (d WebhookDelivery) Succeeded() bool {
+	return d.StatusCode >= 200 && d.StatusCode < 300
+}
@@ -0,0 +1,132 @@
+// Package outbox delivers side effects written with store.Storage.WithTx in
+// the same transaction as the change causing them, so a failed commit never
+// sends anything and a failed send never loses the change.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+	"weather/internal/clock"
+	"weather/internal/models"
+	"weather/internal/store"
+)
+
+// Handler delivers the payload of one message. Returning an error retries it
+// later, unless the error is wrapped with Permanent.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one a retry cannot fix, e.g. a suppressed recipient.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Add queues payload under topic, tx is usually the one of Storage.WithTx.
+func Add(ctx context.Context, tx store.OutboxRepository, topic string, payload any) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode %s outbox message: %w", topic, err)
+	}
+
+	return tx.Add(ctx, &models.OutboxMessage{Topic: topic, Payload: encoded})
+}
+
+// Relay hands due messages to the handler of their topic. It only claims the
+// topics it has handlers for, so topics with slow handlers can have a relay
+// of their own. Run is meant to be called periodically, e.g. as a janitor task.
+type Relay struct {
+	store    store.OutboxRepository
+	clock    clock.Clock
+	handlers map[string]Handler
+
+	// Batch is how many messages one Run claims at most.
+	Batch int
+	// Lease is how long a claimed message is hidden from other relays.
+	Lease time.Duration
+	// MaxAttempts is how often a message is tried before it is marked failed.
+	MaxAttempts int
+	// Backoff is the delay after the first failure, doubled on every further one.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func NewRelay(store store.OutboxRepository, clk clock.Clock) *Relay {
+	return &Relay{
+		store:       store,
+		clock:       clk,
+		handlers:    make(map[string]Handler),
+		Batch:       50,
+		Lease:       time.Minute,
+		MaxAttempts: 8,
+		Backoff:     30 * time.Second,
+		MaxBackoff:  time.Hour,
+	}
+}
+
+// Handle registers the handler of topic. It is not safe to call while Run is running.
+func (r *Relay) Handle(topic string, handler Handler) {
+	r.handlers[topic] = handler
+}
+
+// Run delivers the messages due now and returns the first bookkeeping error.
+// Handler errors are recorded on the message, not returned. Messages claimed
+// but not reached before ctx is done are retried once their lease ends.
+func (r *Relay) Run(ctx context.Context) error {
+	topics := slices.Sorted(maps.Keys(r.handlers))
+	if len(topics) == 0 {
+		return nil
+	}
+
+	msgs, err := r.store.Claim(ctx, topics, r.Batch, r.Lease)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range msgs {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := r.deliver(ctx, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Relay) deliver(ctx context.Context, msg models.OutboxMessage) error {
+	err := r.handlers[msg.Topic](ctx, msg.Payload)
+
+	// a delivered message must be marked even if ctx ran out meanwhile,
+	// otherwise it is delivered again after the lease
+	ctx = context.WithoutCancel(ctx)
+	switch {
+	case err == nil:
+		return r.store.MarkSent(ctx, msg.ID)
+	case errors.As(err, new(permanentError)) || msg.Attempts >= r.MaxAttempts:
+		log.Printf("ERROR: outbox message %d (%s) failed after %d attempts: %v", msg.ID, msg.Topic, msg.Attempts, err)
+		return r.store.MarkFailed(ctx, msg.ID, err.Error())
+	default:
+		return r.store.Retry(ctx, msg.ID, r.clock.Now().Add(r.backoff(msg.Attempts)), err.Error())
+	}
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.Backoff
+	for i := 1; i < attempts && delay < r.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.MaxBackoff)
+}
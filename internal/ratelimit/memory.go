@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+	"weather/internal/clock"
+)
+
+const sweepEvery = 1024
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+// MemoryStore keeps buckets in process memory. Limits are per replica.
+type MemoryStore struct {
+	clock clock.Clock
+
+	mx      sync.Mutex
+	buckets map[string]*bucket
+	takes   int
+}
+
+func NewMemoryStore(clk clock.Clock) *MemoryStore {
+	return &MemoryStore{
+		clock:   clk,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (ms *MemoryStore) Take(_ context.Context, key string, policy Policy) (Result, error) {
+	now := ms.clock.Now()
+
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+
+	ms.takes++
+	if ms.takes%sweepEvery == 0 {
+		ms.sweep(now)
+	}
+
+	b, ok := ms.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Limit), updated: now, period: policy.Period}
+		ms.buckets[key] = b
+	}
+
+	b.tokens = policy.refill(b.tokens, now.Sub(b.updated))
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	return policy.result(allowed, b.tokens), nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again.
+func (ms *MemoryStore) sweep(now time.Time) {
+	for key, b := range ms.buckets {
+		if now.Sub(b.updated) > b.period {
+			delete(ms.buckets, key)
+		}
+	}
+}
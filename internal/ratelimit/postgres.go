@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	queryTimeout  = 1 * time.Second
+	purgeEvery    = 1000
+	purgeIdleTime = 24 * time.Hour
+)
+
+// PostgresStore keeps buckets in weather.rate_limits so limits hold across replicas.
+// The refill is computed in the database with its clock, in a single statement.
+type PostgresStore struct {
+	db    *sql.DB
+	takes atomic.Int64
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (ps *PostgresStore) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	const query = `
+		INSERT INTO weather.rate_limits AS rl (key, tokens, allowed, updated_at)
+		VALUES ($1, $2::double precision - 1, true, now())
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = CASE
+				WHEN LEAST($2::double precision, rl.tokens + EXTRACT(EPOCH FROM (now() - rl.updated_at)) * $3::double precision) >= 1
+				THEN LEAST($2::double precision, rl.tokens + EXTRACT(EPOCH FROM (now() - rl.updated_at)) * $3::double precision) - 1
+				ELSE LEAST($2::double precision, rl.tokens + EXTRACT(EPOCH FROM (now() - rl.updated_at)) * $3::double precision)
+			END,
+			allowed = LEAST($2::double precision, rl.tokens + EXTRACT(EPOCH FROM (now() - rl.updated_at)) * $3::double precision) >= 1,
+			updated_at = now()
+		RETURNING tokens, allowed;
+	`
+
+	if ps.takes.Add(1)%purgeEvery == 0 {
+		go ps.purge()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var (
+		tokens  float64
+		allowed bool
+	)
+	err := ps.db.
+		QueryRowContext(ctx, query, key, policy.Limit, policy.rate()).
+		Scan(&tokens, &allowed)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "failed to take rate limit token")
+	}
+
+	return policy.result(allowed, tokens), nil
+}
+
+func (ps *PostgresStore) purge() {
+	const query = `
+		DELETE FROM weather.rate_limits
+		WHERE updated_at < now() - $1 * interval '1 second';
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if _, err := ps.db.ExecContext(ctx, query, purgeIdleTime.Seconds()); err != nil {
+		log.Printf("ERROR: failed to purge rate limits: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// TestPostgresStoreTake runs against the migrated database in
+// TEST_DATABASE_URL. The refill runs on the database clock, so the slow
+// policy leaves no time for one during the test.
+func TestPostgresStoreTake(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+	store := NewPostgresStore(db)
+	p := Policy{Name: "test", Limit: 2, Period: time.Hour}
+	key := fmt.Sprintf("ratelimit-test-%d", time.Now().UnixNano())
+	t.Cleanup(func() { db.Exec(`DELETE FROM weather.rate_limits WHERE key LIKE $1`, key+"%") })
+
+	for i := range 2 {
+		res, err := store.Take(ctx, key, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != 1-i {
+			t.Fatalf("take %d: got %+v, want allowed with %d remaining", i, res, 1-i)
+		}
+	}
+
+	res, err := store.Take(ctx, key, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.RetryAfter <= 29*time.Minute || res.RetryAfter > 30*time.Minute {
+		t.Fatalf("take over limit: got %+v, want denied for about 30m", res)
+	}
+
+	// a denied take must not push the bucket below zero
+	res, err = store.Take(ctx, key, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.RetryAfter > 30*time.Minute {
+		t.Fatalf("second take over limit: got %+v, want denied for at most 30m", res)
+	}
+
+	res, err = store.Take(ctx, key+"-other", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Allowed || res.Remaining != 1 {
+		t.Errorf("take on another key: got %+v, want allowed with 1 remaining", res)
+	}
+}
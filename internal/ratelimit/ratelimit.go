@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Policy is a token bucket that holds up to Limit tokens and refills
+// Limit tokens every Period.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// ParsePolicy reads specs like "5/1m" or "100/1h". An empty spec disables the policy.
+func ParsePolicy(name, spec string) (Policy, error) {
+	if spec == "" {
+		return Policy{Name: name}, nil
+	}
+
+	rawLimit, rawPeriod, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Policy{}, errors.New(fmt.Sprintf("invalid rate limit %q for %s, want <limit>/<period>", spec, name))
+	}
+
+	limit, err := strconv.Atoi(rawLimit)
+	if err != nil || limit < 0 {
+		return Policy{}, errors.New(fmt.Sprintf("invalid rate limit %q for %s", spec, name))
+	}
+	period, err := time.ParseDuration(rawPeriod)
+	if err != nil || period <= 0 {
+		return Policy{}, errors.New(fmt.Sprintf("invalid rate limit period %q for %s", spec, name))
+	}
+
+	return Policy{Name: name, Limit: limit, Period: period}, nil
+}
+
+// Renamed is p counted in buckets of its own, for a route that shares the
+// limits but not the budget of another.
+func (p Policy) Renamed(name string) Policy {
+	p.Name = name
+	return p
+}
+
+func (p Policy) Enabled() bool {
+	return p.Limit > 0 && p.Period > 0
+}
+
+// rate is the refill speed in tokens per second.
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+func (p Policy) refill(tokens float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(p.Limit), tokens+elapsed.Seconds()*p.rate())
+}
+
+// result builds the outcome from the tokens left after a take attempt.
+func (p Policy) result(allowed bool, tokens float64) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     p.Limit,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     p.duration(float64(p.Limit) - tokens),
+	}
+	if !allowed {
+		res.RetryAfter = p.duration(1 - tokens)
+	}
+	return res
+}
+
+func (p Policy) duration(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / p.rate() * float64(time.Second))
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store keeps bucket state. Take consumes one token from the bucket at key if available.
+type Store interface {
+	Take(ctx context.Context, key string, policy Policy) (Result, error)
+}
@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"weather/internal/clock"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Policy
+		wantErr bool
+	}{
+		{spec: "", want: Policy{Name: "p"}},
+		{spec: "5/1m", want: Policy{Name: "p", Limit: 5, Period: time.Minute}},
+		{spec: "100/1h", want: Policy{Name: "p", Limit: 100, Period: time.Hour}},
+		{spec: "5", wantErr: true},
+		{spec: "x/1m", wantErr: true},
+		{spec: "-1/1m", wantErr: true},
+		{spec: "5/0s", wantErr: true},
+		{spec: "5/soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePolicy("p", tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePolicy(%q): got error %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParsePolicy(%q): got %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyRefill(t *testing.T) {
+	// one token every 15s
+	p := Policy{Limit: 4, Period: time.Minute}
+
+	tests := []struct {
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{0, 0, 0},
+		{0, 15 * time.Second, 1},
+		{0, 30 * time.Second, 2},
+		{1.5, 7500 * time.Millisecond, 2},
+		{3, time.Hour, 4},
+		// a clock going backwards adds nothing
+		{2, -time.Minute, 2},
+	}
+	for _, tt := range tests {
+		if got := p.refill(tt.tokens, tt.elapsed); got != tt.want {
+			t.Errorf("refill(%v, %s): got %v, want %v", tt.tokens, tt.elapsed, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyResult(t *testing.T) {
+	p := Policy{Limit: 4, Period: time.Minute}
+
+	tests := []struct {
+		name    string
+		allowed bool
+		tokens  float64
+		want    Result
+	}{
+		{"full after taking", true, 3, Result{Allowed: true, Limit: 4, Remaining: 3, Reset: 15 * time.Second}},
+		{"last token", true, 0, Result{Allowed: true, Limit: 4, Remaining: 0, Reset: time.Minute}},
+		{"partial token", true, 2.5, Result{Allowed: true, Limit: 4, Remaining: 2, Reset: 22500 * time.Millisecond}},
+		{"empty", false, 0, Result{Limit: 4, Reset: time.Minute, RetryAfter: 15 * time.Second}},
+		{"almost a token", false, 0.5, Result{Limit: 4, Reset: 52500 * time.Millisecond, RetryAfter: 7500 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.result(tt.allowed, tt.tokens); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	store := NewMemoryStore(fake)
+	p := Policy{Name: "test", Limit: 2, Period: time.Minute}
+
+	take := func() Result {
+		t.Helper()
+		res, err := store.Take(ctx, "key", p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	for i := range 2 {
+		if res := take(); !res.Allowed || res.Remaining != 1-i {
+			t.Fatalf("take %d: got %+v, want allowed with %d remaining", i, res, 1-i)
+		}
+	}
+	if res := take(); res.Allowed || res.RetryAfter != 30*time.Second {
+		t.Fatalf("take over limit: got %+v, want denied for 30s", res)
+	}
+
+	// a denied take costs nothing, half a period refills one token
+	fake.Advance(30 * time.Second)
+	if res := take(); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("take after refill: got %+v, want allowed with none remaining", res)
+	}
+	if res := take(); res.Allowed {
+		t.Fatalf("take after using the refill: got %+v, want denied", res)
+	}
+
+	// keys have their own buckets
+	if res, _ := store.Take(ctx, "other", p); !res.Allowed {
+		t.Errorf("take on another key: got %+v, want allowed", res)
+	}
+
+	fake.Advance(time.Hour)
+	if res := take(); !res.Allowed || res.Remaining != 1 {
+		t.Errorf("take after an idle hour: got %+v, want a full bucket", res)
+	}
+}
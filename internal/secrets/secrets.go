@@ -0,0 +1,105 @@
+package secrets
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const fileSuffix = "_FILE"
+
+// Secret holds a credential that comes either from a plain env var or from
+// a file referenced by the <KEY>_FILE env var (Docker/Kubernetes secrets).
+// File-backed secrets can be reloaded at runtime.
+type Secret struct {
+	key  string
+	path string
+
+	mx      sync.RWMutex
+	value   string
+	modTime time.Time
+}
+
+// FromEnv resolves key_FILE first and falls back to key, then to fallback.
+func FromEnv(key, fallback string) (*Secret, error) {
+	s := &Secret{key: key, value: fallback}
+
+	if path, ok := os.LookupEnv(key + fileSuffix); ok && path != "" {
+		s.path = path
+		if _, err := s.Reload(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	if val, ok := os.LookupEnv(key); ok {
+		s.value = val
+	}
+
+	return s, nil
+}
+
+// Static wraps a fixed value that is never reloaded.
+func Static(value string) *Secret {
+	return &Secret{value: value}
+}
+
+func (s *Secret) Key() string {
+	return s.key
+}
+
+func (s *Secret) Get() string {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return s.value
+}
+
+// Reload re-reads the backing file and reports whether the value changed.
+// Secrets that are not file-backed are left untouched.
+func (s *Secret) Reload() (bool, error) {
+	if s.path == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, errors.Wrapf(err, "cant stat secret file for %s", s.key)
+	}
+
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		return false, errors.Wrapf(err, "cant read secret file for %s", s.key)
+	}
+	value := strings.TrimRight(string(raw), "\r\n")
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.modTime = info.ModTime()
+	if value == s.value {
+		return false, nil
+	}
+	s.value = value
+
+	return true, nil
+}
+
+func (s *Secret) fileChanged() bool {
+	if s.path == "" {
+		return false
+	}
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false
+	}
+
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return !info.ModTime().Equal(s.modTime)
+}
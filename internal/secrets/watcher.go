@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Watcher reloads file-backed secrets on SIGHUP and whenever one of the
+// files changes on disk.
+type Watcher struct {
+	secrets  []*Secret
+	interval time.Duration
+
+	mx       sync.Mutex
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	running  bool
+}
+
+func NewWatcher(interval time.Duration, secrets ...*Secret) *Watcher {
+	return &Watcher{
+		secrets:  secrets,
+		interval: interval,
+		stopChan: make(chan struct{}),
+	}
+}
+
+func (w *Watcher) Start() {
+	w.mx.Lock()
+	if w.running {
+		w.mx.Unlock()
+		return
+	}
+	w.running = true
+	w.stopChan = make(chan struct{})
+	w.mx.Unlock()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer signal.Stop(hup)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hup:
+				log.Println("SIGHUP received, reloading secrets")
+				w.reload(false)
+			case <-ticker.C:
+				w.reload(true)
+			case <-w.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+func (w *Watcher) Stop() {
+	w.mx.Lock()
+	if !w.running {
+		w.mx.Unlock()
+		return
+	}
+	w.running = false
+	close(w.stopChan)
+	w.mx.Unlock()
+	w.wg.Wait()
+}
+
+func (w *Watcher) reload(onlyChanged bool) {
+	for _, s := range w.secrets {
+		if onlyChanged && !s.fileChanged() {
+			continue
+		}
+		changed, err := s.Reload()
+		if err != nil {
+			log.Printf("ERROR: cant reload secret %s: %v", s.Key(), err)
+			continue
+		}
+		if changed {
+			log.Printf("secret %s rotated", s.Key())
+		}
+	}
+}
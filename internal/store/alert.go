@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+const alertColumns = `id, city, event, headline, severity, urgency, areas, description, instruction,
+        effective_at, expires_at, received_at`
+
+type AlertStore struct {
+	db dbtx
+}
+
+// Record stores alert for its city unless it is known already, which it
+// reports as false.
+func (as *AlertStore) Record(ctx context.Context, alert *models.Alert) (bool, error) {
+	const query = `
+        INSERT INTO weather.alerts (id, city, event, headline, severity, urgency, areas, description, instruction, effective_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+        ON CONFLICT (id, city) DO NOTHING
+        RETURNING received_at;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := as.db.
+		QueryRowContext(ctx, query, alertArgs(alert)...).
+		Scan(&alert.ReceivedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to record alert")
+	}
+
+	return true, nil
+}
+
+// List returns the latest alerts of city, newest first.
+func (as *AlertStore) List(ctx context.Context, city string, limit int) ([]models.Alert, error) {
+	const query = `
+        SELECT ` + alertColumns + `
+        FROM weather.alerts
+        WHERE lower(city) = lower($1)
+        ORDER BY received_at DESC, id
+        LIMIT $2;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := as.db.QueryContext(ctx, query, city, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list alerts")
+	}
+	defer rows.Close()
+
+	alerts := []models.Alert{}
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan alert")
+		}
+		alerts = append(alerts, alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to list alerts")
+	}
+
+	return alerts, nil
+}
+
+// ClaimDelivery reserves alert for the subscription, false means it was
+// claimed before. Like Subscription.Create it never fails on the conflict,
+// so it can run inside WithTx.
+func (as *AlertStore) ClaimDelivery(ctx context.Context, alertID string, subscriptionID int64) (bool, error) {
+	const query = `
+        INSERT INTO weather.alert_deliveries (alert_id, subscription_id)
+        VALUES ($1, $2)
+        ON CONFLICT (alert_id, subscription_id) DO NOTHING;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return claimed(as.db.ExecContext(ctx, query, alertID, subscriptionID))
+}
+
+// claimed reports whether an insert ... ON CONFLICT DO NOTHING added the row.
+func claimed(res sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, errors.Wrap(err, "failed to claim alert delivery")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to claim alert delivery")
+	}
+
+	return n == 1, nil
+}
+
+func alertArgs(alert *models.Alert) []any {
+	return []any{
+		alert.ID,
+		alert.City,
+		alert.Event,
+		alert.Headline,
+		alert.Severity,
+		alert.Urgency,
+		alert.Areas,
+		alert.Description,
+		alert.Instruction,
+		alert.EffectiveAt,
+		alert.ExpiresAt,
+	}
+}
+
+func scanAlert(row scanner) (models.Alert, error) {
+	var alert models.Alert
+	err := row.Scan(
+		&alert.ID,
+		&alert.City,
+		&alert.Event,
+		&alert.Headline,
+		&alert.Severity,
+		&alert.Urgency,
+		&alert.Areas,
+		&alert.Description,
+		&alert.Instruction,
+		&alert.EffectiveAt,
+		&alert.ExpiresAt,
+		&alert.ReceivedAt,
+	)
+	return alert, err
+}
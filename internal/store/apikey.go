@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"weather/internal/models"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+type APIKeyStore struct {
+	db dbtx
+}
+
+func (as *APIKeyStore) Create(ctx context.Context, key *models.APIKey, hash string) error {
+	query := `
+		INSERT INTO weather.api_keys (name, prefix, key_hash, scopes)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := as.db.
+		QueryRowContext(ctx, query, key.Name, key.Prefix, hash, pq.Array(key.Scopes)).
+		Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			return ErrorAlreadyExists
+		}
+		return errors.Wrap(err, "failed to create api key")
+	}
+
+	return nil
+}
+
+// GetActiveByHash returns a non-revoked key with the given hash.
+func (as *APIKeyStore) GetActiveByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	const query = `
+        SELECT id, name, prefix, scopes, usage_count, last_used_at, created_at, revoked_at
+        FROM weather.api_keys
+        WHERE key_hash = $1 AND revoked_at IS NULL;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	key, err := scanAPIKey(as.db.QueryRowContext(ctx, query, hash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.APIKey{}, ErrorNotFound
+		}
+		return models.APIKey{}, errors.Wrap(err, "failed to get api key")
+	}
+
+	return key, nil
+}
+
+func (as *APIKeyStore) TrackUsage(ctx context.Context, id int64) error {
+	const query = `
+        UPDATE weather.api_keys
+        SET usage_count = usage_count + 1,
+            last_used_at = now()
+        WHERE id = $1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := as.db.ExecContext(ctx, query, id); err != nil {
+		return errors.Wrap(err, "failed to track api key usage")
+	}
+
+	return nil
+}
+
+func (as *APIKeyStore) Revoke(ctx context.Context, id int64) (models.APIKey, error) {
+	const query = `
+        UPDATE weather.api_keys
+        SET revoked_at = now()
+        WHERE id = $1 AND revoked_at IS NULL
+        RETURNING id, name, prefix, scopes, usage_count, last_used_at, created_at, revoked_at;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	key, err := scanAPIKey(as.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.APIKey{}, ErrorNotFound
+		}
+		return models.APIKey{}, errors.Wrap(err, "failed to revoke api key")
+	}
+
+	return key, nil
+}
+
+func (as *APIKeyStore) List(ctx context.Context) ([]models.APIKey, error) {
+	const query = `
+        SELECT id, name, prefix, scopes, usage_count, last_used_at, created_at, revoked_at
+        FROM weather.api_keys
+        ORDER BY id;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := as.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list api keys")
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan api key")
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to list api keys")
+	}
+
+	return keys, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row scanner) (models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Scopes),
+		&key.UsageCount,
+		&key.LastUsedAt,
+		&key.CreatedAt,
+		&key.RevokedAt,
+	)
+	return key, err
+}
@@ -0,0 +1,617 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"weather/internal/clock"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+// memoryDB holds every table of the in-memory storage behind one lock, so
+// operations touching several tables stay atomic like their SQL versions.
+type memoryDB struct {
+	// mx is a no-op inside WithTx, which holds the real lock throughout.
+	mx    sync.Locker
+	clock clock.Clock
+	*memoryTables
+}
+
+type memoryTables struct {
+	subscriptions map[int64]*memorySubscription
+	history       []models.SubscriptionEvent
+	nextSubID     int64
+	nextEventID   int64
+
+	apiKeys   map[int64]*memoryAPIKey
+	nextKeyID int64
+
+	suppressions map[string]models.Suppression
+
+	runs       map[string]models.ScheduleRun
+	deliveries map[string]memoryDelivery
+
+	outbox       map[int64]*models.OutboxMessage
+	nextOutboxID int64
+
+	observations      []models.Observation
+	nextObservationID int64
+
+	alerts          []models.Alert
+	alertDeliveries map[memoryAlertDelivery]time.Time
+
+	webhookDeliveries     []models.WebhookDelivery
+	nextWebhookDeliveryID int64
+}
+
+// memorySubscription carries the columns models.Subscription does not expose.
+type memorySubscription struct {
+	models.Subscription
+	windowStartedAt *time.Time
+	lastSentWindow  *time.Time
+}
+
+// NewMemoryStorage keeps everything in process, for local runs and tests.
+// It follows the Postgres storage in ordering and in the errors it returns.
+func NewMemoryStorage(clk clock.Clock) Storage {
+	return (&memoryDB{
+		mx:    &sync.Mutex{},
+		clock: clk,
+		memoryTables: &memoryTables{
+			subscriptions: make(map[int64]*memorySubscription),
+			apiKeys:       make(map[int64]*memoryAPIKey),
+			suppressions:  make(map[string]models.Suppression),
+			runs:          make(map[string]models.ScheduleRun),
+			deliveries:    make(map[string]memoryDelivery),
+			outbox:        make(map[int64]*models.OutboxMessage),
+
+			alertDeliveries: make(map[memoryAlertDelivery]time.Time),
+		},
+	}).storage()
+}
+
+func (db *memoryDB) storage() Storage {
+	return Storage{
+		Subscription: &MemorySubscriptionStore{db},
+		APIKey:       &MemoryAPIKeyStore{db},
+		Suppression:  &MemorySuppressionStore{db},
+		Schedule:     &MemoryScheduleStore{db},
+		Outbox:       &MemoryOutboxStore{db},
+		Observation:  &MemoryObservationStore{db},
+		Alert:        &MemoryAlertStore{db},
+		Webhook:      &MemoryWebhookStore{db},
+		withTx:       db.withTx,
+	}
+}
+
+// withTx runs fn under the lock and puts the tables back as they were when
+// it fails. Concurrent callers wait like they would on a row lock.
+func (db *memoryDB) withTx(_ context.Context, fn func(Storage) error) error {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+
+	snapshot := db.memoryTables.clone()
+	tx := &memoryDB{mx: noLock{}, clock: db.clock, memoryTables: db.memoryTables}
+	if err := fn(tx.storage()); err != nil {
+		*db.memoryTables = *snapshot
+		return err
+	}
+
+	return nil
+}
+
+type noLock struct{}
+
+func (noLock) Lock()   {}
+func (noLock) Unlock() {}
+
+// clone copies the tables deep enough that changes made through the
+// original do not show up in the copy.
+func (t *memoryTables) clone() *memoryTables {
+	c := *t
+	c.history = slices.Clone(t.history)
+	c.suppressions = maps.Clone(t.suppressions)
+	c.runs = maps.Clone(t.runs)
+	c.deliveries = maps.Clone(t.deliveries)
+	c.observations = slices.Clone(t.observations)
+	c.alerts = slices.Clone(t.alerts)
+	c.alertDeliveries = maps.Clone(t.alertDeliveries)
+	c.webhookDeliveries = slices.Clone(t.webhookDeliveries)
+
+	c.subscriptions = make(map[int64]*memorySubscription, len(t.subscriptions))
+	for id, sub := range t.subscriptions {
+		cp := *sub
+		cp.AlertSeverities = slices.Clone(sub.AlertSeverities)
+		c.subscriptions[id] = &cp
+	}
+	c.apiKeys = make(map[int64]*memoryAPIKey, len(t.apiKeys))
+	for id, key := range t.apiKeys {
+		cp := *key
+		cp.Scopes = slices.Clone(key.Scopes)
+		c.apiKeys[id] = &cp
+	}
+	c.outbox = make(map[int64]*models.OutboxMessage, len(t.outbox))
+	for id, msg := range t.outbox {
+		cp := *msg
+		c.outbox[id] = &cp
+	}
+
+	return &c
+}
+
+func (db *memoryDB) now() time.Time {
+	return db.clock.Now()
+}
+
+type MemorySubscriptionStore struct {
+	db *memoryDB
+}
+
+func (ms *MemorySubscriptionStore) Create(_ context.Context, sub *models.Subscription) error {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	if err := validateSubscription(sub.Frequency, sub.Units); err != nil {
+		return errors.Wrap(err, "failed to create subscription")
+	}
+	for _, existing := range ms.db.subscriptions {
+		if existing.Email == sub.Email {
+			return ErrorAlreadyExists
+		}
+		if existing.Token == sub.Token {
+			return errors.New("failed to create subscription: duplicate token")
+		}
+	}
+
+	now := ms.db.now()
+	ms.db.nextSubID++
+	stored := &memorySubscription{Subscription: models.Subscription{
+		ID:              ms.db.nextSubID,
+		Email:           sub.Email,
+		City:            sub.City,
+		Frequency:       sub.Frequency,
+		Units:           sub.Units,
+		Token:           sub.Token,
+		Status:          models.StatusPending,
+		StatusChangedAt: now,
+		CreatedAt:       now,
+		AlertSeverities: slices.Clone(models.DefaultAlertSeverities),
+		Channel:         channelOf(*sub),
+		ChatID:          sub.ChatID,
+	}}
+	ms.db.subscriptions[stored.ID] = stored
+	ms.db.record(stored.ID, stored.Email, nil, models.StatusPending, "subscribed")
+
+	sub.ID = stored.ID
+	sub.Status = models.StatusPending
+
+	return nil
+}
+
+func (ms *MemorySubscriptionStore) Confirm(_ context.Context, token string) (models.Subscription, error) {
+	return ms.transition(ms.byToken(token), models.StatusActive, "confirmed by link", nil)
+}
+
+func (ms *MemorySubscriptionStore) Unsubscribe(_ context.Context, token string) (models.Subscription, error) {
+	return ms.transition(ms.byToken(token), models.StatusUnsubscribed, "unsubscribed by link", nil)
+}
+
+func (ms *MemorySubscriptionStore) Transition(_ context.Context, id int64, to, reason string) (models.Subscription, error) {
+	return ms.transition(ms.byID(id), to, reason, nil)
+}
+
+func (ms *MemorySubscriptionStore) ConfirmByID(_ context.Context, id int64) (models.Subscription, error) {
+	return ms.transition(ms.byID(id), models.StatusActive, "confirmed by admin", nil)
+}
+
+func (ms *MemorySubscriptionStore) Pause(_ context.Context, token string, until *time.Time) (models.Subscription, error) {
+	reason := "paused indefinitely"
+	if until != nil {
+		reason = "paused until " + until.UTC().Format(time.RFC3339)
+	}
+	return ms.transition(ms.byToken(token), models.StatusPaused, reason, until)
+}
+
+func (ms *MemorySubscriptionStore) Resume(_ context.Context, token string) (models.Subscription, error) {
+	return ms.transition(ms.byToken(token), models.StatusActive, "resumed by subscriber", nil)
+}
+
+func (ms *MemorySubscriptionStore) transition(find func() *memorySubscription, to, reason string, pausedUntil *time.Time) (models.Subscription, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	current := find()
+	if current == nil {
+		return models.Subscription{}, ErrorNotFound
+	}
+	if !models.CanTransition(current.Status, to) {
+		return current.copy(), ErrorInvalidTransition
+	}
+	if current.Status == to && to != models.StatusPaused {
+		return current.copy(), nil
+	}
+
+	from := current.Status
+	current.Status = to
+	current.StatusChangedAt = ms.db.now()
+	current.PausedUntil = copyTime(pausedUntil)
+	current.Confirmed = current.Confirmed || to == models.StatusActive
+	ms.db.record(current.ID, current.Email, &from, to, reason)
+
+	return current.copy(), nil
+}
+
+func (ms *MemorySubscriptionStore) ResumeExpired(_ context.Context) ([]models.Subscription, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	now := ms.db.now()
+	subs := []models.Subscription{}
+	for _, sub := range ms.db.sorted() {
+		if sub.Status != models.StatusPaused || sub.PausedUntil == nil || sub.PausedUntil.After(now) {
+			continue
+		}
+		from := sub.Status
+		sub.Status = models.StatusActive
+		sub.StatusChangedAt = now
+		sub.PausedUntil = nil
+		ms.db.record(sub.ID, sub.Email, &from, models.StatusActive, "pause expired")
+		subs = append(subs, sub.copy())
+	}
+
+	return subs, nil
+}
+
+func (ms *MemorySubscriptionStore) History(_ context.Context, id int64) ([]models.SubscriptionEvent, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	events := []models.SubscriptionEvent{}
+	for _, e := range ms.db.history {
+		if e.SubscriptionID == id {
+			events = append(events, e)
+		}
+	}
+
+	return events, nil
+}
+
+func (ms *MemorySubscriptionStore) List(_ context.Context, filter SubscriptionFilter) ([]models.Subscription, int64, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	var matched []models.Subscription
+	for _, sub := range ms.db.sorted() {
+		if filter.matches(sub.Subscription) {
+			matched = append(matched, sub.copy())
+		}
+	}
+
+	total := int64(len(matched))
+	subs := []models.Subscription{}
+	if filter.Offset < len(matched) {
+		subs = append(subs, matched[filter.Offset:min(len(matched), filter.Offset+max(filter.Limit, 0))]...)
+	}
+
+	return subs, total, nil
+}
+
+func (f SubscriptionFilter) matches(sub models.Subscription) bool {
+	return (f.City == "" || sub.City == f.City) &&
+		(f.Frequency == "" || sub.Frequency == f.Frequency) &&
+		(f.Confirmed == nil || sub.Confirmed == *f.Confirmed) &&
+		(f.Status == "" || sub.Status == f.Status)
+}
+
+func (ms *MemorySubscriptionStore) GetByID(_ context.Context, id int64) (models.Subscription, error) {
+	return ms.get(ms.byID(id))
+}
+
+func (ms *MemorySubscriptionStore) GetByEmail(_ context.Context, email string) (models.Subscription, error) {
+	return ms.get(ms.byEmailFold(email))
+}
+
+func (ms *MemorySubscriptionStore) GetByToken(_ context.Context, token string) (models.Subscription, error) {
+	return ms.get(ms.byToken(token))
+}
+
+func (ms *MemorySubscriptionStore) get(find func() *memorySubscription) (models.Subscription, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	sub := find()
+	if sub == nil {
+		return models.Subscription{}, ErrorNotFound
+	}
+	return sub.copy(), nil
+}
+
+func (ms *MemorySubscriptionStore) Delete(_ context.Context, id int64) (models.Subscription, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	sub, ok := ms.db.subscriptions[id]
+	if !ok {
+		return models.Subscription{}, ErrorNotFound
+	}
+	delete(ms.db.subscriptions, id)
+
+	return sub.copy(), nil
+}
+
+func (ms *MemorySubscriptionStore) CountByCity(_ context.Context) ([]models.CityStats, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	byCity := make(map[string]*models.CityStats)
+	for _, sub := range ms.db.subscriptions {
+		s, ok := byCity[sub.City]
+		if !ok {
+			s = &models.CityStats{City: sub.City}
+			byCity[sub.City] = s
+		}
+		s.Total++
+		if sub.Confirmed {
+			s.Confirmed++
+		}
+		if sub.Status == models.StatusActive {
+			s.Active++
+		}
+	}
+
+	stats := []models.CityStats{}
+	for _, s := range byCity {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Total != stats[j].Total {
+			return stats[i].Total > stats[j].Total
+		}
+		return stats[i].City < stats[j].City
+	})
+
+	return stats, nil
+}
+
+func (ms *MemorySubscriptionStore) UpdatePending(_ context.Context, sub *models.Subscription) error {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	stored := ms.byEmail(sub.Email)()
+	if stored == nil || stored.Status != models.StatusPending {
+		return ErrorNotFound
+	}
+	if err := validateSubscription(sub.Frequency, sub.Units); err != nil {
+		return errors.Wrap(err, "failed to update pending subscription")
+	}
+
+	stored.City = sub.City
+	stored.Frequency = sub.Frequency
+	stored.Units = sub.Units
+	if sub.Token != "" {
+		stored.Token = sub.Token
+	}
+	*sub = stored.copy()
+
+	return nil
+}
+
+func (ms *MemorySubscriptionStore) ReplaceToken(_ context.Context, id int64, old, replacement string) (models.Subscription, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	sub, ok := ms.db.subscriptions[id]
+	if !ok || sub.Token != old {
+		return models.Subscription{}, ErrorNotFound
+	}
+
+	sub.Token = replacement
+	return sub.copy(), nil
+}
+
+func (ms *MemorySubscriptionStore) ReserveConfirmation(_ context.Context, id int64, limits ConfirmationLimits) error {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	sub, ok := ms.db.subscriptions[id]
+	if !ok || sub.Status != models.StatusPending {
+		return ErrorLimitExceeded
+	}
+
+	now := ms.db.now()
+	windowOver := sub.windowStartedAt == nil || !sub.windowStartedAt.After(now.Add(-limits.Window))
+	cooledDown := sub.ConfirmationSentAt == nil || !sub.ConfirmationSentAt.After(now.Add(-limits.Cooldown))
+	if !cooledDown || (!windowOver && sub.ConfirmationSends >= limits.MaxSends) {
+		return ErrorLimitExceeded
+	}
+
+	if windowOver {
+		sub.ConfirmationSends = 1
+		sub.windowStartedAt = &now
+	} else {
+		sub.ConfirmationSends++
+	}
+	sub.ConfirmationSentAt = &now
+
+	return nil
+}
+
+func (ms *MemorySubscriptionStore) ConfirmationWait(_ context.Context, id int64, limits ConfirmationLimits) (time.Duration, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	sub, ok := ms.db.subscriptions[id]
+	if !ok {
+		return 0, ErrorNotFound
+	}
+
+	return limits.wait(ms.db.now(), sub.ConfirmationSentAt, sub.windowStartedAt, sub.ConfirmationSends), nil
+}
+
+func (ms *MemorySubscriptionStore) PurgeUnconfirmed(_ context.Context, age time.Duration) (int64, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	cutoff := ms.db.now().Add(-age)
+	var purged int64
+	for id, sub := range ms.db.subscriptions {
+		if sub.Status == models.StatusPending && !sub.Confirmed && sub.CreatedAt.Before(cutoff) {
+			delete(ms.db.subscriptions, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (ms *MemorySubscriptionStore) UpdatePreferences(_ context.Context, token string, update PreferencesUpdate) (models.Subscription, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	sub := ms.byToken(token)()
+	if sub == nil {
+		return models.Subscription{}, ErrorNotFound
+	}
+
+	frequency, units := sub.Frequency, sub.Units
+	if update.Frequency != nil {
+		frequency = *update.Frequency
+	}
+	if update.Units != nil {
+		units = *update.Units
+	}
+	if err := validateSubscription(frequency, units); err != nil {
+		return models.Subscription{}, errors.Wrap(err, "failed to update subscription preferences")
+	}
+
+	if update.City != nil {
+		sub.City = *update.City
+	}
+	if update.AlertSeverities != nil {
+		sub.AlertSeverities = slices.Clone(*update.AlertSeverities)
+	}
+	if update.AirQualityThreshold != nil {
+		sub.AirQualityThreshold = *update.AirQualityThreshold
+	}
+	if update.WebhookURL != nil {
+		sub.WebhookURL, sub.WebhookSecret = *update.WebhookURL, update.WebhookSecret
+		sub.WebhookFailures, sub.WebhookDisabledAt = 0, nil
+	}
+	sub.Frequency, sub.Units = frequency, units
+
+	return sub.copy(), nil
+}
+
+func (ms *MemorySubscriptionStore) ListActive(_ context.Context) ([]models.Subscription, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	subs := []models.Subscription{}
+	for _, sub := range ms.db.sorted() {
+		if sub.Status == models.StatusActive {
+			subs = append(subs, sub.copy())
+		}
+	}
+
+	return subs, nil
+}
+
+// The finders below must be called with db.mx held.
+
+func (ms *MemorySubscriptionStore) byID(id int64) func() *memorySubscription {
+	return func() *memorySubscription {
+		return ms.db.subscriptions[id]
+	}
+}
+
+func (ms *MemorySubscriptionStore) byToken(token string) func() *memorySubscription {
+	return ms.find(func(sub *memorySubscription) bool { return sub.Token == token })
+}
+
+func (ms *MemorySubscriptionStore) byEmail(email string) func() *memorySubscription {
+	return ms.find(func(sub *memorySubscription) bool { return sub.Email == email })
+}
+
+// byEmailFold ignores case like GetByEmail of the SQL stores: an exact match
+// wins, then the oldest one differing in case only.
+func (ms *MemorySubscriptionStore) byEmailFold(email string) func() *memorySubscription {
+	return func() *memorySubscription {
+		var found *memorySubscription
+		for _, sub := range ms.db.subscriptions {
+			if sub.Email == email {
+				return sub
+			}
+			if strings.EqualFold(sub.Email, email) && (found == nil || sub.ID < found.ID) {
+				found = sub
+			}
+		}
+		return found
+	}
+}
+
+func (ms *MemorySubscriptionStore) find(match func(*memorySubscription) bool) func() *memorySubscription {
+	return func() *memorySubscription {
+		for _, sub := range ms.db.subscriptions {
+			if match(sub) {
+				return sub
+			}
+		}
+		return nil
+	}
+}
+
+func (db *memoryDB) sorted() []*memorySubscription {
+	subs := make([]*memorySubscription, 0, len(db.subscriptions))
+	for _, sub := range db.subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].ID < subs[j].ID })
+	return subs
+}
+
+func (db *memoryDB) record(id int64, email string, from *string, to, reason string) {
+	db.nextEventID++
+	db.history = append(db.history, models.SubscriptionEvent{
+		ID:             db.nextEventID,
+		SubscriptionID: id,
+		Email:          email,
+		FromStatus:     from,
+		ToStatus:       to,
+		Reason:         reason,
+		ChangedAt:      db.now(),
+	})
+}
+
+func (sub *memorySubscription) copy() models.Subscription {
+	c := sub.Subscription
+	c.PausedUntil = copyTime(c.PausedUntil)
+	c.ConfirmationSentAt = copyTime(c.ConfirmationSentAt)
+	c.WebhookDisabledAt = copyTime(c.WebhookDisabledAt)
+	c.AlertSeverities = slices.Clone(c.AlertSeverities)
+	return c
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+// validateSubscription stands in for the enum and check constraints.
+func validateSubscription(frequency, units string) error {
+	if frequency != models.Hourly && frequency != models.Daily {
+		return errors.Errorf("invalid frequency %q", frequency)
+	}
+	if units != models.Metric && units != models.Imperial {
+		return errors.Errorf("invalid units %q", units)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"weather/internal/models"
+)
+
+type memoryAlertDelivery struct {
+	alertID        string
+	subscriptionID int64
+}
+
+type MemoryAlertStore struct {
+	db *memoryDB
+}
+
+func (ms *MemoryAlertStore) Record(_ context.Context, alert *models.Alert) (bool, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	for _, stored := range ms.db.alerts {
+		if stored.ID == alert.ID && stored.City == alert.City {
+			return false, nil
+		}
+	}
+
+	alert.ReceivedAt = ms.db.now()
+	ms.db.alerts = append(ms.db.alerts, *alert)
+
+	return true, nil
+}
+
+func (ms *MemoryAlertStore) List(_ context.Context, city string, limit int) ([]models.Alert, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	alerts := []models.Alert{}
+	for _, alert := range ms.db.alerts {
+		if strings.EqualFold(alert.City, city) {
+			alerts = append(alerts, alert)
+		}
+	}
+	slices.SortStableFunc(alerts, func(a, b models.Alert) int {
+		if c := b.ReceivedAt.Compare(a.ReceivedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return alerts[:min(limit, len(alerts))], nil
+}
+
+func (ms *MemoryAlertStore) ClaimDelivery(_ context.Context, alertID string, subscriptionID int64) (bool, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	key := memoryAlertDelivery{alertID: alertID, subscriptionID: subscriptionID}
+	if _, ok := ms.db.alertDeliveries[key]; ok {
+		return false, nil
+	}
+	ms.db.alertDeliveries[key] = ms.db.now()
+
+	return true, nil
+}
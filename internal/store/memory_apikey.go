@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"weather/internal/models"
+)
+
+type memoryAPIKey struct {
+	models.APIKey
+	hash string
+}
+
+type MemoryAPIKeyStore struct {
+	db *memoryDB
+}
+
+func (ms *MemoryAPIKeyStore) Create(_ context.Context, key *models.APIKey, hash string) error {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	for _, existing := range ms.db.apiKeys {
+		if existing.hash == hash {
+			return ErrorAlreadyExists
+		}
+	}
+
+	ms.db.nextKeyID++
+	key.ID = ms.db.nextKeyID
+	key.CreatedAt = ms.db.now()
+
+	stored := &memoryAPIKey{APIKey: *key, hash: hash}
+	stored.Scopes = slices.Clone(key.Scopes)
+	if stored.Scopes == nil {
+		stored.Scopes = []string{}
+	}
+	ms.db.apiKeys[key.ID] = stored
+
+	return nil
+}
+
+func (ms *MemoryAPIKeyStore) GetActiveByHash(_ context.Context, hash string) (models.APIKey, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	for _, key := range ms.db.apiKeys {
+		if key.hash == hash && key.RevokedAt == nil {
+			return key.copy(), nil
+		}
+	}
+
+	return models.APIKey{}, ErrorNotFound
+}
+
+func (ms *MemoryAPIKeyStore) TrackUsage(_ context.Context, id int64) error {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	if key, ok := ms.db.apiKeys[id]; ok {
+		now := ms.db.now()
+		key.UsageCount++
+		key.LastUsedAt = &now
+	}
+
+	return nil
+}
+
+func (ms *MemoryAPIKeyStore) Revoke(_ context.Context, id int64) (models.APIKey, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	key, ok := ms.db.apiKeys[id]
+	if !ok || key.RevokedAt != nil {
+		return models.APIKey{}, ErrorNotFound
+	}
+	now := ms.db.now()
+	key.RevokedAt = &now
+
+	return key.copy(), nil
+}
+
+func (ms *MemoryAPIKeyStore) List(_ context.Context) ([]models.APIKey, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	keys := []models.APIKey{}
+	for _, key := range ms.db.apiKeys {
+		keys = append(keys, key.copy())
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	return keys, nil
+}
+
+func (key *memoryAPIKey) copy() models.APIKey {
+	c := key.APIKey
+	c.Scopes = slices.Clone(c.Scopes)
+	c.LastUsedAt = copyTime(c.LastUsedAt)
+	c.RevokedAt = copyTime(c.RevokedAt)
+	return c
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+	"weather/internal/models"
+)
+
+type MemoryObservationStore struct {
+	db *memoryDB
+}
+
+func (ms *MemoryObservationStore) Add(_ context.Context, obs *models.Observation) error {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	if obs.ObservedAt.IsZero() {
+		obs.ObservedAt = ms.db.now()
+	}
+	ms.db.nextObservationID++
+	obs.ID = ms.db.nextObservationID
+
+	stored := *obs
+	stored.Raw = slices.Clone(obs.Raw)
+	ms.db.observations = append(ms.db.observations, stored)
+
+	return nil
+}
+
+func (ms *MemoryObservationStore) Aggregate(_ context.Context, city string, from, to time.Time, bucket time.Duration) ([]models.ObservationBucket, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	type sums struct {
+		temperature float64
+		humidity    float64
+	}
+
+	buckets := map[time.Time]*models.ObservationBucket{}
+	totals := map[time.Time]*sums{}
+	for _, obs := range ms.db.observations {
+		if !strings.EqualFold(obs.City, city) || obs.ObservedAt.Before(from) || !obs.ObservedAt.Before(to) {
+			continue
+		}
+
+		// Truncate counts from the zero time, a whole number of days before
+		// the Unix epoch, so hours and days match the SQL buckets
+		start := obs.ObservedAt.UTC().Truncate(bucket)
+		humidity := float64(obs.Humidity)
+		b, ok := buckets[start]
+		if !ok {
+			b = &models.ObservationBucket{
+				Start:       start,
+				Temperature: models.Aggregate{Min: obs.Temperature, Max: obs.Temperature},
+				Humidity:    models.Aggregate{Min: humidity, Max: humidity},
+			}
+			buckets[start] = b
+			totals[start] = &sums{}
+		}
+
+		b.Count++
+		b.Temperature.Min = min(b.Temperature.Min, obs.Temperature)
+		b.Temperature.Max = max(b.Temperature.Max, obs.Temperature)
+		b.Humidity.Min = min(b.Humidity.Min, humidity)
+		b.Humidity.Max = max(b.Humidity.Max, humidity)
+		totals[start].temperature += obs.Temperature
+		totals[start].humidity += humidity
+	}
+
+	result := make([]models.ObservationBucket, 0, len(buckets))
+	for start, b := range buckets {
+		b.Temperature.Avg = totals[start].temperature / float64(b.Count)
+		b.Humidity.Avg = totals[start].humidity / float64(b.Count)
+		result = append(result, *b)
+	}
+	slices.SortFunc(result, func(a, b models.ObservationBucket) int { return a.Start.Compare(b.Start) })
+
+	return result, nil
+}
+
+func (ms *MemoryObservationStore) Purge(_ context.Context, age time.Duration) (int64, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	cutoff := ms.db.now().Add(-age)
+	before := len(ms.db.observations)
+	ms.db.observations = slices.DeleteFunc(ms.db.observations, func(obs models.Observation) bool {
+		return obs.ObservedAt.Before(cutoff)
+	})
+
+	return int64(before - len(ms.db.observations)), nil
+}
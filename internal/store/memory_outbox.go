@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+	"weather/internal/models"
+)
+
+type MemoryOutboxStore struct {
+	db *memoryDB
+}
+
+func (ms *MemoryOutboxStore) Add(_ context.Context, msg *models.OutboxMessage) error {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	now := ms.db.now()
+	ms.db.nextOutboxID++
+	msg.ID = ms.db.nextOutboxID
+	msg.AvailableAt = now
+	msg.CreatedAt = now
+
+	stored := &models.OutboxMessage{
+		ID:          msg.ID,
+		Topic:       msg.Topic,
+		Payload:     slices.Clone(msg.Payload),
+		AvailableAt: now,
+		CreatedAt:   now,
+	}
+	ms.db.outbox[stored.ID] = stored
+
+	return nil
+}
+
+func (ms *MemoryOutboxStore) Claim(_ context.Context, topics []string, limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	now := ms.db.now()
+	due := []*models.OutboxMessage{}
+	for _, msg := range ms.db.outbox {
+		if msg.SentAt == nil && msg.FailedAt == nil && !msg.AvailableAt.After(now) && slices.Contains(topics, msg.Topic) {
+			due = append(due, msg)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+
+	msgs := []models.OutboxMessage{}
+	for _, msg := range due[:min(len(due), max(limit, 0))] {
+		msg.Attempts++
+		msg.AvailableAt = now.Add(lease)
+		msgs = append(msgs, copyOutboxMessage(msg))
+	}
+
+	return msgs, nil
+}
+
+func (ms *MemoryOutboxStore) MarkSent(_ context.Context, id int64) error {
+	return ms.update(id, func(msg *models.OutboxMessage) {
+		now := ms.db.now()
+		msg.SentAt = &now
+		msg.LastError = ""
+	})
+}
+
+func (ms *MemoryOutboxStore) Retry(_ context.Context, id int64, at time.Time, reason string) error {
+	return ms.update(id, func(msg *models.OutboxMessage) {
+		msg.AvailableAt = at
+		msg.LastError = reason
+	})
+}
+
+func (ms *MemoryOutboxStore) MarkFailed(_ context.Context, id int64, reason string) error {
+	return ms.update(id, func(msg *models.OutboxMessage) {
+		now := ms.db.now()
+		msg.FailedAt = &now
+		msg.LastError = reason
+	})
+}
+
+func (ms *MemoryOutboxStore) PurgeSent(_ context.Context, age time.Duration) (int64, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	cutoff := ms.db.now().Add(-age)
+	var purged int64
+	for id, msg := range ms.db.outbox {
+		if msg.SentAt != nil && msg.SentAt.Before(cutoff) {
+			delete(ms.db.outbox, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (ms *MemoryOutboxStore) update(id int64, change func(*models.OutboxMessage)) error {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	msg, ok := ms.db.outbox[id]
+	if !ok {
+		return ErrorNotFound
+	}
+	change(msg)
+
+	return nil
+}
+
+func copyOutboxMessage(msg *models.OutboxMessage) models.OutboxMessage {
+	c := *msg
+	c.Payload = slices.Clone(msg.Payload)
+	c.SentAt = copyTime(msg.SentAt)
+	c.FailedAt = copyTime(msg.FailedAt)
+	return c
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	"time"
+	"weather/internal/models"
+)
+
+type memoryDelivery struct {
+	subscriptionID int64
+	window         time.Time
+	previousWindow *time.Time
+	createdAt      time.Time
+}
+
+type MemoryScheduleStore struct {
+	db *memoryDB
+}
+
+func (ms *MemoryScheduleStore) LastRun(_ context.Context, frequency string) (models.ScheduleRun, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	run, ok := ms.db.runs[frequency]
+	if !ok {
+		return models.ScheduleRun{}, ErrorNotFound
+	}
+	return run, nil
+}
+
+func (ms *MemoryScheduleStore) RecordRun(_ context.Context, run models.ScheduleRun) error {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	if last, ok := ms.db.runs[run.Frequency]; ok && last.LastWindow.After(run.LastWindow) {
+		return nil
+	}
+	run.FinishedAt = ms.db.now()
+	ms.db.runs[run.Frequency] = run
+
+	return nil
+}
+
+func (ms *MemoryScheduleStore) ClaimDigest(_ context.Context, key string, id int64, window time.Time) (bool, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	if _, ok := ms.db.deliveries[key]; ok {
+		return false, nil
+	}
+	sub, ok := ms.db.subscriptions[id]
+	if !ok || (sub.lastSentWindow != nil && !sub.lastSentWindow.Before(window)) {
+		return false, nil
+	}
+
+	ms.db.deliveries[key] = memoryDelivery{subscriptionID: id, window: window, previousWindow: sub.lastSentWindow, createdAt: ms.db.now()}
+	sub.lastSentWindow = &window
+
+	return true, nil
+}
+
+func (ms *MemoryScheduleStore) ReleaseDigest(_ context.Context, key string, id int64, window time.Time) error {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	delivery, ok := ms.db.deliveries[key]
+	if !ok {
+		return nil
+	}
+	delete(ms.db.deliveries, key)
+	if sub, ok := ms.db.subscriptions[id]; ok && sub.lastSentWindow != nil && sub.lastSentWindow.Equal(window) {
+		sub.lastSentWindow = delivery.previousWindow
+	}
+
+	return nil
+}
+
+func (ms *MemoryScheduleStore) PurgeDeliveries(_ context.Context, age time.Duration) (int64, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	cutoff := ms.db.now().Add(-age)
+	var purged int64
+	for key, d := range ms.db.deliveries {
+		if d.createdAt.Before(cutoff) {
+			delete(ms.db.deliveries, key)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
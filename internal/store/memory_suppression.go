@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"weather/internal/models"
+)
+
+type MemorySuppressionStore struct {
+	db *memoryDB
+}
+
+func (ms *MemorySuppressionStore) Add(_ context.Context, s *models.Suppression) error {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	email := normalizeEmail(s.Email)
+	existing, ok := ms.db.suppressions[email]
+	if !ok {
+		existing = models.Suppression{Email: email, Reason: s.Reason, Source: s.Source, CreatedAt: ms.db.now()}
+		ms.db.suppressions[email] = existing
+	}
+	*s = existing
+
+	return nil
+}
+
+func (ms *MemorySuppressionStore) Remove(_ context.Context, email string) error {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	email = normalizeEmail(email)
+	if _, ok := ms.db.suppressions[email]; !ok {
+		return ErrorNotFound
+	}
+	delete(ms.db.suppressions, email)
+
+	return nil
+}
+
+func (ms *MemorySuppressionStore) IsSuppressed(_ context.Context, email string) (bool, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	_, ok := ms.db.suppressions[normalizeEmail(email)]
+	return ok, nil
+}
+
+func (ms *MemorySuppressionStore) List(_ context.Context) ([]models.Suppression, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	list := []models.Suppression{}
+	for _, s := range ms.db.suppressions {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+
+	return list, nil
+}
@@ -0,0 +1,16 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"weather/internal/clock"
+	"weather/internal/store"
+	"weather/internal/store/storetest"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	if err := storetest.Run(context.Background(), store.NewMemoryStorage(clock.Real{})); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"time"
+	"weather/internal/models"
+)
+
+type MemoryWebhookStore struct {
+	db *memoryDB
+}
+
+func (ms *MemoryWebhookStore) AddDelivery(_ context.Context, delivery *models.WebhookDelivery) error {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	ms.db.nextWebhookDeliveryID++
+	delivery.ID = ms.db.nextWebhookDeliveryID
+	delivery.CreatedAt = ms.db.now()
+	ms.db.webhookDeliveries = append(ms.db.webhookDeliveries, *delivery)
+
+	return nil
+}
+
+func (ms *MemoryWebhookStore) ListDeliveries(_ context.Context, subscriptionID int64, limit int) ([]models.WebhookDelivery, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	deliveries := []models.WebhookDelivery{}
+	for _, d := range slices.Backward(ms.db.webhookDeliveries) {
+		if len(deliveries) == limit {
+			break
+		}
+		if d.SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, d)
+		}
+	}
+
+	return deliveries, nil
+}
+
+func (ms *MemoryWebhookStore) PurgeDeliveries(_ context.Context, age time.Duration) (int64, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	cutoff := ms.db.now().Add(-age)
+	before := len(ms.db.webhookDeliveries)
+	ms.db.webhookDeliveries = slices.DeleteFunc(ms.db.webhookDeliveries, func(d models.WebhookDelivery) bool {
+		return d.CreatedAt.Before(cutoff)
+	})
+
+	return int64(before - len(ms.db.webhookDeliveries)), nil
+}
+
+func (ms *MemoryWebhookStore) RecordSuccess(_ context.Context, subscriptionID int64) error {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	if sub, ok := ms.db.subscriptions[subscriptionID]; ok {
+		sub.WebhookFailures = 0
+	}
+
+	return nil
+}
+
+func (ms *MemoryWebhookStore) RecordFailure(_ context.Context, subscriptionID int64, maxFailures int) (models.Subscription, error) {
+	ms.db.mx.Lock()
+	defer ms.db.mx.Unlock()
+
+	sub, ok := ms.db.subscriptions[subscriptionID]
+	if !ok {
+		return models.Subscription{}, ErrorNotFound
+	}
+
+	sub.WebhookFailures++
+	if sub.WebhookDisabledAt == nil && sub.WebhookFailures >= maxFailures {
+		now := ms.db.now()
+		sub.WebhookDisabledAt = &now
+	}
+
+	return sub.copy(), nil
+}
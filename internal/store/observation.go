@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"time"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+type ObservationStore struct {
+	db dbtx
+}
+
+// Add records obs, observed now unless ObservedAt is set.
+func (o *ObservationStore) Add(ctx context.Context, obs *models.Observation) error {
+	const query = `
+        INSERT INTO weather.observations (city, provider, temperature, humidity, condition, raw, observed_at)
+        VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7::timestamptz, now()))
+        RETURNING id, observed_at;
+    `
+
+	var observedAt *time.Time
+	if !obs.ObservedAt.IsZero() {
+		observedAt = &obs.ObservedAt
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := o.db.
+		QueryRowContext(ctx, query, obs.City, obs.Provider, obs.Temperature, obs.Humidity, obs.Condition, string(obs.Raw), observedAt).
+		Scan(&obs.ID, &obs.ObservedAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to add observation")
+	}
+
+	return nil
+}
+
+// Aggregate summarises the observations of city within [from, to) per bucket,
+// counted from the Unix epoch so hours and days start on UTC boundaries.
+// Buckets without observations are left out.
+func (o *ObservationStore) Aggregate(ctx context.Context, city string, from, to time.Time, bucket time.Duration) ([]models.ObservationBucket, error) {
+	const query = `
+        SELECT to_timestamp(floor(extract(epoch FROM observed_at) / $4::float8) * $4::float8) AS bucket,
+               count(*),
+               min(temperature), max(temperature), avg(temperature),
+               min(humidity), max(humidity), avg(humidity)
+        FROM weather.observations
+        WHERE lower(city) = lower($1)
+          AND observed_at >= $2
+          AND observed_at < $3
+        GROUP BY bucket
+        ORDER BY bucket;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := o.db.QueryContext(ctx, query, city, from, to, bucket.Seconds())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to aggregate observations")
+	}
+	defer rows.Close()
+
+	buckets := []models.ObservationBucket{}
+	for rows.Next() {
+		var b models.ObservationBucket
+		if err := rows.Scan(bucketDest(&b.Start, &b)...); err != nil {
+			return nil, errors.Wrap(err, "failed to scan observation bucket")
+		}
+		b.Start = b.Start.UTC()
+		buckets = append(buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to aggregate observations")
+	}
+
+	return buckets, nil
+}
+
+// Purge deletes observations older than age.
+func (o *ObservationStore) Purge(ctx context.Context, age time.Duration) (int64, error) {
+	const query = `
+        DELETE FROM weather.observations
+        WHERE observed_at < now() - $1 * interval '1 second';
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := o.db.ExecContext(ctx, query, age.Seconds())
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge observations")
+	}
+
+	return res.RowsAffected()
+}
+
+// bucketDest lists the scan destinations of an aggregate row, start differs
+// between Postgres and SQLite.
+func bucketDest(start any, b *models.ObservationBucket) []any {
+	return []any{
+		start,
+		&b.Count,
+		&b.Temperature.Min, &b.Temperature.Max, &b.Temperature.Avg,
+		&b.Humidity.Min, &b.Humidity.Max, &b.Humidity.Avg,
+	}
+}
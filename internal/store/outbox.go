@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"time"
+	"weather/internal/models"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const outboxColumns = `id, topic, payload, attempts, available_at, created_at, sent_at, failed_at, last_error`
+
+type OutboxStore struct {
+	db dbtx
+}
+
+// Add queues msg, usually inside Storage.WithTx next to the change it belongs to.
+func (ob *OutboxStore) Add(ctx context.Context, msg *models.OutboxMessage) error {
+	const query = `
+        INSERT INTO weather.outbox (topic, payload)
+        VALUES ($1, $2)
+        RETURNING id, available_at, created_at;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := ob.db.
+		QueryRowContext(ctx, query, msg.Topic, string(msg.Payload)).
+		Scan(&msg.ID, &msg.AvailableAt, &msg.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to add outbox message")
+	}
+
+	return nil
+}
+
+// Claim leases up to limit due messages of topics, oldest first, by moving
+// their available_at past lease and counting the attempt. Replicas skip
+// messages another one is claiming, and a relay dying mid-delivery only
+// delays them.
+func (ob *OutboxStore) Claim(ctx context.Context, topics []string, limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	const query = `
+        WITH claimed AS (
+            UPDATE weather.outbox
+            SET attempts = attempts + 1,
+                available_at = now() + $2 * interval '1 second'
+            WHERE id IN (
+                SELECT id
+                FROM weather.outbox
+                WHERE sent_at IS NULL
+                  AND failed_at IS NULL
+                  AND available_at <= now()
+                  AND topic = ANY($3)
+                ORDER BY id
+                LIMIT $1
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING ` + outboxColumns + `
+        )
+        SELECT ` + outboxColumns + `
+        FROM claimed
+        ORDER BY id;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ob.db.QueryContext(ctx, query, limit, lease.Seconds(), pq.Array(topics))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to claim outbox messages")
+	}
+	defer rows.Close()
+
+	msgs := []models.OutboxMessage{}
+	for rows.Next() {
+		msg, err := scanOutboxMessage(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan outbox message")
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to claim outbox messages")
+	}
+
+	return msgs, nil
+}
+
+func (ob *OutboxStore) MarkSent(ctx context.Context, id int64) error {
+	const query = `
+        UPDATE weather.outbox
+        SET sent_at = now(),
+            last_error = ''
+        WHERE id = $1;
+    `
+
+	return ob.update(ctx, "failed to mark outbox message sent", query, id)
+}
+
+// Retry makes a failed message due again at the given time.
+func (ob *OutboxStore) Retry(ctx context.Context, id int64, at time.Time, reason string) error {
+	const query = `
+        UPDATE weather.outbox
+        SET available_at = $2,
+            last_error = $3
+        WHERE id = $1;
+    `
+
+	return ob.update(ctx, "failed to reschedule outbox message", query, id, at, reason)
+}
+
+// MarkFailed gives up on a message, it stays in the table for inspection.
+func (ob *OutboxStore) MarkFailed(ctx context.Context, id int64, reason string) error {
+	const query = `
+        UPDATE weather.outbox
+        SET failed_at = now(),
+            last_error = $2
+        WHERE id = $1;
+    `
+
+	return ob.update(ctx, "failed to mark outbox message failed", query, id, reason)
+}
+
+// PurgeSent deletes delivered messages older than age.
+func (ob *OutboxStore) PurgeSent(ctx context.Context, age time.Duration) (int64, error) {
+	const query = `
+        DELETE FROM weather.outbox
+        WHERE sent_at < now() - $1 * interval '1 second';
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ob.db.ExecContext(ctx, query, age.Seconds())
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge sent outbox messages")
+	}
+
+	return res.RowsAffected()
+}
+
+func (ob *OutboxStore) update(ctx context.Context, message, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ob.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, message)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+func scanOutboxMessage(row scanner) (models.OutboxMessage, error) {
+	var (
+		msg     models.OutboxMessage
+		payload []byte
+	)
+	err := row.Scan(
+		&msg.ID,
+		&msg.Topic,
+		&payload,
+		&msg.Attempts,
+		&msg.AvailableAt,
+		&msg.CreatedAt,
+		&msg.SentAt,
+		&msg.FailedAt,
+		&msg.LastError,
+	)
+	msg.Payload = payload
+	return msg, err
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"weather/internal/models"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+type ScheduleStore struct {
+	db dbtx
+}
+
+// LastRun returns ErrorNotFound when the schedule never ran.
+func (ss *ScheduleStore) LastRun(ctx context.Context, frequency string) (models.ScheduleRun, error) {
+	const query = `
+        SELECT frequency, last_window, finished_at, sent, skipped, failed
+        FROM weather.schedule_runs
+        WHERE frequency = $1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var run models.ScheduleRun
+	err := ss.db.QueryRowContext(ctx, query, frequency).
+		Scan(&run.Frequency, &run.LastWindow, &run.FinishedAt, &run.Sent, &run.Skipped, &run.Failed)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return run, ErrorNotFound
+		}
+		return run, errors.Wrap(err, "failed to get last schedule run")
+	}
+
+	return run, nil
+}
+
+// RecordRun stores run unless a later window was already recorded.
+func (ss *ScheduleStore) RecordRun(ctx context.Context, run models.ScheduleRun) error {
+	const query = `
+        INSERT INTO weather.schedule_runs (frequency, last_window, sent, skipped, failed)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (frequency) DO UPDATE
+        SET last_window = EXCLUDED.last_window,
+            finished_at = now(),
+            sent = EXCLUDED.sent,
+            skipped = EXCLUDED.skipped,
+            failed = EXCLUDED.failed
+        WHERE schedule_runs.last_window <= EXCLUDED.last_window;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ss.db.ExecContext(ctx, query, run.Frequency, run.LastWindow, run.Sent, run.Skipped, run.Failed)
+	if err != nil {
+		return errors.Wrap(err, "failed to record schedule run")
+	}
+
+	return nil
+}
+
+// ClaimDigest records the idempotency key of one digest before it is sent,
+// together with advancing last_sent_window: either both happen or neither.
+// It reports false when the key exists, i.e. another run or replica already
+// took this (subscription, window), or when the subscription already got this
+// or a later window. The window it replaced is kept with the key for
+// ReleaseDigest.
+func (ss *ScheduleStore) ClaimDigest(ctx context.Context, key string, id int64, window time.Time) (bool, error) {
+	// FOR UPDATE waits for a concurrent claim and then reads the window it
+	// set, so of two claims of one window only the first advances. A key
+	// taken all the same fails the statement, the update with it.
+	const query = `
+        WITH previous AS (
+            SELECT id, last_sent_window
+            FROM weather.subscriptions
+            WHERE id = $2
+              AND NOT EXISTS (SELECT 1 FROM weather.digest_deliveries WHERE idempotency_key = $1)
+            FOR UPDATE
+        ), advanced AS (
+            UPDATE weather.subscriptions s
+            SET last_sent_window = $3
+            FROM previous p
+            WHERE s.id = p.id
+              AND (p.last_sent_window IS NULL OR p.last_sent_window < $3)
+            RETURNING s.id, p.last_sent_window
+        )
+        INSERT INTO weather.digest_deliveries (idempotency_key, subscription_id, window_start, previous_window)
+        SELECT $1, id, $3, last_sent_window FROM advanced;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ss.db.ExecContext(ctx, query, key, id, window)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to claim digest")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to claim digest")
+	}
+
+	return n == 1, nil
+}
+
+// ReleaseDigest undoes a claim after a failed send so a retry may deliver it,
+// putting back the window the claim replaced.
+func (ss *ScheduleStore) ReleaseDigest(ctx context.Context, key string, id int64, window time.Time) error {
+	const query = `
+        WITH released AS (
+            DELETE FROM weather.digest_deliveries
+            WHERE idempotency_key = $1
+            RETURNING previous_window
+        )
+        UPDATE weather.subscriptions
+        SET last_sent_window = (SELECT previous_window FROM released)
+        WHERE id = $2 AND last_sent_window = $3
+          AND EXISTS (SELECT 1 FROM released);
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := ss.db.ExecContext(ctx, query, key, id, window); err != nil {
+		return errors.Wrap(err, "failed to release digest")
+	}
+
+	return nil
+}
+
+// PurgeDeliveries drops idempotency keys of windows long gone.
+func (ss *ScheduleStore) PurgeDeliveries(ctx context.Context, age time.Duration) (int64, error) {
+	const query = `
+        DELETE FROM weather.digest_deliveries
+        WHERE created_at < now() - $1 * interval '1 second';
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ss.db.ExecContext(ctx, query, age.Seconds())
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge digest deliveries")
+	}
+
+	return res.RowsAffected()
+}
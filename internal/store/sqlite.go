@@ -0,0 +1,603 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"weather/internal/clock"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteDB is a database opened by database.New with the sqlite driver. SQLite
+// has no now() that follows a fake clock and compares times as text, so every
+// time is taken from the clock in Go and written in UTC.
+type sqliteDB struct {
+	dbtx
+	clock clock.Clock
+}
+
+// NewSQLiteStorage backs the repositories with a SQLite database. It follows
+// the Postgres storage in ordering and in the errors it returns.
+func NewSQLiteStorage(db *sql.DB, clk clock.Clock) Storage {
+	return sqlStorage(db, func(db dbtx) Storage {
+		sdb := &sqliteDB{dbtx: db, clock: clk}
+		return Storage{
+			Subscription: &SQLiteSubscriptionStore{sdb},
+			APIKey:       &SQLiteAPIKeyStore{sdb},
+			Suppression:  &SQLiteSuppressionStore{sdb},
+			Schedule:     &SQLiteScheduleStore{sdb},
+			Outbox:       &SQLiteOutboxStore{sdb},
+			Observation:  &SQLiteObservationStore{sdb},
+			Alert:        &SQLiteAlertStore{sdb},
+			Webhook:      &SQLiteWebhookStore{sdb},
+		}
+	})
+}
+
+func (db *sqliteDB) now() time.Time {
+	return db.clock.Now().UTC()
+}
+
+func (db *sqliteDB) since(age time.Duration) time.Time {
+	return db.now().Add(-age)
+}
+
+// isUniqueViolation reports a failed UNIQUE or PRIMARY KEY constraint.
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+type SQLiteSubscriptionStore struct {
+	db *sqliteDB
+}
+
+func (ss *SQLiteSubscriptionStore) Create(ctx context.Context, sub *models.Subscription) error {
+	const insertQuery = `
+        INSERT INTO subscriptions (email, city, frequency, units, token, status_changed_at, created_at, channel, chat_id)
+        VALUES ($1, $2, $3, $4, $5, $6, $6, $7, $8)
+        ON CONFLICT (email) DO NOTHING
+        RETURNING id, status;
+    `
+	const historyQuery = `
+        INSERT INTO subscription_history (subscription_id, email, from_status, to_status, reason, changed_at)
+        VALUES ($1, $2, NULL, $3, 'subscribed', $4);
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	now := ss.db.now()
+
+	var status string
+	err := inTx(ctx, ss.db.dbtx, func(tx dbtx) error {
+		err := tx.QueryRowContext(ctx, insertQuery, sub.Email, sub.City, sub.Frequency, sub.Units, sub.Token, now, channelOf(*sub), sub.ChatID).
+			Scan(&sub.ID, &status)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrorAlreadyExists
+			}
+			return errors.Wrap(err, "failed to create subscription")
+		}
+
+		if _, err := tx.ExecContext(ctx, historyQuery, sub.ID, sub.Email, status, now); err != nil {
+			return errors.Wrap(err, "failed to record subscription history")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sub.Status = status
+
+	return nil
+}
+
+func (ss *SQLiteSubscriptionStore) Confirm(ctx context.Context, token string) (models.Subscription, error) {
+	return ss.transition(ctx, "token = $1", token, models.StatusActive, "confirmed by link", nil)
+}
+
+func (ss *SQLiteSubscriptionStore) Unsubscribe(ctx context.Context, token string) (models.Subscription, error) {
+	return ss.transition(ctx, "token = $1", token, models.StatusUnsubscribed, "unsubscribed by link", nil)
+}
+
+func (ss *SQLiteSubscriptionStore) Transition(ctx context.Context, id int64, to, reason string) (models.Subscription, error) {
+	return ss.transition(ctx, "id = $1", id, to, reason, nil)
+}
+
+func (ss *SQLiteSubscriptionStore) ConfirmByID(ctx context.Context, id int64) (models.Subscription, error) {
+	return ss.transition(ctx, "id = $1", id, models.StatusActive, "confirmed by admin", nil)
+}
+
+func (ss *SQLiteSubscriptionStore) Pause(ctx context.Context, token string, until *time.Time) (models.Subscription, error) {
+	reason := "paused indefinitely"
+	if until != nil {
+		reason = "paused until " + until.UTC().Format(time.RFC3339)
+	}
+	return ss.transition(ctx, "token = $1", token, models.StatusPaused, reason, until)
+}
+
+func (ss *SQLiteSubscriptionStore) Resume(ctx context.Context, token string) (models.Subscription, error) {
+	return ss.transition(ctx, "token = $1", token, models.StatusActive, "resumed by subscriber", nil)
+}
+
+// transition runs in an immediate transaction, which holds the database write
+// lock from the select on like FOR UPDATE does in Postgres.
+func (ss *SQLiteSubscriptionStore) transition(ctx context.Context, where string, arg any, to, reason string, pausedUntil *time.Time) (models.Subscription, error) {
+	selectQuery := `
+        SELECT ` + subscriptionColumns + `
+        FROM subscriptions
+        WHERE ` + where + `;
+    `
+	const updateQuery = `
+        UPDATE subscriptions
+        SET status = $2,
+            status_changed_at = $4,
+            paused_until = $3,
+            confirmed = confirmed OR $2 = 'active'
+        WHERE id = $1
+        RETURNING ` + subscriptionColumns + `;
+    `
+	const historyQuery = `
+        INSERT INTO subscription_history (subscription_id, email, from_status, to_status, reason, changed_at)
+        VALUES ($1, $2, $3, $4, $5, $6);
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var result models.Subscription
+	err := inTx(ctx, ss.db.dbtx, func(tx dbtx) error {
+		current, err := scanSubscription(tx.QueryRowContext(ctx, selectQuery, arg))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrorNotFound
+			}
+			return errors.Wrap(err, "failed to get subscription")
+		}
+
+		result = current
+		if !models.CanTransition(current.Status, to) {
+			return ErrorInvalidTransition
+		}
+		if current.Status == to && to != models.StatusPaused {
+			return nil
+		}
+
+		now := ss.db.now()
+		result, err = scanSubscription(tx.QueryRowContext(ctx, updateQuery, current.ID, to, utcPtr(pausedUntil), now))
+		if err != nil {
+			return errors.Wrapf(err, "failed to move subscription to %s", to)
+		}
+
+		if _, err := tx.ExecContext(ctx, historyQuery, current.ID, current.Email, current.Status, to, reason, now); err != nil {
+			return errors.Wrap(err, "failed to record subscription history")
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrorInvalidTransition) {
+		return models.Subscription{}, err
+	}
+
+	return result, err
+}
+
+func (ss *SQLiteSubscriptionStore) ResumeExpired(ctx context.Context) ([]models.Subscription, error) {
+	const updateQuery = `
+        UPDATE subscriptions
+        SET status = 'active',
+            status_changed_at = $1,
+            paused_until = NULL
+        WHERE status = 'paused'
+          AND paused_until IS NOT NULL
+          AND paused_until <= $1
+        RETURNING ` + subscriptionColumns + `;
+    `
+	const historyQuery = `
+        INSERT INTO subscription_history (subscription_id, email, from_status, to_status, reason, changed_at)
+        VALUES ($1, $2, 'paused', 'active', 'pause expired', $3);
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	now := ss.db.now()
+
+	var subs []models.Subscription
+	err := inTx(ctx, ss.db.dbtx, func(tx dbtx) error {
+		var err error
+		subs, err = collectSubscriptions(tx.QueryContext(ctx, updateQuery, now))
+		if err != nil {
+			return errors.Wrap(err, "failed to resume expired pauses")
+		}
+
+		for _, sub := range subs {
+			if _, err := tx.ExecContext(ctx, historyQuery, sub.ID, sub.Email, now); err != nil {
+				return errors.Wrap(err, "failed to record subscription history")
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+func (ss *SQLiteSubscriptionStore) History(ctx context.Context, id int64) ([]models.SubscriptionEvent, error) {
+	const query = `
+        SELECT id, subscription_id, email, from_status, to_status, reason, changed_at
+        FROM subscription_history
+        WHERE subscription_id = $1
+        ORDER BY changed_at, id;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ss.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get subscription history")
+	}
+	defer rows.Close()
+
+	events := []models.SubscriptionEvent{}
+	for rows.Next() {
+		var e models.SubscriptionEvent
+		if err := rows.Scan(&e.ID, &e.SubscriptionID, &e.Email, &e.FromStatus, &e.ToStatus, &e.Reason, &e.ChangedAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan subscription event")
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to get subscription history")
+	}
+
+	return events, nil
+}
+
+func (ss *SQLiteSubscriptionStore) List(ctx context.Context, filter SubscriptionFilter) ([]models.Subscription, int64, error) {
+	where, args := filter.where()
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var total int64
+	countQuery := "SELECT count(*) FROM subscriptions " + where
+	if err := ss.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count subscriptions")
+	}
+
+	query := fmt.Sprintf(`
+		SELECT `+subscriptionColumns+`
+		FROM subscriptions
+		%s
+		ORDER BY id
+		LIMIT $%d OFFSET $%d;
+	`, where, len(args)+1, len(args)+2)
+	args = append(args, filter.Limit, filter.Offset)
+
+	subs, err := collectSubscriptions(ss.db.QueryContext(ctx, query, args...))
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to list subscriptions")
+	}
+
+	return subs, total, nil
+}
+
+func (ss *SQLiteSubscriptionStore) GetByID(ctx context.Context, id int64) (models.Subscription, error) {
+	return ss.get(ctx, "id = $1", id)
+}
+
+func (ss *SQLiteSubscriptionStore) GetByEmail(ctx context.Context, email string) (models.Subscription, error) {
+	return ss.get(ctx, "lower(email) = lower($1) ORDER BY email = $1 DESC, id LIMIT 1", email)
+}
+
+func (ss *SQLiteSubscriptionStore) GetByToken(ctx context.Context, token string) (models.Subscription, error) {
+	return ss.get(ctx, "token = $1", token)
+}
+
+func (ss *SQLiteSubscriptionStore) get(ctx context.Context, where string, arg any) (models.Subscription, error) {
+	query := `
+        SELECT ` + subscriptionColumns + `
+        FROM subscriptions
+        WHERE ` + where + `;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	sub, err := scanSubscription(ss.db.QueryRowContext(ctx, query, arg))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Subscription{}, ErrorNotFound
+		}
+		return models.Subscription{}, errors.Wrap(err, "failed to get subscription")
+	}
+
+	return sub, nil
+}
+
+func (ss *SQLiteSubscriptionStore) Delete(ctx context.Context, id int64) (models.Subscription, error) {
+	const query = `
+        DELETE FROM subscriptions
+        WHERE id = $1
+        RETURNING ` + subscriptionColumns + `;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	sub, err := scanSubscription(ss.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Subscription{}, ErrorNotFound
+		}
+		return models.Subscription{}, errors.Wrap(err, "failed to delete subscription")
+	}
+
+	return sub, nil
+}
+
+func (ss *SQLiteSubscriptionStore) CountByCity(ctx context.Context) ([]models.CityStats, error) {
+	const query = `
+        SELECT city,
+               count(*),
+               count(*) FILTER (WHERE confirmed),
+               count(*) FILTER (WHERE status = 'active')
+        FROM subscriptions
+        GROUP BY city
+        ORDER BY count(*) DESC, city;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ss.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count subscriptions per city")
+	}
+	defer rows.Close()
+
+	stats := []models.CityStats{}
+	for rows.Next() {
+		var s models.CityStats
+		if err := rows.Scan(&s.City, &s.Total, &s.Confirmed, &s.Active); err != nil {
+			return nil, errors.Wrap(err, "failed to scan city stats")
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to count subscriptions per city")
+	}
+
+	return stats, nil
+}
+
+func (ss *SQLiteSubscriptionStore) UpdatePending(ctx context.Context, sub *models.Subscription) error {
+	const query = `
+        UPDATE subscriptions
+        SET city = $2,
+            frequency = $3,
+            units = $4,
+            token = COALESCE(NULLIF($5, ''), token)
+        WHERE email = $1 AND status = 'pending'
+        RETURNING ` + subscriptionColumns + `;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	updated, err := scanSubscription(ss.db.QueryRowContext(ctx, query, sub.Email, sub.City, sub.Frequency, sub.Units, sub.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrorNotFound
+		}
+		return errors.Wrap(err, "failed to update pending subscription")
+	}
+
+	*sub = updated
+	return nil
+}
+
+func (ss *SQLiteSubscriptionStore) ReplaceToken(ctx context.Context, id int64, old, replacement string) (models.Subscription, error) {
+	const query = `
+        UPDATE subscriptions
+        SET token = $3
+        WHERE id = $1 AND token = $2
+        RETURNING ` + subscriptionColumns + `;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	sub, err := scanSubscription(ss.db.QueryRowContext(ctx, query, id, old, replacement))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Subscription{}, ErrorNotFound
+		}
+		return models.Subscription{}, errors.Wrap(err, "failed to replace subscription token")
+	}
+
+	return sub, nil
+}
+
+// ReserveConfirmation works like the Postgres version, with the cooldown and
+// window cutoffs computed from the clock instead of now() - interval.
+func (ss *SQLiteSubscriptionStore) ReserveConfirmation(ctx context.Context, id int64, limits ConfirmationLimits) error {
+	const query = `
+        UPDATE subscriptions
+        SET confirmation_sends = CASE
+                WHEN confirmation_window_started_at IS NULL
+                  OR confirmation_window_started_at <= $3
+                THEN 1
+                ELSE confirmation_sends + 1
+            END,
+            confirmation_window_started_at = CASE
+                WHEN confirmation_window_started_at IS NULL
+                  OR confirmation_window_started_at <= $3
+                THEN $5
+                ELSE confirmation_window_started_at
+            END,
+            confirmation_sent_at = $5
+        WHERE id = $1
+          AND status = 'pending'
+          AND (confirmation_sent_at IS NULL
+               OR confirmation_sent_at <= $2)
+          AND (confirmation_window_started_at IS NULL
+               OR confirmation_window_started_at <= $3
+               OR confirmation_sends < $4)
+        RETURNING id;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	now := ss.db.now()
+	err := ss.db.
+		QueryRowContext(ctx, query, id, now.Add(-limits.Cooldown), now.Add(-limits.Window), limits.MaxSends, now).
+		Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrorLimitExceeded
+		}
+		return errors.Wrap(err, "failed to reserve confirmation email")
+	}
+
+	return nil
+}
+
+func (ss *SQLiteSubscriptionStore) ConfirmationWait(ctx context.Context, id int64, limits ConfirmationLimits) (time.Duration, error) {
+	const query = `
+        SELECT confirmation_sent_at, confirmation_window_started_at, confirmation_sends
+        FROM subscriptions
+        WHERE id = $1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var (
+		sentAt, windowStartedAt *time.Time
+		sends                   int
+	)
+	err := ss.db.QueryRowContext(ctx, query, id).Scan(&sentAt, &windowStartedAt, &sends)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrorNotFound
+		}
+		return 0, errors.Wrap(err, "failed to get confirmation wait")
+	}
+
+	return limits.wait(ss.db.now(), sentAt, windowStartedAt, sends), nil
+}
+
+func (ss *SQLiteSubscriptionStore) PurgeUnconfirmed(ctx context.Context, age time.Duration) (int64, error) {
+	const query = `
+        DELETE FROM subscriptions
+        WHERE status = 'pending'
+          AND confirmed = 0
+          AND created_at < $1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ss.db.ExecContext(ctx, query, ss.db.since(age))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge unconfirmed subscriptions")
+	}
+
+	return res.RowsAffected()
+}
+
+func (ss *SQLiteSubscriptionStore) ListActive(ctx context.Context) ([]models.Subscription, error) {
+	const query = `
+        SELECT ` + subscriptionColumns + `
+        FROM subscriptions
+        WHERE status = 'active'
+        ORDER BY id;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	subs, err := collectSubscriptions(ss.db.QueryContext(ctx, query))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list active subscriptions")
+	}
+
+	return subs, nil
+}
+
+func (ss *SQLiteSubscriptionStore) UpdatePreferences(ctx context.Context, token string, update PreferencesUpdate) (models.Subscription, error) {
+	const query = `
+        UPDATE subscriptions
+        SET city = COALESCE($2, city),
+            frequency = COALESCE($3, frequency),
+            units = COALESCE($4, units),
+            alert_severities = COALESCE($5, alert_severities),
+            air_quality_threshold = COALESCE($6, air_quality_threshold),
+            webhook_url = COALESCE($7, webhook_url),
+            webhook_failures = CASE WHEN $7 IS NULL THEN webhook_failures ELSE 0 END,
+            webhook_disabled_at = CASE WHEN $7 IS NULL THEN webhook_disabled_at END,
+            webhook_secret = CASE WHEN $7 IS NULL THEN webhook_secret ELSE $8 END
+        WHERE token = $1
+        RETURNING ` + subscriptionColumns + `;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	sub, err := scanSubscription(ss.db.QueryRowContext(ctx, query, token, update.City, update.Frequency, update.Units, update.AlertSeverities, update.AirQualityThreshold, update.WebhookURL, update.WebhookSecret))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Subscription{}, ErrorNotFound
+		}
+		return models.Subscription{}, errors.Wrap(err, "failed to update subscription preferences")
+	}
+
+	return sub, nil
+}
+
+// collectSubscriptions drains rows before anything else runs on the single
+// SQLite connection.
+func collectSubscriptions(rows *sql.Rows, err error) ([]models.Subscription, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []models.Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan subscription")
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
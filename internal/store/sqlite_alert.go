@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+type SQLiteAlertStore struct {
+	db *sqliteDB
+}
+
+func (as *SQLiteAlertStore) Record(ctx context.Context, alert *models.Alert) (bool, error) {
+	const query = `
+        INSERT INTO alerts (id, city, event, headline, severity, urgency, areas, description, instruction, effective_at, expires_at, received_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+        ON CONFLICT (id, city) DO NOTHING
+        RETURNING received_at;
+    `
+
+	stored := *alert
+	stored.EffectiveAt = utcPtr(alert.EffectiveAt)
+	stored.ExpiresAt = utcPtr(alert.ExpiresAt)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := as.db.
+		QueryRowContext(ctx, query, append(alertArgs(&stored), as.db.now())...).
+		Scan(&alert.ReceivedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to record alert")
+	}
+
+	return true, nil
+}
+
+func (as *SQLiteAlertStore) List(ctx context.Context, city string, limit int) ([]models.Alert, error) {
+	const query = `
+        SELECT ` + alertColumns + `
+        FROM alerts
+        WHERE lower(city) = lower($1)
+        ORDER BY received_at DESC, id
+        LIMIT $2;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := as.db.QueryContext(ctx, query, city, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list alerts")
+	}
+	defer rows.Close()
+
+	alerts := []models.Alert{}
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan alert")
+		}
+		alerts = append(alerts, alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to list alerts")
+	}
+
+	return alerts, nil
+}
+
+func (as *SQLiteAlertStore) ClaimDelivery(ctx context.Context, alertID string, subscriptionID int64) (bool, error) {
+	const query = `
+        INSERT INTO alert_deliveries (alert_id, subscription_id, created_at)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (alert_id, subscription_id) DO NOTHING;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return claimed(as.db.ExecContext(ctx, query, alertID, subscriptionID, as.db.now()))
+}
@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+const sqliteAPIKeyColumns = `id, name, prefix, scopes, usage_count, last_used_at, created_at, revoked_at`
+
+type SQLiteAPIKeyStore struct {
+	db *sqliteDB
+}
+
+func (as *SQLiteAPIKeyStore) Create(ctx context.Context, key *models.APIKey, hash string) error {
+	const query = `
+        INSERT INTO api_keys (name, prefix, key_hash, scopes, created_at)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id, created_at;
+    `
+
+	scopes := key.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	encoded, err := json.Marshal(scopes)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode api key scopes")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err = as.db.
+		QueryRowContext(ctx, query, key.Name, key.Prefix, hash, string(encoded), as.db.now()).
+		Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrorAlreadyExists
+		}
+		return errors.Wrap(err, "failed to create api key")
+	}
+
+	return nil
+}
+
+func (as *SQLiteAPIKeyStore) GetActiveByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	const query = `
+        SELECT ` + sqliteAPIKeyColumns + `
+        FROM api_keys
+        WHERE key_hash = $1 AND revoked_at IS NULL;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	key, err := scanSQLiteAPIKey(as.db.QueryRowContext(ctx, query, hash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.APIKey{}, ErrorNotFound
+		}
+		return models.APIKey{}, errors.Wrap(err, "failed to get api key")
+	}
+
+	return key, nil
+}
+
+func (as *SQLiteAPIKeyStore) TrackUsage(ctx context.Context, id int64) error {
+	const query = `
+        UPDATE api_keys
+        SET usage_count = usage_count + 1,
+            last_used_at = $2
+        WHERE id = $1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := as.db.ExecContext(ctx, query, id, as.db.now()); err != nil {
+		return errors.Wrap(err, "failed to track api key usage")
+	}
+
+	return nil
+}
+
+func (as *SQLiteAPIKeyStore) Revoke(ctx context.Context, id int64) (models.APIKey, error) {
+	const query = `
+        UPDATE api_keys
+        SET revoked_at = $2
+        WHERE id = $1 AND revoked_at IS NULL
+        RETURNING ` + sqliteAPIKeyColumns + `;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	key, err := scanSQLiteAPIKey(as.db.QueryRowContext(ctx, query, id, as.db.now()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.APIKey{}, ErrorNotFound
+		}
+		return models.APIKey{}, errors.Wrap(err, "failed to revoke api key")
+	}
+
+	return key, nil
+}
+
+func (as *SQLiteAPIKeyStore) List(ctx context.Context) ([]models.APIKey, error) {
+	const query = `
+        SELECT ` + sqliteAPIKeyColumns + `
+        FROM api_keys
+        ORDER BY id;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := as.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list api keys")
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanSQLiteAPIKey(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan api key")
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to list api keys")
+	}
+
+	return keys, nil
+}
+
+// scanSQLiteAPIKey decodes scopes, which SQLite keeps as a JSON array.
+func scanSQLiteAPIKey(row scanner) (models.APIKey, error) {
+	var (
+		key    models.APIKey
+		scopes string
+	)
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&scopes,
+		&key.UsageCount,
+		&key.LastUsedAt,
+		&key.CreatedAt,
+		&key.RevokedAt,
+	)
+	if err != nil {
+		return key, err
+	}
+
+	if err := json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+		return key, errors.Wrap(err, "failed to decode api key scopes")
+	}
+	return key, nil
+}
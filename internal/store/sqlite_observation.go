@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"time"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+type SQLiteObservationStore struct {
+	db *sqliteDB
+}
+
+func (o *SQLiteObservationStore) Add(ctx context.Context, obs *models.Observation) error {
+	const query = `
+        INSERT INTO observations (city, provider, temperature, humidity, condition, raw, observed_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING id, observed_at;
+    `
+
+	observedAt := obs.ObservedAt.UTC()
+	if obs.ObservedAt.IsZero() {
+		observedAt = o.db.now()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := o.db.
+		QueryRowContext(ctx, query, obs.City, obs.Provider, obs.Temperature, obs.Humidity, obs.Condition, string(obs.Raw), observedAt).
+		Scan(&obs.ID, &obs.ObservedAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to add observation")
+	}
+
+	return nil
+}
+
+// Aggregate buckets by Unix seconds, strftime('%s') reads the stored UTC times.
+func (o *SQLiteObservationStore) Aggregate(ctx context.Context, city string, from, to time.Time, bucket time.Duration) ([]models.ObservationBucket, error) {
+	const query = `
+        SELECT CAST(strftime('%s', observed_at) AS INTEGER) / $4 * $4 AS bucket,
+               count(*),
+               min(temperature), max(temperature), avg(temperature),
+               min(humidity), max(humidity), avg(humidity)
+        FROM observations
+        WHERE lower(city) = lower($1)
+          AND observed_at >= $2
+          AND observed_at < $3
+        GROUP BY bucket
+        ORDER BY bucket;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := o.db.QueryContext(ctx, query, city, from.UTC(), to.UTC(), int64(bucket/time.Second))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to aggregate observations")
+	}
+	defer rows.Close()
+
+	buckets := []models.ObservationBucket{}
+	for rows.Next() {
+		var (
+			b     models.ObservationBucket
+			start int64
+		)
+		if err := rows.Scan(bucketDest(&start, &b)...); err != nil {
+			return nil, errors.Wrap(err, "failed to scan observation bucket")
+		}
+		b.Start = time.Unix(start, 0).UTC()
+		buckets = append(buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to aggregate observations")
+	}
+
+	return buckets, nil
+}
+
+func (o *SQLiteObservationStore) Purge(ctx context.Context, age time.Duration) (int64, error) {
+	const query = `
+        DELETE FROM observations
+        WHERE observed_at < $1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := o.db.ExecContext(ctx, query, o.db.since(age))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge observations")
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+type SQLiteOutboxStore struct {
+	db *sqliteDB
+}
+
+func (ob *SQLiteOutboxStore) Add(ctx context.Context, msg *models.OutboxMessage) error {
+	const query = `
+        INSERT INTO outbox (topic, payload, available_at, created_at)
+        VALUES ($1, $2, $3, $3)
+        RETURNING id, available_at, created_at;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := ob.db.
+		QueryRowContext(ctx, query, msg.Topic, string(msg.Payload), ob.db.now()).
+		Scan(&msg.ID, &msg.AvailableAt, &msg.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to add outbox message")
+	}
+
+	return nil
+}
+
+// Claim needs no SKIP LOCKED, SQLite runs the update under its single
+// writer lock.
+func (ob *SQLiteOutboxStore) Claim(ctx context.Context, topics []string, limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	const query = `
+        UPDATE outbox
+        SET attempts = attempts + 1,
+            available_at = $3
+        WHERE id IN (
+            SELECT id
+            FROM outbox
+            WHERE sent_at IS NULL
+              AND failed_at IS NULL
+              AND available_at <= $2
+              AND topic IN (SELECT value FROM json_each($4))
+            ORDER BY id
+            LIMIT $1
+        )
+        RETURNING ` + outboxColumns + `;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	encoded, err := json.Marshal(topics)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode outbox topics")
+	}
+
+	now := ob.db.now()
+	rows, err := ob.db.QueryContext(ctx, query, limit, now, now.Add(lease), string(encoded))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to claim outbox messages")
+	}
+	defer rows.Close()
+
+	msgs := []models.OutboxMessage{}
+	for rows.Next() {
+		msg, err := scanOutboxMessage(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan outbox message")
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to claim outbox messages")
+	}
+
+	// RETURNING has no ORDER BY in SQLite
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].ID < msgs[j].ID })
+
+	return msgs, nil
+}
+
+func (ob *SQLiteOutboxStore) MarkSent(ctx context.Context, id int64) error {
+	const query = `
+        UPDATE outbox
+        SET sent_at = $2,
+            last_error = ''
+        WHERE id = $1;
+    `
+
+	return ob.update(ctx, "failed to mark outbox message sent", query, id, ob.db.now())
+}
+
+func (ob *SQLiteOutboxStore) Retry(ctx context.Context, id int64, at time.Time, reason string) error {
+	const query = `
+        UPDATE outbox
+        SET available_at = $2,
+            last_error = $3
+        WHERE id = $1;
+    `
+
+	return ob.update(ctx, "failed to reschedule outbox message", query, id, at.UTC(), reason)
+}
+
+func (ob *SQLiteOutboxStore) MarkFailed(ctx context.Context, id int64, reason string) error {
+	const query = `
+        UPDATE outbox
+        SET failed_at = $3,
+            last_error = $2
+        WHERE id = $1;
+    `
+
+	return ob.update(ctx, "failed to mark outbox message failed", query, id, reason, ob.db.now())
+}
+
+func (ob *SQLiteOutboxStore) PurgeSent(ctx context.Context, age time.Duration) (int64, error) {
+	const query = `
+        DELETE FROM outbox
+        WHERE sent_at < $1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ob.db.ExecContext(ctx, query, ob.db.since(age))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge sent outbox messages")
+	}
+
+	return res.RowsAffected()
+}
+
+func (ob *SQLiteOutboxStore) update(ctx context.Context, message, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ob.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, message)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
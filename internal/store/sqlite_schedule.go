@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+type SQLiteScheduleStore struct {
+	db *sqliteDB
+}
+
+func (ss *SQLiteScheduleStore) LastRun(ctx context.Context, frequency string) (models.ScheduleRun, error) {
+	const query = `
+        SELECT frequency, last_window, finished_at, sent, skipped, failed
+        FROM schedule_runs
+        WHERE frequency = $1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var run models.ScheduleRun
+	err := ss.db.QueryRowContext(ctx, query, frequency).
+		Scan(&run.Frequency, &run.LastWindow, &run.FinishedAt, &run.Sent, &run.Skipped, &run.Failed)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return run, ErrorNotFound
+		}
+		return run, errors.Wrap(err, "failed to get last schedule run")
+	}
+
+	return run, nil
+}
+
+func (ss *SQLiteScheduleStore) RecordRun(ctx context.Context, run models.ScheduleRun) error {
+	const query = `
+        INSERT INTO schedule_runs (frequency, last_window, finished_at, sent, skipped, failed)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (frequency) DO UPDATE
+        SET last_window = excluded.last_window,
+            finished_at = excluded.finished_at,
+            sent = excluded.sent,
+            skipped = excluded.skipped,
+            failed = excluded.failed
+        WHERE schedule_runs.last_window <= excluded.last_window;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ss.db.ExecContext(ctx, query, run.Frequency, run.LastWindow.UTC(), ss.db.now(), run.Sent, run.Skipped, run.Failed)
+	if err != nil {
+		return errors.Wrap(err, "failed to record schedule run")
+	}
+
+	return nil
+}
+
+// ClaimDigest works like the Postgres version in one transaction, SQLite
+// has no data-modifying CTEs. The window is only advanced while the key is
+// not taken, so the insert after it cannot conflict.
+func (ss *SQLiteScheduleStore) ClaimDigest(ctx context.Context, key string, id int64, window time.Time) (bool, error) {
+	const previousQuery = `
+        SELECT last_sent_window
+        FROM subscriptions
+        WHERE id = $1;
+    `
+	const updateQuery = `
+        UPDATE subscriptions
+        SET last_sent_window = $2
+        WHERE id = $1
+          AND (last_sent_window IS NULL OR last_sent_window < $2)
+          AND NOT EXISTS (SELECT 1 FROM digest_deliveries WHERE idempotency_key = $3);
+    `
+	const claimQuery = `
+        INSERT INTO digest_deliveries (idempotency_key, subscription_id, window_start, previous_window, created_at)
+        VALUES ($1, $2, $3, $4, $5);
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	window = window.UTC()
+
+	var claimed bool
+	err := inTx(ctx, ss.db.dbtx, func(tx dbtx) error {
+		var previous *time.Time
+		err := tx.QueryRowContext(ctx, previousQuery, id).Scan(&previous)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to claim digest")
+		}
+
+		res, err := tx.ExecContext(ctx, updateQuery, id, window, key)
+		if err != nil {
+			return errors.Wrap(err, "failed to claim digest")
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return errors.Wrap(err, "failed to claim digest")
+		}
+		if n == 0 {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, claimQuery, key, id, window, utcPtr(previous), ss.db.now()); err != nil {
+			return errors.Wrap(err, "failed to claim digest")
+		}
+
+		claimed = true
+		return nil
+	})
+
+	return claimed, err
+}
+
+// ReleaseDigest puts back the window the claim replaced.
+func (ss *SQLiteScheduleStore) ReleaseDigest(ctx context.Context, key string, id int64, window time.Time) error {
+	const releaseQuery = `
+        DELETE FROM digest_deliveries
+        WHERE idempotency_key = $1
+        RETURNING previous_window;
+    `
+	const updateQuery = `
+        UPDATE subscriptions
+        SET last_sent_window = $3
+        WHERE id = $1 AND last_sent_window = $2;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return inTx(ctx, ss.db.dbtx, func(tx dbtx) error {
+		var previous *time.Time
+		err := tx.QueryRowContext(ctx, releaseQuery, key).Scan(&previous)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to release digest")
+		}
+		if _, err := tx.ExecContext(ctx, updateQuery, id, window.UTC(), utcPtr(previous)); err != nil {
+			return errors.Wrap(err, "failed to release digest")
+		}
+		return nil
+	})
+}
+
+func (ss *SQLiteScheduleStore) PurgeDeliveries(ctx context.Context, age time.Duration) (int64, error) {
+	const query = `
+        DELETE FROM digest_deliveries
+        WHERE created_at < $1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ss.db.ExecContext(ctx, query, ss.db.since(age))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge digest deliveries")
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+type SQLiteSuppressionStore struct {
+	db *sqliteDB
+}
+
+func (ss *SQLiteSuppressionStore) Add(ctx context.Context, s *models.Suppression) error {
+	const query = `
+        INSERT INTO suppressions (email, reason, source, created_at)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (email) DO UPDATE SET email = excluded.email
+        RETURNING email, reason, source, created_at;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := ss.db.
+		QueryRowContext(ctx, query, normalizeEmail(s.Email), s.Reason, s.Source, ss.db.now()).
+		Scan(&s.Email, &s.Reason, &s.Source, &s.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to add suppression")
+	}
+
+	return nil
+}
+
+func (ss *SQLiteSuppressionStore) Remove(ctx context.Context, email string) error {
+	const query = `
+        DELETE FROM suppressions
+        WHERE email = $1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ss.db.ExecContext(ctx, query, normalizeEmail(email))
+	if err != nil {
+		return errors.Wrap(err, "failed to remove suppression")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+func (ss *SQLiteSuppressionStore) IsSuppressed(ctx context.Context, email string) (bool, error) {
+	const query = `
+        SELECT EXISTS (SELECT 1 FROM suppressions WHERE email = $1);
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var suppressed bool
+	if err := ss.db.QueryRowContext(ctx, query, normalizeEmail(email)).Scan(&suppressed); err != nil {
+		return false, errors.Wrap(err, "failed to check suppression")
+	}
+
+	return suppressed, nil
+}
+
+func (ss *SQLiteSuppressionStore) List(ctx context.Context) ([]models.Suppression, error) {
+	const query = `
+        SELECT email, reason, source, created_at
+        FROM suppressions
+        ORDER BY created_at DESC;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ss.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list suppressions")
+	}
+	defer rows.Close()
+
+	list := []models.Suppression{}
+	for rows.Next() {
+		var s models.Suppression
+		if err := rows.Scan(&s.Email, &s.Reason, &s.Source, &s.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan suppression")
+		}
+		list = append(list, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to list suppressions")
+	}
+
+	return list, nil
+}
@@ -0,0 +1,25 @@
+package store_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"weather/internal/clock"
+	"weather/internal/config"
+	"weather/internal/database"
+	"weather/internal/store"
+	"weather/internal/store/storetest"
+)
+
+func TestSQLiteStorage(t *testing.T) {
+	db, err := database.New(config.DBConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "weather.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := storetest.Run(context.Background(), store.NewSQLiteStorage(db, clock.Real{})); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"time"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+type SQLiteWebhookStore struct {
+	db *sqliteDB
+}
+
+func (ws *SQLiteWebhookStore) AddDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	const query = `
+        INSERT INTO webhook_deliveries (subscription_id, delivery_id, event, url, status_code, error, duration_ms, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING id, created_at;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := ws.db.
+		QueryRowContext(ctx, query, append(webhookDeliveryArgs(delivery), ws.db.now())...).
+		Scan(&delivery.ID, &delivery.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to add webhook delivery")
+	}
+
+	return nil
+}
+
+func (ws *SQLiteWebhookStore) ListDeliveries(ctx context.Context, subscriptionID int64, limit int) ([]models.WebhookDelivery, error) {
+	const query = `
+        SELECT ` + webhookDeliveryColumns + `
+        FROM webhook_deliveries
+        WHERE subscription_id = $1
+        ORDER BY created_at DESC, id DESC
+        LIMIT $2;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return listWebhookDeliveries(ws.db.QueryContext(ctx, query, subscriptionID, limit))
+}
+
+func (ws *SQLiteWebhookStore) PurgeDeliveries(ctx context.Context, age time.Duration) (int64, error) {
+	const query = `
+        DELETE FROM webhook_deliveries
+        WHERE created_at < $1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ws.db.ExecContext(ctx, query, ws.db.since(age))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge webhook deliveries")
+	}
+
+	return res.RowsAffected()
+}
+
+func (ws *SQLiteWebhookStore) RecordSuccess(ctx context.Context, subscriptionID int64) error {
+	const query = `
+        UPDATE subscriptions
+        SET webhook_failures = 0
+        WHERE id = $1 AND webhook_failures <> 0;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := ws.db.ExecContext(ctx, query, subscriptionID); err != nil {
+		return errors.Wrap(err, "failed to record webhook success")
+	}
+
+	return nil
+}
+
+func (ws *SQLiteWebhookStore) RecordFailure(ctx context.Context, subscriptionID int64, maxFailures int) (models.Subscription, error) {
+	const query = `
+        UPDATE subscriptions
+        SET webhook_failures = webhook_failures + 1,
+            webhook_disabled_at = CASE
+                WHEN webhook_disabled_at IS NULL AND webhook_failures + 1 >= $2 THEN $3
+                ELSE webhook_disabled_at
+            END
+        WHERE id = $1
+        RETURNING ` + subscriptionColumns + `;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return recordedFailure(scanSubscription(ws.db.QueryRowContext(ctx, query, subscriptionID, maxFailures, ws.db.now())))
+}
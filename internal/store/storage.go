@@ -3,26 +3,203 @@ package store
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"time"
 	"weather/internal/models"
+
+	"github.com/pkg/errors"
 )
 
 const QueryTimeoutDuration = 1 * time.Second
 
 var ErrorNotFound = errors.New("resource not found")
 var ErrorAlreadyExists = errors.New("resource already exists")
+var ErrorLimitExceeded = errors.New("limit exceeded")
+var ErrorInvalidTransition = errors.New("invalid status transition")
+
+// ConfirmationLimits bound how often confirmation emails go to one address.
+type ConfirmationLimits struct {
+	Cooldown time.Duration
+	Window   time.Duration
+	MaxSends int
+}
+
+// wait returns how long until the limits allow another confirmation email to
+// a subscription that sent its last at sentAt and started its send window at
+// windowStartedAt. A used up window outlasts the cooldown.
+func (l ConfirmationLimits) wait(now time.Time, sentAt, windowStartedAt *time.Time, sends int) time.Duration {
+	var wait time.Duration
+	if sentAt != nil {
+		wait = sentAt.Add(l.Cooldown).Sub(now)
+	}
+	if windowStartedAt != nil && sends >= l.MaxSends {
+		wait = max(wait, windowStartedAt.Add(l.Window).Sub(now))
+	}
+	return max(wait, 0)
+}
+
+type SubscriptionRepository interface {
+	Create(context.Context, *models.Subscription) error
+	Confirm(ctx context.Context, token string) (models.Subscription, error)
+	Unsubscribe(ctx context.Context, token string) (models.Subscription, error)
+	List(ctx context.Context, filter SubscriptionFilter) ([]models.Subscription, int64, error)
+	GetByID(ctx context.Context, id int64) (models.Subscription, error)
+	Delete(ctx context.Context, id int64) (models.Subscription, error)
+	ConfirmByID(ctx context.Context, id int64) (models.Subscription, error)
+	CountByCity(ctx context.Context) ([]models.CityStats, error)
+	GetByEmail(ctx context.Context, email string) (models.Subscription, error)
+	UpdatePending(ctx context.Context, sub *models.Subscription) error
+	ReserveConfirmation(ctx context.Context, id int64, limits ConfirmationLimits) error
+	ConfirmationWait(ctx context.Context, id int64, limits ConfirmationLimits) (time.Duration, error)
+	ReplaceToken(ctx context.Context, id int64, old, replacement string) (models.Subscription, error)
+	PurgeUnconfirmed(ctx context.Context, age time.Duration) (int64, error)
+	GetByToken(ctx context.Context, token string) (models.Subscription, error)
+	UpdatePreferences(ctx context.Context, token string, update PreferencesUpdate) (models.Subscription, error)
+	Transition(ctx context.Context, id int64, to, reason string) (models.Subscription, error)
+	History(ctx context.Context, id int64) ([]models.SubscriptionEvent, error)
+	Pause(ctx context.Context, token string, until *time.Time) (models.Subscription, error)
+	Resume(ctx context.Context, token string) (models.Subscription, error)
+	ResumeExpired(ctx context.Context) ([]models.Subscription, error)
+	ListActive(ctx context.Context) ([]models.Subscription, error)
+}
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *models.APIKey, hash string) error
+	GetActiveByHash(ctx context.Context, hash string) (models.APIKey, error)
+	TrackUsage(ctx context.Context, id int64) error
+	Revoke(ctx context.Context, id int64) (models.APIKey, error)
+	List(ctx context.Context) ([]models.APIKey, error)
+}
+
+type SuppressionRepository interface {
+	Add(ctx context.Context, s *models.Suppression) error
+	Remove(ctx context.Context, email string) error
+	IsSuppressed(ctx context.Context, email string) (bool, error)
+	List(ctx context.Context) ([]models.Suppression, error)
+}
+
+type OutboxRepository interface {
+	Add(ctx context.Context, msg *models.OutboxMessage) error
+	Claim(ctx context.Context, topics []string, limit int, lease time.Duration) ([]models.OutboxMessage, error)
+	MarkSent(ctx context.Context, id int64) error
+	Retry(ctx context.Context, id int64, at time.Time, reason string) error
+	MarkFailed(ctx context.Context, id int64, reason string) error
+	PurgeSent(ctx context.Context, age time.Duration) (int64, error)
+}
+
+type ObservationRepository interface {
+	Add(ctx context.Context, obs *models.Observation) error
+	Aggregate(ctx context.Context, city string, from, to time.Time, bucket time.Duration) ([]models.ObservationBucket, error)
+	Purge(ctx context.Context, age time.Duration) (int64, error)
+}
+
+type AlertRepository interface {
+	Record(ctx context.Context, alert *models.Alert) (bool, error)
+	List(ctx context.Context, city string, limit int) ([]models.Alert, error)
+	ClaimDelivery(ctx context.Context, alertID string, subscriptionID int64) (bool, error)
+}
+
+type WebhookRepository interface {
+	AddDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	ListDeliveries(ctx context.Context, subscriptionID int64, limit int) ([]models.WebhookDelivery, error)
+	PurgeDeliveries(ctx context.Context, age time.Duration) (int64, error)
+	RecordSuccess(ctx context.Context, subscriptionID int64) error
+	RecordFailure(ctx context.Context, subscriptionID int64, maxFailures int) (models.Subscription, error)
+}
 
+type ScheduleRepository interface {
+	LastRun(ctx context.Context, frequency string) (models.ScheduleRun, error)
+	RecordRun(ctx context.Context, run models.ScheduleRun) error
+	ClaimDigest(ctx context.Context, key string, id int64, window time.Time) (bool, error)
+	ReleaseDigest(ctx context.Context, key string, id int64, window time.Time) error
+	PurgeDeliveries(ctx context.Context, age time.Duration) (int64, error)
+}
+
+// Storage groups the repositories. NewStorage backs them with Postgres,
+// NewSQLiteStorage with a SQLite file, NewMemoryStorage keeps everything in
+// process.
 type Storage struct {
-	Subscription interface {
-		Create(context.Context, *models.Subscription) error
-		Confirm(ctx context.Context, token string) (models.Subscription, error)
-		Unsubscribe(ctx context.Context, token string) (models.Subscription, error)
+	Subscription SubscriptionRepository
+	APIKey       APIKeyRepository
+	Suppression  SuppressionRepository
+	Schedule     ScheduleRepository
+	Outbox       OutboxRepository
+	Observation  ObservationRepository
+	Alert        AlertRepository
+	Webhook      WebhookRepository
+
+	withTx func(ctx context.Context, fn func(tx Storage) error) error
+}
+
+// WithTx runs fn with repositories bound to one transaction, committed when
+// fn returns nil and rolled back otherwise. fn must only use tx, the storage
+// it was called on may wait for the transaction to end. Calling WithTx on tx
+// joins the running transaction.
+func (s Storage) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	if s.withTx == nil {
+		return fn(s)
 	}
+	return s.withTx(ctx, fn)
 }
 
 func NewStorage(db *sql.DB) Storage {
-	return Storage{
-		Subscription: &SubscriptionStore{db},
+	return sqlStorage(db, func(db dbtx) Storage {
+		return Storage{
+			Subscription: &SubscriptionStore{db},
+			APIKey:       &APIKeyStore{db},
+			Suppression:  &SuppressionStore{db},
+			Schedule:     &ScheduleStore{db},
+			Outbox:       &OutboxStore{db},
+			Observation:  &ObservationStore{db},
+			Alert:        &AlertStore{db},
+			Webhook:      &WebhookStore{db},
+		}
+	})
+}
+
+// dbtx is what the SQL repositories query, the *sql.DB or the *sql.Tx of
+// Storage.WithTx.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// sqlStorage binds the repositories to db and lets WithTx rebind them to a
+// transaction.
+func sqlStorage(db dbtx, bind func(dbtx) Storage) Storage {
+	s := bind(db)
+	s.withTx = func(ctx context.Context, fn func(Storage) error) error {
+		return inTx(ctx, db, func(tx dbtx) error {
+			return fn(sqlStorage(tx, bind))
+		})
 	}
+	return s
+}
+
+// inTx runs fn in a new transaction, or in the running one when db is a *sql.Tx.
+func inTx(ctx context.Context, db dbtx, fn func(tx dbtx) error) error {
+	if tx, ok := db.(*sql.Tx); ok {
+		return fn(tx)
+	}
+
+	sqlDB, ok := db.(*sql.DB)
+	if !ok {
+		return errors.Errorf("cant begin a transaction on %T", db)
+	}
+
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
 }
@@ -0,0 +1,711 @@
+// Package storetest checks that a store.Storage implementation honours the
+// contract the handlers rely on, in the spirit of testing/fstest. The same
+// checks run against the Postgres, SQLite and in-memory storage:
+//
+//	if err := storetest.Run(ctx, store.NewMemoryStorage(clock.Real{})); err != nil {
+//		t.Fatal(err)
+//	}
+//
+// Rows are created with unique emails, so a shared database can be used.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"weather/internal/models"
+	"weather/internal/store"
+)
+
+type checker struct {
+	ctx    context.Context
+	s      store.Storage
+	prefix string
+	// short fits narrow columns such as schedule_runs.frequency
+	short   string
+	failed  []error
+	counter int
+}
+
+// Run executes every contract check and returns all failures joined.
+func Run(ctx context.Context, s store.Storage) error {
+	run := time.Now().UnixNano()
+	c := &checker{
+		ctx:    ctx,
+		s:      s,
+		prefix: fmt.Sprintf("storetest-%d", run),
+		short:  fmt.Sprintf("st%09d", run%1e9),
+	}
+
+	c.subscriptionUniqueness()
+	c.subscriptionNotFound()
+	c.subscriptionTransitions()
+	c.replaceToken()
+	c.confirmationLimits()
+	c.preferences()
+	c.apiKeys()
+	c.suppressions()
+	c.schedule()
+	c.outbox()
+	c.observations()
+	c.alerts()
+	c.webhooks()
+	c.chatSubscriptions()
+	c.transactions()
+
+	return errors.Join(c.failed...)
+}
+
+func (c *checker) errorf(format string, args ...any) {
+	c.failed = append(c.failed, fmt.Errorf(format, args...))
+}
+
+func (c *checker) expect(name string, err, want error) {
+	if !errors.Is(err, want) {
+		c.errorf("%s: got error %v, want %v", name, err, want)
+	}
+}
+
+func (c *checker) newSubscription() models.Subscription {
+	return c.newSubscriptionIn(c.s)
+}
+
+func (c *checker) newSubscriptionIn(s store.Storage) models.Subscription {
+	c.counter++
+	email := fmt.Sprintf("%s-%d@example.com", c.prefix, c.counter)
+	sub := models.Subscription{
+		Email:     email,
+		City:      "Kyiv",
+		Frequency: models.Hourly,
+		Units:     models.Metric,
+		Token:     "token-" + email,
+	}
+	if err := s.Subscription.Create(c.ctx, &sub); err != nil {
+		c.errorf("Create: %v", err)
+	}
+	return sub
+}
+
+func (c *checker) subscriptionUniqueness() {
+	sub := c.newSubscription()
+	if sub.ID == 0 || sub.Status != models.StatusPending {
+		c.errorf("Create: got id %d status %q, want an id and %q", sub.ID, sub.Status, models.StatusPending)
+	}
+
+	dup := sub
+	dup.Token = "other-" + sub.Token
+	c.expect("Create with taken email", c.s.Subscription.Create(c.ctx, &dup), store.ErrorAlreadyExists)
+
+	for name, get := range map[string]func() (models.Subscription, error){
+		"GetByID":    func() (models.Subscription, error) { return c.s.Subscription.GetByID(c.ctx, sub.ID) },
+		"GetByEmail": func() (models.Subscription, error) { return c.s.Subscription.GetByEmail(c.ctx, sub.Email) },
+		"GetByToken": func() (models.Subscription, error) { return c.s.Subscription.GetByToken(c.ctx, sub.Token) },
+	} {
+		got, err := get()
+		if err != nil || got.ID != sub.ID || got.Email != sub.Email {
+			c.errorf("%s: got %+v, %v", name, got, err)
+		}
+	}
+
+	// bounce reports may change the case of the address
+	if got, err := c.s.Subscription.GetByEmail(c.ctx, strings.ToUpper(sub.Email)); err != nil || got.ID != sub.ID {
+		c.errorf("GetByEmail in upper case: got %+v, %v", got, err)
+	}
+}
+
+func (c *checker) subscriptionNotFound() {
+	missing := c.prefix + "-missing"
+
+	_, err := c.s.Subscription.GetByID(c.ctx, -1)
+	c.expect("GetByID unknown", err, store.ErrorNotFound)
+	_, err = c.s.Subscription.GetByEmail(c.ctx, missing)
+	c.expect("GetByEmail unknown", err, store.ErrorNotFound)
+	_, err = c.s.Subscription.GetByToken(c.ctx, missing)
+	c.expect("GetByToken unknown", err, store.ErrorNotFound)
+	_, err = c.s.Subscription.Confirm(c.ctx, missing)
+	c.expect("Confirm unknown", err, store.ErrorNotFound)
+	_, err = c.s.Subscription.Delete(c.ctx, -1)
+	c.expect("Delete unknown", err, store.ErrorNotFound)
+	_, err = c.s.Subscription.UpdatePreferences(c.ctx, missing, store.PreferencesUpdate{})
+	c.expect("UpdatePreferences unknown", err, store.ErrorNotFound)
+
+	sub := c.newSubscription()
+	if _, err := c.s.Subscription.Delete(c.ctx, sub.ID); err != nil {
+		c.errorf("Delete: %v", err)
+	}
+	_, err = c.s.Subscription.GetByID(c.ctx, sub.ID)
+	c.expect("GetByID deleted", err, store.ErrorNotFound)
+}
+
+func (c *checker) replaceToken() {
+	sub := c.newSubscription()
+
+	replaced, err := c.s.Subscription.ReplaceToken(c.ctx, sub.ID, sub.Token, "new-"+sub.Token)
+	if err != nil || replaced.ID != sub.ID || replaced.Token != "new-"+sub.Token {
+		c.errorf("ReplaceToken: got %+v, %v", replaced, err)
+	}
+	_, err = c.s.Subscription.GetByToken(c.ctx, sub.Token)
+	c.expect("GetByToken replaced", err, store.ErrorNotFound)
+
+	// a second replace of the same token lost the race
+	_, err = c.s.Subscription.ReplaceToken(c.ctx, sub.ID, sub.Token, "other-"+sub.Token)
+	c.expect("ReplaceToken stale", err, store.ErrorNotFound)
+}
+
+func (c *checker) subscriptionTransitions() {
+	sub := c.newSubscription()
+
+	confirmed, err := c.s.Subscription.Confirm(c.ctx, sub.Token)
+	if err != nil || confirmed.Status != models.StatusActive || !confirmed.Confirmed {
+		c.errorf("Confirm: got %+v, %v", confirmed, err)
+	}
+	if _, err := c.s.Subscription.Confirm(c.ctx, sub.Token); err != nil {
+		c.errorf("Confirm twice: %v, want no-op", err)
+	}
+
+	until := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	paused, err := c.s.Subscription.Pause(c.ctx, sub.Token, &until)
+	if err != nil || paused.Status != models.StatusPaused || paused.PausedUntil == nil {
+		c.errorf("Pause: got %+v, %v", paused, err)
+	}
+
+	resumed, err := c.s.Subscription.ResumeExpired(c.ctx)
+	if err != nil || !containsID(resumed, sub.ID) {
+		c.errorf("ResumeExpired: %v, want subscription %d resumed", err, sub.ID)
+	}
+
+	active, err := c.s.Subscription.ListActive(c.ctx)
+	if err != nil || !containsID(active, sub.ID) {
+		c.errorf("ListActive: %v, want subscription %d", err, sub.ID)
+	}
+
+	if _, err := c.s.Subscription.Unsubscribe(c.ctx, sub.Token); err != nil {
+		c.errorf("Unsubscribe: %v", err)
+	}
+	_, err = c.s.Subscription.Transition(c.ctx, sub.ID, models.StatusBounced, "storetest")
+	c.expect("Transition unsubscribed to bounced", err, store.ErrorInvalidTransition)
+	// an old confirmation link must not skip double opt-in
+	_, err = c.s.Subscription.Confirm(c.ctx, sub.Token)
+	c.expect("Confirm unsubscribed", err, store.ErrorInvalidTransition)
+	_, err = c.s.Subscription.ConfirmByID(c.ctx, sub.ID)
+	c.expect("ConfirmByID unsubscribed", err, store.ErrorInvalidTransition)
+
+	history, err := c.s.Subscription.History(c.ctx, sub.ID)
+	if err != nil {
+		c.errorf("History: %v", err)
+	}
+	var steps []string
+	for _, e := range history {
+		steps = append(steps, e.ToStatus)
+	}
+	if want := "pending active paused active unsubscribed"; strings.Join(steps, " ") != want {
+		c.errorf("History: got %q, want %q", strings.Join(steps, " "), want)
+	}
+
+	subs, total, err := c.s.Subscription.List(c.ctx, store.SubscriptionFilter{Status: models.StatusUnsubscribed, City: "Kyiv", Limit: 1000})
+	if err != nil || !containsID(subs, sub.ID) || total < int64(len(subs)) {
+		c.errorf("List: %v, want subscription %d in %d results", err, sub.ID, total)
+	}
+}
+
+func (c *checker) confirmationLimits() {
+	sub := c.newSubscription()
+	limits := store.ConfirmationLimits{Cooldown: time.Hour, Window: 24 * time.Hour, MaxSends: 3}
+
+	if err := c.s.Subscription.ReserveConfirmation(c.ctx, sub.ID, limits); err != nil {
+		c.errorf("ReserveConfirmation: %v", err)
+	}
+	c.expect("ReserveConfirmation in cooldown", c.s.Subscription.ReserveConfirmation(c.ctx, sub.ID, limits), store.ErrorLimitExceeded)
+	c.expectWait("ConfirmationWait in cooldown", sub.ID, limits, limits.Cooldown)
+
+	limits.Cooldown = 0
+	limits.MaxSends = 2
+	if err := c.s.Subscription.ReserveConfirmation(c.ctx, sub.ID, limits); err != nil {
+		c.errorf("ReserveConfirmation after cooldown: %v", err)
+	}
+	c.expect("ReserveConfirmation over budget", c.s.Subscription.ReserveConfirmation(c.ctx, sub.ID, limits), store.ErrorLimitExceeded)
+	c.expectWait("ConfirmationWait over budget", sub.ID, limits, limits.Window)
+
+	if _, err := c.s.Subscription.ConfirmByID(c.ctx, sub.ID); err != nil {
+		c.errorf("ConfirmByID: %v", err)
+	}
+	c.expect("ReserveConfirmation when active", c.s.Subscription.ReserveConfirmation(c.ctx, sub.ID, limits), store.ErrorLimitExceeded)
+}
+
+// expectWait checks ConfirmationWait is want less the moments the checks took.
+func (c *checker) expectWait(name string, id int64, limits store.ConfirmationLimits, want time.Duration) {
+	wait, err := c.s.Subscription.ConfirmationWait(c.ctx, id, limits)
+	if err != nil || wait > want || wait < want-time.Minute {
+		c.errorf("%s: got %s, %v, want about %s", name, wait, err, want)
+	}
+}
+
+func (c *checker) preferences() {
+	sub := c.newSubscription()
+
+	city, units := "Lviv", models.Imperial
+	updated, err := c.s.Subscription.UpdatePreferences(c.ctx, sub.Token, store.PreferencesUpdate{City: &city, Units: &units})
+	if err != nil || updated.City != city || updated.Units != units || updated.Frequency != sub.Frequency {
+		c.errorf("UpdatePreferences: got %+v, %v", updated, err)
+	}
+	if !slices.Equal(updated.AlertSeverities, models.DefaultAlertSeverities) {
+		c.errorf("UpdatePreferences: got alert severities %v, want the default %v", updated.AlertSeverities, models.DefaultAlertSeverities)
+	}
+
+	severities := models.AlertSeverities{models.SeverityModerate}
+	updated, err = c.s.Subscription.UpdatePreferences(c.ctx, sub.Token, store.PreferencesUpdate{AlertSeverities: &severities})
+	if err != nil || !slices.Equal(updated.AlertSeverities, severities) || updated.City != city {
+		c.errorf("UpdatePreferences alert severities: got %+v, %v", updated, err)
+	}
+	none := models.AlertSeverities{}
+	updated, err = c.s.Subscription.UpdatePreferences(c.ctx, sub.Token, store.PreferencesUpdate{AlertSeverities: &none})
+	if err != nil || len(updated.AlertSeverities) != 0 {
+		c.errorf("UpdatePreferences without alerts: got %v, %v", updated.AlertSeverities, err)
+	}
+	threshold := 4
+	updated, err = c.s.Subscription.UpdatePreferences(c.ctx, sub.Token, store.PreferencesUpdate{AirQualityThreshold: &threshold})
+	if err != nil || updated.AirQualityThreshold != threshold || len(updated.AlertSeverities) != 0 {
+		c.errorf("UpdatePreferences air quality threshold: got %+v, %v", updated, err)
+	}
+
+	pending := models.Subscription{Email: sub.Email, City: "Odesa", Frequency: models.Daily, Units: models.Metric}
+	if err := c.s.Subscription.UpdatePending(c.ctx, &pending); err != nil || pending.City != "Odesa" || pending.Token != sub.Token {
+		c.errorf("UpdatePending: got %+v, %v", pending, err)
+	}
+	rotated := sub.Token + "-rotated"
+	pending = models.Subscription{Email: sub.Email, City: "Odesa", Frequency: models.Daily, Units: models.Metric, Token: rotated}
+	if err := c.s.Subscription.UpdatePending(c.ctx, &pending); err != nil || pending.Token != rotated {
+		c.errorf("UpdatePending with token: got %+v, %v", pending, err)
+	}
+	if _, err := c.s.Subscription.GetByToken(c.ctx, sub.Token); !errors.Is(err, store.ErrorNotFound) {
+		c.errorf("GetByToken of replaced token: got %v, want %v", err, store.ErrorNotFound)
+	}
+
+	if _, err := c.s.Subscription.Confirm(c.ctx, rotated); err != nil {
+		c.errorf("Confirm: %v", err)
+	}
+	c.expect("UpdatePending when active", c.s.Subscription.UpdatePending(c.ctx, &pending), store.ErrorNotFound)
+}
+
+func (c *checker) apiKeys() {
+	hash := fmt.Sprintf("%064s", strings.ReplaceAll(c.prefix, "-", ""))[:64]
+	key := models.APIKey{Name: c.prefix, Prefix: "wk_test", Scopes: []string{models.ScopeWeatherRead}}
+	if err := c.s.APIKey.Create(c.ctx, &key, hash); err != nil {
+		c.errorf("APIKey.Create: %v", err)
+	}
+
+	dup := models.APIKey{Name: c.prefix, Prefix: "wk_test"}
+	c.expect("APIKey.Create with taken hash", c.s.APIKey.Create(c.ctx, &dup, hash), store.ErrorAlreadyExists)
+
+	got, err := c.s.APIKey.GetActiveByHash(c.ctx, hash)
+	if err != nil || got.ID != key.ID || !got.HasScope(models.ScopeWeatherRead) {
+		c.errorf("GetActiveByHash: got %+v, %v", got, err)
+	}
+
+	if _, err := c.s.APIKey.Revoke(c.ctx, key.ID); err != nil {
+		c.errorf("Revoke: %v", err)
+	}
+	_, err = c.s.APIKey.Revoke(c.ctx, key.ID)
+	c.expect("Revoke twice", err, store.ErrorNotFound)
+	_, err = c.s.APIKey.GetActiveByHash(c.ctx, hash)
+	c.expect("GetActiveByHash revoked", err, store.ErrorNotFound)
+}
+
+func (c *checker) suppressions() {
+	email := c.prefix + "-bounce@example.com"
+
+	first := models.Suppression{Email: strings.ToUpper(email), Reason: "hard_bounce", Source: "storetest"}
+	second := models.Suppression{Email: email, Reason: "complaint", Source: "storetest"}
+	if err := c.s.Suppression.Add(c.ctx, &first); err != nil {
+		c.errorf("Suppression.Add: %v", err)
+	}
+	if err := c.s.Suppression.Add(c.ctx, &second); err != nil || second.Reason != "hard_bounce" {
+		c.errorf("Suppression.Add again: got reason %q, %v, want the first reason kept", second.Reason, err)
+	}
+
+	if ok, err := c.s.Suppression.IsSuppressed(c.ctx, " "+strings.ToUpper(email)); err != nil || !ok {
+		c.errorf("IsSuppressed: got %v, %v", ok, err)
+	}
+	if err := c.s.Suppression.Remove(c.ctx, email); err != nil {
+		c.errorf("Suppression.Remove: %v", err)
+	}
+	c.expect("Suppression.Remove twice", c.s.Suppression.Remove(c.ctx, email), store.ErrorNotFound)
+}
+
+func (c *checker) schedule() {
+	frequency := c.short
+	_, err := c.s.Schedule.LastRun(c.ctx, frequency)
+	c.expect("LastRun never ran", err, store.ErrorNotFound)
+
+	window := time.Now().UTC().Truncate(time.Hour)
+	for _, w := range []time.Time{window, window.Add(-time.Hour)} {
+		if err := c.s.Schedule.RecordRun(c.ctx, models.ScheduleRun{Frequency: frequency, LastWindow: w}); err != nil {
+			c.errorf("RecordRun: %v", err)
+		}
+	}
+	if run, err := c.s.Schedule.LastRun(c.ctx, frequency); err != nil || !run.LastWindow.Equal(window) {
+		c.errorf("LastRun: got %v, %v, want the later window %v kept", run.LastWindow, err, window)
+	}
+
+	sub := c.newSubscription()
+	key := c.prefix + "-digest"
+	if ok, err := c.s.Schedule.ClaimDigest(c.ctx, key, sub.ID, window); err != nil || !ok {
+		c.errorf("ClaimDigest: got %v, %v", ok, err)
+	}
+	if ok, err := c.s.Schedule.ClaimDigest(c.ctx, key, sub.ID, window); err != nil || ok {
+		c.errorf("ClaimDigest twice: got %v, %v, want false", ok, err)
+	}
+	if ok, err := c.s.Schedule.ClaimDigest(c.ctx, key+"-earlier", sub.ID, window.Add(-time.Hour)); err != nil || ok {
+		c.errorf("ClaimDigest earlier window: got %v, %v, want false", ok, err)
+	}
+
+	if err := c.s.Schedule.ReleaseDigest(c.ctx, key, sub.ID, window); err != nil {
+		c.errorf("ReleaseDigest: %v", err)
+	}
+	if ok, err := c.s.Schedule.ClaimDigest(c.ctx, key, sub.ID, window); err != nil || !ok {
+		c.errorf("ClaimDigest after release: got %v, %v", ok, err)
+	}
+
+	// a release puts back the window the claim replaced, not none
+	next := window.Add(time.Hour)
+	if ok, err := c.s.Schedule.ClaimDigest(c.ctx, key+"-next", sub.ID, next); err != nil || !ok {
+		c.errorf("ClaimDigest next window: got %v, %v", ok, err)
+	}
+	if err := c.s.Schedule.ReleaseDigest(c.ctx, key+"-next", sub.ID, next); err != nil {
+		c.errorf("ReleaseDigest next window: %v", err)
+	}
+	if ok, err := c.s.Schedule.ClaimDigest(c.ctx, key+"-again", sub.ID, window); err != nil || ok {
+		c.errorf("ClaimDigest released over window: got %v, %v, want false", ok, err)
+	}
+
+	// the refused claim of the earlier window took no key
+	if ok, err := c.s.Schedule.ClaimDigest(c.ctx, key+"-earlier", sub.ID, next); err != nil || !ok {
+		c.errorf("ClaimDigest with the key of a refused claim: got %v, %v", ok, err)
+	}
+}
+
+func (c *checker) outbox() {
+	msg := models.OutboxMessage{Topic: c.short, Payload: []byte(`{"to":"` + c.prefix + `"}`)}
+	if err := c.s.Outbox.Add(c.ctx, &msg); err != nil || msg.ID == 0 {
+		c.errorf("Outbox.Add: got id %d, %v", msg.ID, err)
+	}
+
+	claimed, ok := c.claim(msg.ID)
+	if !ok || claimed.Attempts != 1 || string(claimed.Payload) != string(msg.Payload) {
+		c.errorf("Outbox.Claim: got %+v, %v, want the message with 1 attempt", claimed, ok)
+	}
+	if _, ok := c.claim(msg.ID); ok {
+		c.errorf("Outbox.Claim leased: got the message again")
+	}
+
+	other := models.OutboxMessage{Topic: c.short + "-other", Payload: []byte(`{}`)}
+	if err := c.s.Outbox.Add(c.ctx, &other); err != nil {
+		c.errorf("Outbox.Add: %v", err)
+	}
+	if _, ok := c.claim(other.ID); ok {
+		c.errorf("Outbox.Claim: got a message of another topic")
+	}
+	if err := c.s.Outbox.MarkFailed(c.ctx, other.ID, "not claimed"); err != nil {
+		c.errorf("Outbox.MarkFailed: %v", err)
+	}
+
+	if err := c.s.Outbox.Retry(c.ctx, msg.ID, time.Now().Add(-time.Second), "try again"); err != nil {
+		c.errorf("Outbox.Retry: %v", err)
+	}
+	if claimed, ok := c.claim(msg.ID); !ok || claimed.Attempts != 2 || claimed.LastError != "try again" {
+		c.errorf("Outbox.Claim after Retry: got %+v, %v", claimed, ok)
+	}
+
+	if err := c.s.Outbox.MarkSent(c.ctx, msg.ID); err != nil {
+		c.errorf("Outbox.MarkSent: %v", err)
+	}
+	if err := c.s.Outbox.Retry(c.ctx, msg.ID, time.Now().Add(-time.Second), ""); err != nil {
+		c.errorf("Outbox.Retry sent: %v", err)
+	}
+	if _, ok := c.claim(msg.ID); ok {
+		c.errorf("Outbox.Claim sent: got the message again")
+	}
+
+	failed := models.OutboxMessage{Topic: c.short, Payload: []byte(`{}`)}
+	if err := c.s.Outbox.Add(c.ctx, &failed); err != nil {
+		c.errorf("Outbox.Add: %v", err)
+	}
+	if err := c.s.Outbox.MarkFailed(c.ctx, failed.ID, "gave up"); err != nil {
+		c.errorf("Outbox.MarkFailed: %v", err)
+	}
+	if _, ok := c.claim(failed.ID); ok {
+		c.errorf("Outbox.Claim failed: got the message again")
+	}
+	c.expect("Outbox.MarkSent unknown", c.s.Outbox.MarkSent(c.ctx, -1), store.ErrorNotFound)
+}
+
+// claim claims every due message of the check's topic and reports the one
+// with the given id.
+func (c *checker) claim(id int64) (models.OutboxMessage, bool) {
+	msgs, err := c.s.Outbox.Claim(c.ctx, []string{c.short}, 1000, time.Hour)
+	if err != nil {
+		c.errorf("Outbox.Claim: %v", err)
+	}
+	for _, msg := range msgs {
+		if msg.ID == id {
+			return msg, true
+		}
+	}
+	return models.OutboxMessage{}, false
+}
+
+func (c *checker) observations() {
+	city := c.prefix + "-city"
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-3 * time.Hour)
+	readings := []struct {
+		at          time.Duration
+		temperature float64
+		humidity    int
+	}{
+		{10 * time.Minute, 10, 40},
+		{20 * time.Minute, 20, 60},
+		{70 * time.Minute, 5, 50},
+		// retained too long, purged below
+		{-60 * 24 * time.Hour, 30, 90},
+	}
+	for _, r := range readings {
+		obs := models.Observation{
+			City:        city,
+			Provider:    "storetest",
+			Temperature: r.temperature,
+			Humidity:    r.humidity,
+			Raw:         []byte(`{}`),
+			ObservedAt:  hour.Add(r.at),
+		}
+		if err := c.s.Observation.Add(c.ctx, &obs); err != nil || obs.ID == 0 {
+			c.errorf("Observation.Add: got id %d, %v", obs.ID, err)
+		}
+	}
+
+	want := []models.ObservationBucket{
+		{Start: hour, Count: 2, Temperature: models.Aggregate{Min: 10, Max: 20, Avg: 15}, Humidity: models.Aggregate{Min: 40, Max: 60, Avg: 50}},
+		{Start: hour.Add(time.Hour), Count: 1, Temperature: models.Aggregate{Min: 5, Max: 5, Avg: 5}, Humidity: models.Aggregate{Min: 50, Max: 50, Avg: 50}},
+	}
+	got, err := c.s.Observation.Aggregate(c.ctx, strings.ToUpper(city), hour, hour.Add(2*time.Hour), time.Hour)
+	if err != nil || len(got) != len(want) {
+		c.errorf("Observation.Aggregate: got %+v, %v, want %+v", got, err, want)
+	} else {
+		for i := range want {
+			if !got[i].Start.Equal(want[i].Start) || got[i].Count != want[i].Count ||
+				got[i].Temperature != want[i].Temperature || got[i].Humidity != want[i].Humidity {
+				c.errorf("Observation.Aggregate bucket %d: got %+v, want %+v", i, got[i], want[i])
+			}
+		}
+	}
+
+	if days, err := c.s.Observation.Aggregate(c.ctx, city, hour.Add(-24*time.Hour), hour.Add(24*time.Hour), 24*time.Hour); err != nil || sumCounts(days) != 3 {
+		c.errorf("Observation.Aggregate by day: got %+v, %v, want 3 observations", days, err)
+	}
+
+	if _, err := c.s.Observation.Purge(c.ctx, 30*24*time.Hour); err != nil {
+		c.errorf("Observation.Purge: %v", err)
+	}
+	old := hour.Add(-61 * 24 * time.Hour)
+	if got, err := c.s.Observation.Aggregate(c.ctx, city, old, hour, 24*time.Hour); err != nil || len(got) != 0 {
+		c.errorf("Observation.Aggregate after Purge: got %+v, %v, want none", got, err)
+	}
+}
+
+func (c *checker) alerts() {
+	city := c.prefix + "-city"
+	expires := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	alert := models.Alert{
+		ID:        c.short + "-alert",
+		City:      city,
+		Event:     "Storm warning",
+		Severity:  models.SeveritySevere,
+		ExpiresAt: &expires,
+	}
+	if isNew, err := c.s.Alert.Record(c.ctx, &alert); err != nil || !isNew || alert.ReceivedAt.IsZero() {
+		c.errorf("Alert.Record: got new %v, received at %v, %v", isNew, alert.ReceivedAt, err)
+	}
+	again := alert
+	if isNew, err := c.s.Alert.Record(c.ctx, &again); err != nil || isNew {
+		c.errorf("Alert.Record twice: got new %v, %v, want a duplicate", isNew, err)
+	}
+	elsewhere := alert
+	elsewhere.City = city + "-2"
+	if isNew, err := c.s.Alert.Record(c.ctx, &elsewhere); err != nil || !isNew {
+		c.errorf("Alert.Record in another city: got new %v, %v", isNew, err)
+	}
+
+	got, err := c.s.Alert.List(c.ctx, strings.ToUpper(city), 10)
+	if err != nil || len(got) != 1 || got[0].ID != alert.ID || got[0].ExpiresAt == nil || !got[0].ExpiresAt.Equal(expires) || got[0].EffectiveAt != nil {
+		c.errorf("Alert.List: got %+v, %v", got, err)
+	}
+
+	sub := c.newSubscription()
+	if ok, err := c.s.Alert.ClaimDelivery(c.ctx, alert.ID, sub.ID); err != nil || !ok {
+		c.errorf("Alert.ClaimDelivery: got %v, %v", ok, err)
+	}
+	if ok, err := c.s.Alert.ClaimDelivery(c.ctx, alert.ID, sub.ID); err != nil || ok {
+		c.errorf("Alert.ClaimDelivery twice: got %v, %v, want already claimed", ok, err)
+	}
+}
+
+func (c *checker) webhooks() {
+	sub := c.newSubscription()
+
+	url := "https://example.com/" + c.prefix
+	updated, err := c.s.Subscription.UpdatePreferences(c.ctx, sub.Token, store.PreferencesUpdate{WebhookURL: &url, WebhookSecret: "first-secret"})
+	if err != nil || updated.WebhookURL != url || !updated.UsesWebhook() || updated.WebhookSecret != "first-secret" {
+		c.errorf("UpdatePreferences webhook: got %+v, %v", updated, err)
+	}
+	city := "Lviv"
+	if updated, err := c.s.Subscription.UpdatePreferences(c.ctx, sub.Token, store.PreferencesUpdate{City: &city}); err != nil || updated.WebhookSecret != "first-secret" {
+		c.errorf("UpdatePreferences without webhook: got secret %q, %v, want it kept", updated.WebhookSecret, err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		failed, err := c.s.Webhook.RecordFailure(c.ctx, sub.ID, 3)
+		disabled := i == 3
+		if err != nil || failed.WebhookFailures != i || (failed.WebhookDisabledAt != nil) != disabled {
+			c.errorf("Webhook.RecordFailure %d: got %d failures, disabled at %v, %v", i, failed.WebhookFailures, failed.WebhookDisabledAt, err)
+		}
+	}
+	_, err = c.s.Webhook.RecordFailure(c.ctx, -1, 3)
+	c.expect("Webhook.RecordFailure unknown", err, store.ErrorNotFound)
+
+	updated, err = c.s.Subscription.UpdatePreferences(c.ctx, sub.Token, store.PreferencesUpdate{WebhookURL: &url, WebhookSecret: "second-secret"})
+	if err != nil || updated.WebhookFailures != 0 || updated.WebhookDisabledAt != nil || updated.WebhookSecret != "second-secret" {
+		c.errorf("UpdatePreferences webhook again: got %d failures, disabled at %v, secret %q, %v",
+			updated.WebhookFailures, updated.WebhookDisabledAt, updated.WebhookSecret, err)
+	}
+	if got, err := c.s.Subscription.GetByID(c.ctx, sub.ID); err != nil || got.WebhookSecret != "second-secret" {
+		c.errorf("GetByID: got webhook secret %q, %v, want the stored one", got.WebhookSecret, err)
+	}
+	if _, err := c.s.Webhook.RecordFailure(c.ctx, sub.ID, 3); err != nil {
+		c.errorf("Webhook.RecordFailure: %v", err)
+	}
+	if err := c.s.Webhook.RecordSuccess(c.ctx, sub.ID); err != nil {
+		c.errorf("Webhook.RecordSuccess: %v", err)
+	}
+	if got, err := c.s.Subscription.GetByID(c.ctx, sub.ID); err != nil || got.WebhookFailures != 0 {
+		c.errorf("Webhook.RecordSuccess: got %d failures, %v", got.WebhookFailures, err)
+	}
+
+	for _, status := range []int{500, 200} {
+		d := models.WebhookDelivery{SubscriptionID: sub.ID, DeliveryID: c.short, Event: "digest", URL: url, StatusCode: status, DurationMs: 12}
+		if err := c.s.Webhook.AddDelivery(c.ctx, &d); err != nil || d.ID == 0 || d.CreatedAt.IsZero() {
+			c.errorf("Webhook.AddDelivery: got %+v, %v", d, err)
+		}
+	}
+	got, err := c.s.Webhook.ListDeliveries(c.ctx, sub.ID, 10)
+	if err != nil || len(got) != 2 || got[0].StatusCode != 200 || got[1].StatusCode != 500 || got[1].URL != url {
+		c.errorf("Webhook.ListDeliveries: got %+v, %v", got, err)
+	}
+	if got, err := c.s.Webhook.ListDeliveries(c.ctx, sub.ID, 1); err != nil || len(got) != 1 {
+		c.errorf("Webhook.ListDeliveries limited: got %+v, %v", got, err)
+	}
+	if _, err := c.s.Webhook.PurgeDeliveries(c.ctx, time.Hour); err != nil {
+		c.errorf("Webhook.PurgeDeliveries: %v", err)
+	}
+	if got, err := c.s.Webhook.ListDeliveries(c.ctx, sub.ID, 10); err != nil || len(got) != 2 {
+		c.errorf("Webhook.PurgeDeliveries removed recent deliveries: got %+v, %v", got, err)
+	}
+
+	none := ""
+	updated, err = c.s.Subscription.UpdatePreferences(c.ctx, sub.Token, store.PreferencesUpdate{WebhookURL: &none})
+	if err != nil || updated.UsesWebhook() {
+		c.errorf("UpdatePreferences without webhook: got %+v, %v", updated, err)
+	}
+}
+
+func (c *checker) chatSubscriptions() {
+	email, err := c.s.Subscription.GetByID(c.ctx, c.newSubscription().ID)
+	if err != nil || email.Channel != models.ChannelEmail || email.ChatID != 0 || !email.HasEmail() {
+		c.errorf("Subscription.Create: got channel %q, chat %d, %v, want email", email.Channel, email.ChatID, err)
+	}
+
+	c.counter++
+	chatID := time.Now().UnixNano() + int64(c.counter)
+	sub := models.Subscription{
+		Email:     models.ChatAddress(models.ChannelTelegram, chatID),
+		City:      "Kyiv",
+		Frequency: models.Daily,
+		Units:     models.Metric,
+		Token:     fmt.Sprintf("%s-chat-%d", c.prefix, c.counter),
+		Channel:   models.ChannelTelegram,
+		ChatID:    chatID,
+	}
+	if err := c.s.Subscription.Create(c.ctx, &sub); err != nil {
+		c.errorf("Subscription.Create chat: %v", err)
+		return
+	}
+	got, err := c.s.Subscription.GetByEmail(c.ctx, sub.Email)
+	if err != nil || got.Channel != models.ChannelTelegram || got.ChatID != chatID || got.DeliveryChannel() != models.ChannelTelegram || got.HasEmail() {
+		c.errorf("Subscription.GetByEmail chat: got %+v, %v", got, err)
+	}
+}
+
+func sumCounts(buckets []models.ObservationBucket) int {
+	n := 0
+	for _, b := range buckets {
+		n += b.Count
+	}
+	return n
+}
+
+func (c *checker) transactions() {
+	errRollback := errors.New("rollback")
+
+	var rolledBack models.Subscription
+	err := c.s.WithTx(c.ctx, func(tx store.Storage) error {
+		rolledBack = c.newSubscriptionIn(tx)
+		if _, err := tx.Subscription.Transition(c.ctx, rolledBack.ID, models.StatusActive, "storetest"); err != nil {
+			c.errorf("Transition in WithTx: %v", err)
+		}
+		msg := models.OutboxMessage{Topic: c.short, Payload: []byte(`{}`)}
+		if err := tx.Outbox.Add(c.ctx, &msg); err != nil {
+			c.errorf("Outbox.Add in WithTx: %v", err)
+		}
+		return errRollback
+	})
+	c.expect("WithTx rollback", err, errRollback)
+	_, err = c.s.Subscription.GetByEmail(c.ctx, rolledBack.Email)
+	c.expect("GetByEmail after rollback", err, store.ErrorNotFound)
+
+	var committed models.Subscription
+	err = c.s.WithTx(c.ctx, func(tx store.Storage) error {
+		committed = c.newSubscriptionIn(tx)
+		// a nested WithTx joins the running transaction
+		return tx.WithTx(c.ctx, func(tx store.Storage) error {
+			_, err := tx.Subscription.Transition(c.ctx, committed.ID, models.StatusActive, "storetest")
+			return err
+		})
+	})
+	if err != nil {
+		c.errorf("WithTx commit: %v", err)
+	}
+	if got, err := c.s.Subscription.GetByEmail(c.ctx, committed.Email); err != nil || got.Status != models.StatusActive {
+		c.errorf("GetByEmail after commit: got %q, %v, want active", got.Status, err)
+	}
+
+	// Subscribe looks the row up after Create reported a duplicate
+	err = c.s.WithTx(c.ctx, func(tx store.Storage) error {
+		dup := committed
+		c.expect("Create duplicate in WithTx", tx.Subscription.Create(c.ctx, &dup), store.ErrorAlreadyExists)
+		_, err := tx.Subscription.GetByEmail(c.ctx, committed.Email)
+		return err
+	})
+	if err != nil {
+		c.errorf("WithTx after duplicate Create: %v", err)
+	}
+}
+
+func containsID(subs []models.Subscription, id int64) bool {
+	for _, sub := range subs {
+		if sub.ID == id {
+			return true
+		}
+	}
+	return false
+}
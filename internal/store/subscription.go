@@ -3,21 +3,37 @@ package store
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
+	"time"
 	"weather/internal/models"
 
-	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
+const subscriptionColumns = `id, email, city, frequency, units, token, confirmed, status,
+        status_changed_at, paused_until, created_at, confirmation_sent_at, confirmation_sends, alert_severities,
+        air_quality_threshold, webhook_url, webhook_failures, webhook_disabled_at,
+        channel, chat_id, webhook_secret`
+
 type SubscriptionStore struct {
-	db *sql.DB
+	db dbtx
 }
 
+// Create returns ErrorAlreadyExists for a known email. The conflict is not
+// raised as an error, so a surrounding WithTx transaction stays usable.
 func (ss *SubscriptionStore) Create(ctx context.Context, sub *models.Subscription) error {
 	query := `
-		INSERT INTO weather.subscriptions (email, city, frequency, token)
-		VALUES ($1, $2, $3, $4)
-		RETURNING weather.subscriptions.id;
+		WITH created AS (
+			INSERT INTO weather.subscriptions (email, city, frequency, units, token, channel, chat_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (email) DO NOTHING
+			RETURNING id, email, status
+		)
+		INSERT INTO weather.subscription_history (subscription_id, email, from_status, to_status, reason)
+		SELECT id, email, NULL, status, 'subscribed'
+		FROM created
+		RETURNING subscription_id;
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -29,70 +45,651 @@ func (ss *SubscriptionStore) Create(ctx context.Context, sub *models.Subscriptio
 		sub.Email,
 		sub.City,
 		sub.Frequency,
+		sub.Units,
 		sub.Token,
+		channelOf(*sub),
+		sub.ChatID,
 	)
 
 	err := row.Scan(&sub.ID)
 	if err != nil {
-		if pgErr, ok := err.(*pq.Error); ok {
-			if pgErr.Code == "23505" && pgErr.Constraint == "subscriptions_email_key" {
-				return ErrorAlreadyExists
-			}
+		if err == sql.ErrNoRows {
+			return ErrorAlreadyExists
 		}
 		return errors.Wrap(err, "failed to create subscription")
 	}
+	sub.Status = models.StatusPending
 
 	return nil
 }
 
 func (ss *SubscriptionStore) Confirm(ctx context.Context, token string) (models.Subscription, error) {
+	return ss.transition(ctx, "token = $1", token, models.StatusActive, "confirmed by link", nil)
+}
+
+func (ss *SubscriptionStore) Unsubscribe(ctx context.Context, token string) (models.Subscription, error) {
+	return ss.transition(ctx, "token = $1", token, models.StatusUnsubscribed, "unsubscribed by link", nil)
+}
+
+// Transition moves a subscription to another state if the state machine allows
+// it and records the change in weather.subscription_history.
+func (ss *SubscriptionStore) Transition(ctx context.Context, id int64, to, reason string) (models.Subscription, error) {
+	return ss.transition(ctx, "id = $1", id, to, reason, nil)
+}
+
+// Pause stops digests until the given time, or indefinitely when until is nil.
+// Pausing a paused subscription moves its end.
+func (ss *SubscriptionStore) Pause(ctx context.Context, token string, until *time.Time) (models.Subscription, error) {
+	reason := "paused indefinitely"
+	if until != nil {
+		reason = "paused until " + until.UTC().Format(time.RFC3339)
+	}
+	return ss.transition(ctx, "token = $1", token, models.StatusPaused, reason, until)
+}
+
+func (ss *SubscriptionStore) Resume(ctx context.Context, token string) (models.Subscription, error) {
+	return ss.transition(ctx, "token = $1", token, models.StatusActive, "resumed by subscriber", nil)
+}
+
+// ResumeExpired reactivates every subscription whose pause ended and returns them.
+func (ss *SubscriptionStore) ResumeExpired(ctx context.Context) ([]models.Subscription, error) {
 	const query = `
+        WITH resumed AS (
+            UPDATE weather.subscriptions
+            SET status = 'active',
+                status_changed_at = now(),
+                paused_until = NULL
+            WHERE status = 'paused'
+              AND paused_until IS NOT NULL
+              AND paused_until <= now()
+            RETURNING ` + subscriptionColumns + `
+        ), history AS (
+            INSERT INTO weather.subscription_history (subscription_id, email, from_status, to_status, reason)
+            SELECT id, email, 'paused', 'active', 'pause expired'
+            FROM resumed
+        )
+        SELECT ` + subscriptionColumns + `
+        FROM resumed;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ss.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resume expired pauses")
+	}
+	defer rows.Close()
+
+	subs := []models.Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan subscription")
+		}
+		subs = append(subs, sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to resume expired pauses")
+	}
+
+	return subs, nil
+}
+
+func (ss *SubscriptionStore) transition(ctx context.Context, where string, arg any, to, reason string, pausedUntil *time.Time) (models.Subscription, error) {
+	selectQuery := `
+        SELECT ` + subscriptionColumns + `
+        FROM weather.subscriptions
+        WHERE ` + where + `
+        FOR UPDATE;
+    `
+	const updateQuery = `
         UPDATE weather.subscriptions
-        SET confirmed = true,
-            subscribed = true
-        WHERE token = $1
-        RETURNING id, email, city, frequency, token;
+        SET status = $2,
+            status_changed_at = now(),
+            paused_until = $3,
+            confirmed = confirmed OR $2 = 'active'
+        WHERE id = $1
+        RETURNING ` + subscriptionColumns + `;
+    `
+	const historyQuery = `
+        INSERT INTO weather.subscription_history (subscription_id, email, from_status, to_status, reason)
+        VALUES ($1, $2, $3, $4, $5);
     `
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	var sub models.Subscription
-	err := ss.db.
-		QueryRowContext(ctx, query, token).
-		Scan(&sub.ID, &sub.Email, &sub.City, &sub.Frequency, &sub.Token)
+	var result models.Subscription
+	err := inTx(ctx, ss.db, func(tx dbtx) error {
+		current, err := scanSubscription(tx.QueryRowContext(ctx, selectQuery, arg))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrorNotFound
+			}
+			return errors.Wrap(err, "failed to get subscription")
+		}
+
+		result = current
+		if !models.CanTransition(current.Status, to) {
+			return ErrorInvalidTransition
+		}
+		if current.Status == to && to != models.StatusPaused {
+			return nil
+		}
+
+		result, err = scanSubscription(tx.QueryRowContext(ctx, updateQuery, current.ID, to, pausedUntil))
+		if err != nil {
+			return errors.Wrapf(err, "failed to move subscription to %s", to)
+		}
+
+		if _, err := tx.ExecContext(ctx, historyQuery, current.ID, current.Email, current.Status, to, reason); err != nil {
+			return errors.Wrap(err, "failed to record subscription history")
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrorInvalidTransition) {
+		return models.Subscription{}, err
+	}
+
+	return result, err
+}
+
+func (ss *SubscriptionStore) History(ctx context.Context, id int64) ([]models.SubscriptionEvent, error) {
+	const query = `
+        SELECT id, subscription_id, email, from_status, to_status, reason, changed_at
+        FROM weather.subscription_history
+        WHERE subscription_id = $1
+        ORDER BY changed_at, id;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ss.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get subscription history")
+	}
+	defer rows.Close()
+
+	events := []models.SubscriptionEvent{}
+	for rows.Next() {
+		var e models.SubscriptionEvent
+		if err := rows.Scan(&e.ID, &e.SubscriptionID, &e.Email, &e.FromStatus, &e.ToStatus, &e.Reason, &e.ChangedAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan subscription event")
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to get subscription history")
+	}
+
+	return events, nil
+}
+
+type SubscriptionFilter struct {
+	City      string
+	Frequency string
+	Confirmed *bool
+	Status    string
+	Limit     int
+	Offset    int
+}
+
+func (f SubscriptionFilter) where() (string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+
+	add := func(column string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if f.City != "" {
+		add("city", f.City)
+	}
+	if f.Frequency != "" {
+		add("frequency", f.Frequency)
+	}
+	if f.Confirmed != nil {
+		add("confirmed", *f.Confirmed)
+	}
+	if f.Status != "" {
+		add("status", f.Status)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (ss *SubscriptionStore) List(ctx context.Context, filter SubscriptionFilter) ([]models.Subscription, int64, error) {
+	where, args := filter.where()
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var total int64
+	countQuery := "SELECT count(*) FROM weather.subscriptions " + where
+	if err := ss.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count subscriptions")
+	}
+
+	query := fmt.Sprintf(`
+		SELECT `+subscriptionColumns+`
+		FROM weather.subscriptions
+		%s
+		ORDER BY id
+		LIMIT $%d OFFSET $%d;
+	`, where, len(args)+1, len(args)+2)
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := ss.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to list subscriptions")
+	}
+	defer rows.Close()
+
+	subs := []models.Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to scan subscription")
+		}
+		subs = append(subs, sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to list subscriptions")
+	}
+
+	return subs, total, nil
+}
+
+func (ss *SubscriptionStore) GetByID(ctx context.Context, id int64) (models.Subscription, error) {
+	const query = `
+        SELECT ` + subscriptionColumns + `
+        FROM weather.subscriptions
+        WHERE id = $1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	sub, err := scanSubscription(ss.db.QueryRowContext(ctx, query, id))
 
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.Subscription{}, ErrorNotFound
 		}
-		return models.Subscription{}, errors.Wrap(err, "failed to confirm subscription")
+		return models.Subscription{}, errors.Wrap(err, "failed to get subscription")
 	}
 
 	return sub, nil
 }
 
-func (ss *SubscriptionStore) Unsubscribe(ctx context.Context, token string) (models.Subscription, error) {
+func (ss *SubscriptionStore) Delete(ctx context.Context, id int64) (models.Subscription, error) {
+	const query = `
+        DELETE FROM weather.subscriptions
+        WHERE id = $1
+        RETURNING ` + subscriptionColumns + `;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	sub, err := scanSubscription(ss.db.QueryRowContext(ctx, query, id))
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Subscription{}, ErrorNotFound
+		}
+		return models.Subscription{}, errors.Wrap(err, "failed to delete subscription")
+	}
+
+	return sub, nil
+}
+
+func (ss *SubscriptionStore) ConfirmByID(ctx context.Context, id int64) (models.Subscription, error) {
+	return ss.transition(ctx, "id = $1", id, models.StatusActive, "confirmed by admin", nil)
+}
+
+func (ss *SubscriptionStore) CountByCity(ctx context.Context) ([]models.CityStats, error) {
+	const query = `
+        SELECT city,
+               count(*),
+               count(*) FILTER (WHERE confirmed),
+               count(*) FILTER (WHERE status = 'active')
+        FROM weather.subscriptions
+        GROUP BY city
+        ORDER BY count(*) DESC, city;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ss.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count subscriptions per city")
+	}
+	defer rows.Close()
+
+	stats := []models.CityStats{}
+	for rows.Next() {
+		var s models.CityStats
+		if err := rows.Scan(&s.City, &s.Total, &s.Confirmed, &s.Active); err != nil {
+			return nil, errors.Wrap(err, "failed to scan city stats")
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to count subscriptions per city")
+	}
+
+	return stats, nil
+}
+
+// GetByEmail ignores the case of the address, bounce reports often change
+// it. An exact match wins over one differing in case only.
+func (ss *SubscriptionStore) GetByEmail(ctx context.Context, email string) (models.Subscription, error) {
+	const query = `
+        SELECT ` + subscriptionColumns + `
+        FROM weather.subscriptions
+        WHERE lower(email) = lower($1)
+        ORDER BY email = $1 DESC, id
+        LIMIT 1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	sub, err := scanSubscription(ss.db.QueryRowContext(ctx, query, email))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Subscription{}, ErrorNotFound
+		}
+		return models.Subscription{}, errors.Wrap(err, "failed to get subscription")
+	}
+
+	return sub, nil
+}
+
+// ReplaceToken swaps the token of a subscription that still holds old. It
+// returns ErrorNotFound when the token changed meanwhile.
+func (ss *SubscriptionStore) ReplaceToken(ctx context.Context, id int64, old, replacement string) (models.Subscription, error) {
 	const query = `
         UPDATE weather.subscriptions
-        SET subscribed = false
-        WHERE token = $1
-        RETURNING id, email, city, frequency, token;
+        SET token = $3
+        WHERE id = $1 AND token = $2
+        RETURNING ` + subscriptionColumns + `;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	sub, err := scanSubscription(ss.db.QueryRowContext(ctx, query, id, old, replacement))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Subscription{}, ErrorNotFound
+		}
+		return models.Subscription{}, errors.Wrap(err, "failed to replace subscription token")
+	}
+
+	return sub, nil
+}
+
+// UpdatePending changes city, frequency and units of a pending subscription.
+func (ss *SubscriptionStore) UpdatePending(ctx context.Context, sub *models.Subscription) error {
+	const query = `
+        UPDATE weather.subscriptions
+        SET city = $2,
+            frequency = $3,
+            units = $4,
+            token = COALESCE(NULLIF($5, ''), token)
+        WHERE email = $1 AND status = 'pending'
+        RETURNING ` + subscriptionColumns + `;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	updated, err := scanSubscription(ss.db.QueryRowContext(ctx, query, sub.Email, sub.City, sub.Frequency, sub.Units, sub.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrorNotFound
+		}
+		return errors.Wrap(err, "failed to update pending subscription")
+	}
+
+	*sub = updated
+	return nil
+}
+
+// ReserveConfirmation atomically checks the resend cooldown and the per-address
+// send budget of a pending subscription and counts one more confirmation
+// email against them. It returns ErrorLimitExceeded when either is exhausted.
+func (ss *SubscriptionStore) ReserveConfirmation(ctx context.Context, id int64, limits ConfirmationLimits) error {
+	const query = `
+        UPDATE weather.subscriptions
+        SET confirmation_sends = CASE
+                WHEN confirmation_window_started_at IS NULL
+                  OR confirmation_window_started_at <= now() - $3 * interval '1 second'
+                THEN 1
+                ELSE confirmation_sends + 1
+            END,
+            confirmation_window_started_at = CASE
+                WHEN confirmation_window_started_at IS NULL
+                  OR confirmation_window_started_at <= now() - $3 * interval '1 second'
+                THEN now()
+                ELSE confirmation_window_started_at
+            END,
+            confirmation_sent_at = now()
+        WHERE id = $1
+          AND status = 'pending'
+          AND (confirmation_sent_at IS NULL
+               OR confirmation_sent_at <= now() - $2 * interval '1 second')
+          AND (confirmation_window_started_at IS NULL
+               OR confirmation_window_started_at <= now() - $3 * interval '1 second'
+               OR confirmation_sends < $4)
+        RETURNING id;
     `
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	var sub models.Subscription
 	err := ss.db.
-		QueryRowContext(ctx, query, token).
-		Scan(&sub.ID, &sub.Email, &sub.City, &sub.Frequency, &sub.Token)
+		QueryRowContext(ctx, query, id, limits.Cooldown.Seconds(), limits.Window.Seconds(), limits.MaxSends).
+		Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrorLimitExceeded
+		}
+		return errors.Wrap(err, "failed to reserve confirmation email")
+	}
+
+	return nil
+}
+
+// ConfirmationWait returns how long until ReserveConfirmation allows the next
+// confirmation email, measured on the database clock.
+func (ss *SubscriptionStore) ConfirmationWait(ctx context.Context, id int64, limits ConfirmationLimits) (time.Duration, error) {
+	const query = `
+        SELECT now(), confirmation_sent_at, confirmation_window_started_at, confirmation_sends
+        FROM weather.subscriptions
+        WHERE id = $1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var (
+		now                     time.Time
+		sentAt, windowStartedAt *time.Time
+		sends                   int
+	)
+	err := ss.db.QueryRowContext(ctx, query, id).Scan(&now, &sentAt, &windowStartedAt, &sends)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrorNotFound
+		}
+		return 0, errors.Wrap(err, "failed to get confirmation wait")
+	}
+
+	return limits.wait(now, sentAt, windowStartedAt, sends), nil
+}
+
+// PurgeUnconfirmed deletes never confirmed subscriptions older than age.
+func (ss *SubscriptionStore) PurgeUnconfirmed(ctx context.Context, age time.Duration) (int64, error) {
+	const query = `
+        DELETE FROM weather.subscriptions
+        WHERE status = 'pending'
+          AND confirmed = false
+          AND created_at < now() - $1 * interval '1 second';
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ss.db.ExecContext(ctx, query, age.Seconds())
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge unconfirmed subscriptions")
+	}
+
+	return res.RowsAffected()
+}
+
+// ListActive returns every subscription digests go to, used to fill the
+// mailer schedule on startup.
+func (ss *SubscriptionStore) ListActive(ctx context.Context) ([]models.Subscription, error) {
+	const query = `
+        SELECT ` + subscriptionColumns + `
+        FROM weather.subscriptions
+        WHERE status = 'active'
+        ORDER BY id;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ss.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list active subscriptions")
+	}
+	defer rows.Close()
+
+	subs := []models.Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan subscription")
+		}
+		subs = append(subs, sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to list active subscriptions")
+	}
+
+	return subs, nil
+}
+
+func scanSubscription(row scanner) (models.Subscription, error) {
+	var sub models.Subscription
+	err := row.Scan(
+		&sub.ID,
+		&sub.Email,
+		&sub.City,
+		&sub.Frequency,
+		&sub.Units,
+		&sub.Token,
+		&sub.Confirmed,
+		&sub.Status,
+		&sub.StatusChangedAt,
+		&sub.PausedUntil,
+		&sub.CreatedAt,
+		&sub.ConfirmationSentAt,
+		&sub.ConfirmationSends,
+		&sub.AlertSeverities,
+		&sub.AirQualityThreshold,
+		&sub.WebhookURL,
+		&sub.WebhookFailures,
+		&sub.WebhookDisabledAt,
+		&sub.Channel,
+		&sub.ChatID,
+		&sub.WebhookSecret,
+	)
+	return sub, err
+}
+
+func (ss *SubscriptionStore) GetByToken(ctx context.Context, token string) (models.Subscription, error) {
+	const query = `
+        SELECT ` + subscriptionColumns + `
+        FROM weather.subscriptions
+        WHERE token = $1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	sub, err := scanSubscription(ss.db.QueryRowContext(ctx, query, token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Subscription{}, ErrorNotFound
+		}
+		return models.Subscription{}, errors.Wrap(err, "failed to get subscription")
+	}
+
+	return sub, nil
+}
+
+// channelOf is the stored channel of sub, email unless set.
+func channelOf(sub models.Subscription) string {
+	if sub.Channel == "" {
+		return models.ChannelEmail
+	}
+	return sub.Channel
+}
+
+// PreferencesUpdate holds the fields a subscriber may change; nil fields stay as they are.
+type PreferencesUpdate struct {
+	City                *string
+	Frequency           *string
+	Units               *string
+	AlertSeverities     *models.AlertSeverities
+	AirQualityThreshold *int
+	// WebhookURL replaces the webhook and enables it again, empty switches
+	// back to email. WebhookSecret replaces the secret along with it.
+	WebhookURL    *string
+	WebhookSecret string
+}
+
+func (ss *SubscriptionStore) UpdatePreferences(ctx context.Context, token string, update PreferencesUpdate) (models.Subscription, error) {
+	const query = `
+        UPDATE weather.subscriptions
+        SET city = COALESCE($2, city),
+            frequency = COALESCE($3::weather.emails_frequency, frequency),
+            units = COALESCE($4, units),
+            alert_severities = COALESCE($5, alert_severities),
+            air_quality_threshold = COALESCE($6, air_quality_threshold),
+            webhook_url = COALESCE($7::text, webhook_url),
+            webhook_failures = CASE WHEN $7::text IS NULL THEN webhook_failures ELSE 0 END,
+            webhook_disabled_at = CASE WHEN $7::text IS NULL THEN webhook_disabled_at END,
+            webhook_secret = CASE WHEN $7::text IS NULL THEN webhook_secret ELSE $8 END
+        WHERE token = $1
+        RETURNING ` + subscriptionColumns + `;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
 
+	sub, err := scanSubscription(ss.db.QueryRowContext(ctx, query, token, update.City, update.Frequency, update.Units, update.AlertSeverities, update.AirQualityThreshold, update.WebhookURL, update.WebhookSecret))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.Subscription{}, ErrorNotFound
 		}
-		return models.Subscription{}, errors.Wrap(err, "failed to unsubscribe")
+		return models.Subscription{}, errors.Wrap(err, "failed to update subscription preferences")
 	}
 
 	return sub, nil
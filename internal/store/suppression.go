@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+type SuppressionStore struct {
+	db dbtx
+}
+
+// Add suppresses an address. Suppressing it again keeps the first reason.
+func (ss *SuppressionStore) Add(ctx context.Context, s *models.Suppression) error {
+	const query = `
+        INSERT INTO weather.suppressions (email, reason, source)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (email) DO UPDATE SET email = EXCLUDED.email
+        RETURNING email, reason, source, created_at;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := ss.db.
+		QueryRowContext(ctx, query, normalizeEmail(s.Email), s.Reason, s.Source).
+		Scan(&s.Email, &s.Reason, &s.Source, &s.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to add suppression")
+	}
+
+	return nil
+}
+
+func (ss *SuppressionStore) Remove(ctx context.Context, email string) error {
+	const query = `
+        DELETE FROM weather.suppressions
+        WHERE email = $1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ss.db.ExecContext(ctx, query, normalizeEmail(email))
+	if err != nil {
+		return errors.Wrap(err, "failed to remove suppression")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+func (ss *SuppressionStore) IsSuppressed(ctx context.Context, email string) (bool, error) {
+	const query = `
+        SELECT EXISTS (SELECT 1 FROM weather.suppressions WHERE email = $1);
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var suppressed bool
+	if err := ss.db.QueryRowContext(ctx, query, normalizeEmail(email)).Scan(&suppressed); err != nil {
+		return false, errors.Wrap(err, "failed to check suppression")
+	}
+
+	return suppressed, nil
+}
+
+func (ss *SuppressionStore) List(ctx context.Context) ([]models.Suppression, error) {
+	const query = `
+        SELECT email, reason, source, created_at
+        FROM weather.suppressions
+        ORDER BY created_at DESC;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ss.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list suppressions")
+	}
+	defer rows.Close()
+
+	list := []models.Suppression{}
+	for rows.Next() {
+		var s models.Suppression
+		if err := rows.Scan(&s.Email, &s.Reason, &s.Source, &s.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan suppression")
+		}
+		list = append(list, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to list suppressions")
+	}
+
+	return list, nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+const webhookDeliveryColumns = `id, subscription_id, delivery_id, event, url, status_code, error, duration_ms, created_at`
+
+type WebhookStore struct {
+	db dbtx
+}
+
+func (ws *WebhookStore) AddDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	const query = `
+        INSERT INTO weather.webhook_deliveries (subscription_id, delivery_id, event, url, status_code, error, duration_ms)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING id, created_at;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := ws.db.
+		QueryRowContext(ctx, query, webhookDeliveryArgs(delivery)...).
+		Scan(&delivery.ID, &delivery.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to add webhook delivery")
+	}
+
+	return nil
+}
+
+// ListDeliveries returns the latest delivery attempts of a subscription,
+// newest first.
+func (ws *WebhookStore) ListDeliveries(ctx context.Context, subscriptionID int64, limit int) ([]models.WebhookDelivery, error) {
+	const query = `
+        SELECT ` + webhookDeliveryColumns + `
+        FROM weather.webhook_deliveries
+        WHERE subscription_id = $1
+        ORDER BY created_at DESC, id DESC
+        LIMIT $2;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return listWebhookDeliveries(ws.db.QueryContext(ctx, query, subscriptionID, limit))
+}
+
+func (ws *WebhookStore) PurgeDeliveries(ctx context.Context, age time.Duration) (int64, error) {
+	const query = `
+        DELETE FROM weather.webhook_deliveries
+        WHERE created_at < now() - $1 * interval '1 second';
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ws.db.ExecContext(ctx, query, age.Seconds())
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge webhook deliveries")
+	}
+
+	return res.RowsAffected()
+}
+
+// RecordSuccess resets the count of consecutive failures.
+func (ws *WebhookStore) RecordSuccess(ctx context.Context, subscriptionID int64) error {
+	const query = `
+        UPDATE weather.subscriptions
+        SET webhook_failures = 0
+        WHERE id = $1 AND webhook_failures <> 0;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := ws.db.ExecContext(ctx, query, subscriptionID); err != nil {
+		return errors.Wrap(err, "failed to record webhook success")
+	}
+
+	return nil
+}
+
+// RecordFailure counts a failed delivery and disables the webhook once
+// maxFailures happened in a row.
+func (ws *WebhookStore) RecordFailure(ctx context.Context, subscriptionID int64, maxFailures int) (models.Subscription, error) {
+	const query = `
+        UPDATE weather.subscriptions
+        SET webhook_failures = webhook_failures + 1,
+            webhook_disabled_at = CASE
+                WHEN webhook_disabled_at IS NULL AND webhook_failures + 1 >= $2 THEN now()
+                ELSE webhook_disabled_at
+            END
+        WHERE id = $1
+        RETURNING ` + subscriptionColumns + `;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return recordedFailure(scanSubscription(ws.db.QueryRowContext(ctx, query, subscriptionID, maxFailures)))
+}
+
+func recordedFailure(sub models.Subscription, err error) (models.Subscription, error) {
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Subscription{}, ErrorNotFound
+		}
+		return models.Subscription{}, errors.Wrap(err, "failed to record webhook failure")
+	}
+	return sub, nil
+}
+
+func listWebhookDeliveries(rows *sql.Rows, err error) ([]models.WebhookDelivery, error) {
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list webhook deliveries")
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.DeliveryID, &d.Event, &d.URL, &d.StatusCode, &d.Error, &d.DurationMs, &d.CreatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan webhook delivery")
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to list webhook deliveries")
+	}
+
+	return deliveries, nil
+}
+
+func webhookDeliveryArgs(d *models.WebhookDelivery) []any {
+	return []any{d.SubscriptionID, d.DeliveryID, d.Event, d.URL, d.StatusCode, d.Error, d.DurationMs}
+}
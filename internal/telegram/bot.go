@@ -0,0 +1,331 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"weather/internal/clock"
+	"weather/internal/lock"
+	"weather/internal/models"
+	"weather/internal/secrets"
+	"weather/internal/store"
+)
+
+const helpText = `Weather updates for your city.
+
+/subscribe <city> [daily|hourly] - get the weather every morning or every hour
+/weather [city] - the weather right now
+/unsubscribe - stop the updates`
+
+// pollLock is held by the one replica that long polls, Telegram answers a
+// second getUpdates of the bot with 409 Conflict.
+const pollLock = "telegram:poll"
+
+// Weather looks up the current weather of a city.
+type Weather interface {
+	GetCityWeather(city string) (models.Weather, error)
+}
+
+// TargetSyncer keeps the digest schedule in step with subscription changes.
+type TargetSyncer interface {
+	SyncTarget(sub models.Subscription)
+}
+
+// Bot answers chat commands and delivers digests to chats. Chat subscriptions
+// live in the subscription store like email ones, under a placeholder
+// address, so the digest scheduler picks them up the same way.
+type Bot struct {
+	client  *Client
+	store   store.Storage
+	weather Weather
+	targets TargetSyncer
+	clock   clock.Clock
+
+	// PollTimeout is how long one getUpdates call waits for an update.
+	PollTimeout time.Duration
+	// WebhookURL, when set, makes Telegram post updates there instead of the
+	// bot polling for them, with WebhookSecret in the secret token header.
+	WebhookURL    string
+	WebhookSecret *secrets.Secret
+	// Locker is optional, when set only the replica holding the poll lock
+	// long polls. The others try again every LockRetry to take over.
+	Locker    lock.Locker
+	LockRetry time.Duration
+
+	mx      sync.Mutex
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running bool
+}
+
+func NewBot(client *Client, store store.Storage, weather Weather, targets TargetSyncer, clk clock.Clock) *Bot {
+	return &Bot{
+		client:        client,
+		store:         store,
+		weather:       weather,
+		targets:       targets,
+		clock:         clk,
+		PollTimeout:   30 * time.Second,
+		WebhookSecret: secrets.Static(""),
+		LockRetry:     30 * time.Second,
+	}
+}
+
+// Start registers the webhook, or starts long polling when there is none.
+func (b *Bot) Start() {
+	b.mx.Lock()
+	if b.running {
+		b.mx.Unlock()
+		return
+	}
+	b.running = true
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	b.mx.Unlock()
+
+	if b.WebhookURL != "" {
+		if err := b.client.SetWebhook(ctx, b.WebhookURL, b.WebhookSecret.Get()); err != nil {
+			log.Printf("ERROR: cant set telegram webhook: %v", err)
+		}
+		return
+	}
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.lead(ctx)
+	}()
+}
+
+func (b *Bot) Stop() {
+	b.mx.Lock()
+	if !b.running {
+		b.mx.Unlock()
+		return
+	}
+	b.running = false
+	// also ends a long poll in flight
+	b.cancel()
+	b.mx.Unlock()
+	b.wg.Wait()
+}
+
+// lead long polls once it holds the poll lock, until stopped. A replica that
+// stops or dies frees the lock for another one to take over.
+func (b *Bot) lead(ctx context.Context) {
+	if b.Locker == nil {
+		b.poll(ctx)
+		return
+	}
+
+	for {
+		unlock, ok, err := b.Locker.TryLock(ctx, pollLock)
+		if err != nil {
+			log.Printf("ERROR: cant lock telegram polling: %v", err)
+		}
+		if ok {
+			b.poll(ctx)
+			unlock()
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.clock.After(b.LockRetry):
+		}
+	}
+}
+
+// poll handles updates as they come until stopped, backing off while the
+// Bot API fails.
+func (b *Bot) poll(ctx context.Context) {
+	if err := b.client.DeleteWebhook(ctx); err != nil {
+		log.Printf("ERROR: cant delete telegram webhook: %v", err)
+	}
+
+	var (
+		offset  int64
+		backoff time.Duration
+	)
+	for {
+		updates, err := b.client.GetUpdates(ctx, offset, b.PollTimeout)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("ERROR: cant get telegram updates: %v", err)
+			backoff = min(max(2*backoff, time.Second), time.Minute)
+			if apiErr := (*APIError)(nil); errors.As(err, &apiErr) && apiErr.RetryAfter > backoff {
+				backoff = apiErr.RetryAfter
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-b.clock.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+
+		for _, update := range updates {
+			b.HandleUpdate(ctx, update)
+			offset = update.UpdateID + 1
+		}
+	}
+}
+
+// HandleUpdate answers the command in update, if it has one.
+func (b *Bot) HandleUpdate(ctx context.Context, update Update) {
+	msg := update.Message
+	if msg == nil || !strings.HasPrefix(msg.Text, "/") {
+		return
+	}
+
+	fields := strings.Fields(msg.Text)
+	// in groups commands may be addressed, e.g. /weather@SomeBot
+	command, _, _ := strings.Cut(fields[0], "@")
+	args := fields[1:]
+
+	var reply string
+	switch command {
+	case "/start", "/help":
+		reply = helpText
+	case "/subscribe":
+		reply = b.subscribe(ctx, msg.Chat.ID, args)
+	case "/weather":
+		reply = b.currentWeather(ctx, msg.Chat.ID, args)
+	case "/unsubscribe":
+		reply = b.unsubscribe(ctx, msg.Chat.ID)
+	default:
+		reply = "Unknown command.\n\n" + helpText
+	}
+
+	if err := b.client.SendMessage(ctx, msg.Chat.ID, reply); err != nil {
+		log.Printf("ERROR: cant reply to telegram chat %d: %v", msg.Chat.ID, err)
+	}
+}
+
+// subscribe subscribes the chat, or moves its subscription to another city
+// or frequency. Chats need no confirmation, the command comes from the chat
+// the digests go to.
+func (b *Bot) subscribe(ctx context.Context, chatID int64, args []string) string {
+	frequency := models.Daily
+	if n := len(args); n > 1 && (args[n-1] == models.Daily || args[n-1] == models.Hourly) {
+		frequency, args = args[n-1], args[:n-1]
+	}
+	city := strings.Join(args, " ")
+	if city == "" {
+		return "Usage: /subscribe <city> [daily|hourly]"
+	}
+
+	if _, err := b.weather.GetCityWeather(city); err != nil {
+		log.Printf("ERROR: cant get weather of %q for telegram chat %d: %v", city, chatID, err)
+		return "City not found."
+	}
+
+	token, err := models.NewToken()
+	if err != nil {
+		log.Printf("ERROR: cant generate subscription token: %v", err)
+		return "Something went wrong, please try again later."
+	}
+
+	sub := models.Subscription{
+		Email:     models.ChatAddress(models.ChannelTelegram, chatID),
+		City:      city,
+		Frequency: frequency,
+		Units:     models.Metric,
+		Token:     token,
+		Channel:   models.ChannelTelegram,
+		ChatID:    chatID,
+	}
+	err = b.store.WithTx(ctx, func(tx store.Storage) error {
+		err := tx.Subscription.Create(ctx, &sub)
+		if errors.Is(err, store.ErrorAlreadyExists) {
+			sub, err = resubscribe(ctx, tx, sub)
+		}
+		if err != nil {
+			return err
+		}
+
+		sub, err = tx.Subscription.Transition(ctx, sub.ID, models.StatusActive, "subscribed on telegram")
+		return err
+	})
+	if err != nil {
+		log.Printf("ERROR: cant subscribe telegram chat %d: %v", chatID, err)
+		return "Something went wrong, please try again later."
+	}
+	b.targets.SyncTarget(sub)
+
+	return fmt.Sprintf("Subscribed to %s weather for %s. Send /unsubscribe to stop.", sub.Frequency, sub.City)
+}
+
+// resubscribe changes the existing subscription of the chat to the city and
+// frequency of sub. An unsubscribed one, or a bounced one whose chat had
+// blocked the bot, goes back to pending first, as only pending and paused
+// subscriptions may become active.
+func resubscribe(ctx context.Context, tx store.Storage, sub models.Subscription) (models.Subscription, error) {
+	existing, err := tx.Subscription.GetByEmail(ctx, sub.Email)
+	if err != nil {
+		return existing, err
+	}
+
+	if existing.Status == models.StatusUnsubscribed || existing.Status == models.StatusBounced {
+		if _, err := tx.Subscription.Transition(ctx, existing.ID, models.StatusPending, "resubscribed on telegram"); err != nil {
+			return existing, err
+		}
+	}
+
+	return tx.Subscription.UpdatePreferences(ctx, existing.Token, store.PreferencesUpdate{
+		City:      &sub.City,
+		Frequency: &sub.Frequency,
+	})
+}
+
+// currentWeather looks up the city asked for, or the subscribed one.
+func (b *Bot) currentWeather(ctx context.Context, chatID int64, args []string) string {
+	city, units := strings.Join(args, " "), models.Metric
+	sub, err := b.store.Subscription.GetByEmail(ctx, models.ChatAddress(models.ChannelTelegram, chatID))
+	switch {
+	case err == nil:
+		units = sub.Units
+		if city == "" {
+			city = sub.City
+		}
+	case !errors.Is(err, store.ErrorNotFound):
+		log.Printf("ERROR: cant get subscription of telegram chat %d: %v", chatID, err)
+	}
+	if city == "" {
+		return "Usage: /weather <city>"
+	}
+
+	weather, err := b.weather.GetCityWeather(city)
+	if err != nil {
+		log.Printf("ERROR: cant get weather of %q for telegram chat %d: %v", city, chatID, err)
+		return "City not found."
+	}
+
+	return fmt.Sprintf("Current weather in %s:\n- %s\n- Temperature: %s\n- Humidity: %d%%",
+		city, weather.Description, weather.FormatTemperature(units), weather.Humidity)
+}
+
+func (b *Bot) unsubscribe(ctx context.Context, chatID int64) string {
+	sub, err := b.store.Subscription.GetByEmail(ctx, models.ChatAddress(models.ChannelTelegram, chatID))
+	if errors.Is(err, store.ErrorNotFound) {
+		return "This chat is not subscribed."
+	}
+	if err == nil {
+		sub, err = b.store.Subscription.Transition(ctx, sub.ID, models.StatusUnsubscribed, "unsubscribed on telegram")
+	}
+	if err != nil {
+		log.Printf("ERROR: cant unsubscribe telegram chat %d: %v", chatID, err)
+		return "Something went wrong, please try again later."
+	}
+	b.targets.SyncTarget(sub)
+
+	return "Unsubscribed. Send /subscribe <city> to start again."
+}
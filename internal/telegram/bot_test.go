@@ -0,0 +1,240 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"weather/internal/clock"
+	"weather/internal/lock"
+	"weather/internal/models"
+	"weather/internal/secrets"
+	"weather/internal/store"
+)
+
+const testToken = "123:test-token"
+
+type sentMessage struct {
+	ChatID int64  `json:"chat_id"`
+	Text   string `json:"text"`
+}
+
+// botAPI stubs the Bot API. getUpdates answers with what the test queues on
+// updates, or waits like a long poll until the request ends.
+type botAPI struct {
+	t       *testing.T
+	updates chan string
+	sent    chan sentMessage
+
+	mx    sync.Mutex
+	calls map[string]int
+}
+
+func newBotAPI(t *testing.T) (*botAPI, *Client) {
+	t.Helper()
+
+	api := &botAPI{t: t, updates: make(chan string, 4), sent: make(chan sentMessage, 16), calls: make(map[string]int)}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	return api, NewClient(server.URL, secrets.Static(testToken))
+}
+
+func (api *botAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	dir, method := path.Split(r.URL.Path)
+	if dir != "/bot"+testToken+"/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	api.mx.Lock()
+	api.calls[method]++
+	api.mx.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch method {
+	case "getUpdates":
+		select {
+		case res := <-api.updates:
+			w.Write([]byte(res))
+		case <-r.Context().Done():
+		}
+	case "sendMessage":
+		var msg sentMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			api.t.Errorf("decode sendMessage: %v", err)
+		}
+		api.sent <- msg
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	case "deleteWebhook":
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"ok":false,"error_code":404,"description":"Not Found"}`))
+	}
+}
+
+func (api *botAPI) count(method string) int {
+	api.mx.Lock()
+	defer api.mx.Unlock()
+	return api.calls[method]
+}
+
+// reply waits for the next message the bot sends.
+func (api *botAPI) reply() sentMessage {
+	api.t.Helper()
+
+	select {
+	case msg := <-api.sent:
+		return msg
+	case <-time.After(5 * time.Second):
+		api.t.Fatal("bot sent no message")
+		return sentMessage{}
+	}
+}
+
+func updateOf(id, chatID int64, text string) string {
+	res, _ := json.Marshal(map[string]any{
+		"ok":     true,
+		"result": []Update{{UpdateID: id, Message: &Message{MessageID: id, Chat: Chat{ID: chatID}, Text: text}}},
+	})
+	return string(res)
+}
+
+// anyCity finds every city.
+type anyCity struct{}
+
+func (anyCity) GetCityWeather(string) (models.Weather, error) {
+	return models.Weather{Temperature: 12, Humidity: 60, Description: "Cloudy"}, nil
+}
+
+type syncer struct {
+	mx   sync.Mutex
+	subs []models.Subscription
+}
+
+func (s *syncer) SyncTarget(sub models.Subscription) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.subs = append(s.subs, sub)
+}
+
+func newTestBot(t *testing.T) (*Bot, *botAPI, store.Storage, *clock.Fake) {
+	t.Helper()
+
+	api, client := newBotAPI(t)
+	fake := clock.NewFake(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	storage := store.NewMemoryStorage(fake)
+	bot := NewBot(client, storage, anyCity{}, &syncer{}, fake)
+	bot.PollTimeout = time.Second
+
+	return bot, api, storage, fake
+}
+
+func TestPollBacksOffForRetryAfter(t *testing.T) {
+	bot, api, storage, fake := newTestBot(t)
+
+	api.updates <- `{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":7}}`
+	api.updates <- updateOf(10, 42, "/subscribe New York hourly")
+	bot.Start()
+	defer bot.Stop()
+
+	// the 429 asks for 7s, longer than the first backoff of a second
+	fake.BlockUntil(1)
+	fake.Advance(6 * time.Second)
+	if got := fake.Waiters(); got != 1 {
+		t.Fatalf("got %d waiters after 6s, want the poller still backing off", got)
+	}
+	if got := api.count("getUpdates"); got != 1 {
+		t.Fatalf("got %d getUpdates during the backoff, want 1", got)
+	}
+	fake.Advance(time.Second)
+
+	msg := api.reply()
+	if msg.ChatID != 42 || msg.Text != "Subscribed to hourly weather for New York. Send /unsubscribe to stop." {
+		t.Errorf("got reply %+v", msg)
+	}
+
+	sub, err := storage.Subscription.GetByEmail(context.Background(), models.ChatAddress(models.ChannelTelegram, 42))
+	if err != nil || sub.City != "New York" || sub.Frequency != models.Hourly || sub.Status != models.StatusActive || sub.ChatID != 42 {
+		t.Errorf("got %+v, %v, want an active hourly subscription for New York", sub, err)
+	}
+}
+
+func TestHandleUpdateSubscribe(t *testing.T) {
+	tests := []struct {
+		text      string
+		city      string
+		frequency string
+		reply     string
+	}{
+		{"/subscribe Kyiv", "Kyiv", models.Daily, "Subscribed to daily weather for Kyiv."},
+		{"/subscribe New York hourly", "New York", models.Hourly, "Subscribed to hourly weather for New York."},
+		{"/subscribe@WeatherBot Rio de Janeiro daily", "Rio de Janeiro", models.Daily, "Subscribed to daily weather for Rio de Janeiro."},
+		{"/subscribe", "", "", "Usage: /subscribe <city> [daily|hourly]"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			ctx := context.Background()
+			bot, api, storage, _ := newTestBot(t)
+			chatID := int64(100 + i)
+
+			bot.HandleUpdate(ctx, Update{UpdateID: 1, Message: &Message{Chat: Chat{ID: chatID}, Text: tt.text}})
+
+			if msg := api.reply(); msg.ChatID != chatID || !strings.HasPrefix(msg.Text, tt.reply) {
+				t.Errorf("got reply %+v, want %q", msg, tt.reply)
+			}
+			sub, err := storage.Subscription.GetByEmail(ctx, models.ChatAddress(models.ChannelTelegram, chatID))
+			if tt.city == "" {
+				if err == nil {
+					t.Errorf("got subscription %+v, want none", sub)
+				}
+				return
+			}
+			if err != nil || sub.City != tt.city || sub.Frequency != tt.frequency {
+				t.Errorf("got %q %q, %v, want %q %q", sub.City, sub.Frequency, err, tt.city, tt.frequency)
+			}
+		})
+	}
+}
+
+func TestPollOnlyWithLock(t *testing.T) {
+	bot, api, _, fake := newTestBot(t)
+	locker := lock.NewLocal()
+	bot.Locker = locker
+
+	// another replica polls
+	unlock, ok, err := locker.TryLock(context.Background(), pollLock)
+	if err != nil || !ok {
+		t.Fatalf("TryLock: got %v, %v", ok, err)
+	}
+
+	api.updates <- updateOf(1, 7, "/help")
+	bot.Start()
+	defer bot.Stop()
+
+	fake.BlockUntil(1)
+	if got := api.count("getUpdates") + api.count("deleteWebhook"); got != 0 {
+		t.Fatalf("got %d Bot API calls without the lock, want none", got)
+	}
+
+	// it stops, this replica takes over on its next try
+	unlock()
+	fake.Advance(bot.LockRetry)
+	if msg := api.reply(); msg.ChatID != 7 || msg.Text != helpText {
+		t.Errorf("got reply %+v, want the help", msg)
+	}
+
+	bot.Stop()
+	if unlock, ok, _ := locker.TryLock(context.Background(), pollLock); !ok {
+		t.Errorf("got the lock still held after Stop")
+	} else {
+		unlock()
+	}
+}
@@ -0,0 +1,52 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"weather/internal/mailer"
+	"weather/internal/models"
+)
+
+// maxRetryAfter is the longest rate limit a digest waits out, a longer one
+// fails the send and the window's claim is released.
+const maxRetryAfter = 5 * time.Second
+
+// SendDigest sends digest to the chat of its subscription. A chat that
+// blocked the bot bounces the subscription so it drops off the schedule.
+func (b *Bot) SendDigest(ctx context.Context, digest mailer.Digest) error {
+	body, err := mailer.RenderDigestBody(digest.Content)
+	if err != nil {
+		return err
+	}
+	text := digest.Subject + "\n\n" + body + "\nSend /unsubscribe to stop these updates."
+
+	sub := digest.Subscription
+	err = b.client.SendMessage(ctx, sub.ChatID, text)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 && apiErr.RetryAfter <= maxRetryAfter {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.clock.After(apiErr.RetryAfter):
+		}
+		err = b.client.SendMessage(ctx, sub.ChatID, text)
+	}
+
+	if errors.As(err, &apiErr) && apiErr.Blocked() {
+		bounced, terr := b.store.Subscription.Transition(ctx, sub.ID, models.StatusBounced, "telegram chat blocked the bot")
+		if terr != nil {
+			log.Printf("ERROR: cant bounce subscription %d: %v", sub.ID, terr)
+		} else {
+			b.targets.SyncTarget(bounced)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("send digest to telegram chat %d: %w", sub.ChatID, err)
+	}
+
+	return nil
+}
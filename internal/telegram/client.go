@@ -0,0 +1,181 @@
+// Package telegram is a chat bot on the Telegram Bot API. Chats subscribe,
+// look up the weather and unsubscribe with commands, and get their digests
+// as messages. Updates arrive by long polling or on a webhook.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"weather/internal/secrets"
+)
+
+// DefaultBaseURL is the Bot API, tests point BaseURL at a local stub.
+const DefaultBaseURL = "https://api.telegram.org"
+
+// Update is an incoming update, only messages are handled.
+type Update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *Message `json:"message,omitempty"`
+}
+
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	Chat      Chat   `json:"chat"`
+	Text      string `json:"text"`
+}
+
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+// APIError is a request the Bot API answered with ok false.
+type APIError struct {
+	Code        int
+	Description string
+	// RetryAfter is set when the bot is rate limited.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("telegram: %d %s", e.Code, e.Description)
+}
+
+// Blocked reports whether the chat blocked the bot or is gone, messages to
+// it never go through.
+func (e *APIError) Blocked() bool {
+	return e.Code == http.StatusForbidden
+}
+
+type response struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// Client calls the Bot API methods the bot needs.
+type Client struct {
+	BaseURL string
+	token   *secrets.Secret
+	http    *http.Client
+}
+
+func NewClient(baseURL string, token *secrets.Secret) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		// requests are bounded by their context, long polls take a while
+		http: &http.Client{},
+	}
+}
+
+// GetUpdates returns the updates from offset on, waiting up to timeout for one.
+func (c *Client) GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]Update, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout+10*time.Second)
+	defer cancel()
+
+	var updates []Update
+	err := c.call(ctx, "getUpdates", map[string]any{
+		"offset":          offset,
+		"timeout":         int(timeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	}, &updates)
+	return updates, err
+}
+
+func (c *Client) SendMessage(ctx context.Context, chatID int64, text string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return c.call(ctx, "sendMessage", map[string]any{
+		"chat_id": chatID,
+		"text":    text,
+	}, nil)
+}
+
+// SetWebhook makes Telegram post updates to url with secret in the
+// X-Telegram-Bot-Api-Secret-Token header.
+func (c *Client) SetWebhook(ctx context.Context, url, secret string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return c.call(ctx, "setWebhook", map[string]any{
+		"url":             url,
+		"secret_token":    secret,
+		"allowed_updates": []string{"message"},
+	}, nil)
+}
+
+// DeleteWebhook switches back to getUpdates, which fails while a webhook is set.
+func (c *Client) DeleteWebhook(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return c.call(ctx, "deleteWebhook", map[string]any{}, nil)
+}
+
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", method, err)
+	}
+
+	// the token is read per request so a rotation applies right away
+	url := c.BaseURL + "/bot" + c.token.Get() + "/" + method
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("telegram %s: %w", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// the error holds the URL and with it the token
+		return fmt.Errorf("telegram %s: %w", method, redact(err, c.token.Get()))
+	}
+	defer resp.Body.Close()
+
+	var res response
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&res); err != nil {
+		return fmt.Errorf("telegram %s: unexpected status %s", method, resp.Status)
+	}
+	if !res.OK {
+		code := res.ErrorCode
+		if code == 0 {
+			code = resp.StatusCode
+		}
+		return &APIError{
+			Code:        code,
+			Description: res.Description,
+			RetryAfter:  time.Duration(res.Parameters.RetryAfter) * time.Second,
+		}
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(res.Result, result); err != nil {
+		return fmt.Errorf("decode %s: %w", method, err)
+	}
+	return nil
+}
+
+func redact(err error, token string) error {
+	if token == "" {
+		return err
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), token, "<token>"))
+}
@@ -6,6 +6,15 @@ import (
 
 type APIInterface interface {
 	GetCityWeather(city string) (models.Weather, error)
+	GetCityForecast(city string) (models.Forecast, error)
+	GetCityOutlook(city string) (models.Outlook, error)
+	GetCityAlerts(city string) ([]models.Alert, error)
+}
+
+// Observer receives the observation of every successful fetch. Observe runs
+// on the caller's path, so it must not block.
+type Observer interface {
+	Observe(obs models.Observation)
 }
 
 type RemoteService struct {
@@ -16,6 +25,18 @@ func (rs *RemoteService) GetCityWeather(city string) (models.Weather, error) {
 	return rs.remote.GetCityWeather(city)
 }
 
+func (rs *RemoteService) GetCityForecast(city string) (models.Forecast, error) {
+	return rs.remote.GetCityForecast(city)
+}
+
+func (rs *RemoteService) GetCityOutlook(city string) (models.Outlook, error) {
+	return rs.remote.GetCityOutlook(city)
+}
+
+func (rs *RemoteService) GetCityAlerts(city string) ([]models.Alert, error) {
+	return rs.remote.GetCityAlerts(city)
+}
+
 func NewRemoteService(api APIInterface) *RemoteService {
 	return &RemoteService{
 		remote: api,
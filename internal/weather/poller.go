@@ -0,0 +1,237 @@
+package weather
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"weather/internal/clock"
+	"weather/internal/models"
+)
+
+// CitySource lists the subscriptions whose cities are polled.
+type CitySource interface {
+	ListActive(ctx context.Context) ([]models.Subscription, error)
+}
+
+// Snapshot holds the latest weather and forecast of every polled city.
+type Snapshot struct {
+	clock clock.Clock
+	// maxAge is how long a reading is served, a few missed polls must not
+	// turn into digests with hours old weather.
+	maxAge time.Duration
+
+	mx      sync.RWMutex
+	entries map[string]snapshotEntry
+}
+
+type snapshotEntry struct {
+	outlook models.Outlook
+	// location is nil when the provider sent an unknown time zone
+	location  *time.Location
+	fetchedAt time.Time
+}
+
+// Get returns the weather of city unless it was never fetched or is stale.
+func (s *Snapshot) Get(city string) (models.Weather, bool) {
+	entry, ok := s.get(city)
+	if !ok {
+		return models.Weather{}, false
+	}
+	return entry.outlook.Weather, true
+}
+
+// Forecast returns the forecast of the city's today unless it was never
+// fetched or is stale. Today is the city's, like the provider's own day.
+func (s *Snapshot) Forecast(city string) (models.Forecast, bool) {
+	entry, ok := s.get(city)
+	if !ok || entry.location == nil {
+		return models.Forecast{}, false
+	}
+
+	year, month, day := s.clock.Now().In(entry.location).Date()
+	for _, forecast := range entry.outlook.Forecast {
+		if y, m, d := forecast.Date.Date(); y == year && m == month && d == day {
+			return forecast, true
+		}
+	}
+	return models.Forecast{}, false
+}
+
+func (s *Snapshot) get(city string) (snapshotEntry, bool) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	entry, ok := s.entries[cityKey(city)]
+	if !ok || s.clock.Now().Sub(entry.fetchedAt) > s.maxAge {
+		return snapshotEntry{}, false
+	}
+	return entry, true
+}
+
+func (s *Snapshot) put(city string, outlook models.Outlook) {
+	location, err := time.LoadLocation(outlook.TimeZone)
+	if err != nil || outlook.TimeZone == "" {
+		log.Printf("ERROR: unknown time zone %q of %q, its forecast is not cached", outlook.TimeZone, city)
+		location = nil
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.entries[cityKey(city)] = snapshotEntry{outlook: outlook, location: location, fetchedAt: s.clock.Now()}
+}
+
+// retain drops the cities nobody is subscribed to anymore.
+func (s *Snapshot) retain(keys map[string]string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for key := range s.entries {
+		if _, ok := keys[key]; !ok {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// cityKey is how cities are told apart, the same way digests batch them.
+func cityKey(city string) string {
+	return strings.ToLower(strings.TrimSpace(city))
+}
+
+// Poller refreshes the weather and forecast of every subscribed city once per
+// interval, independent of when digests go out, so a daily run at midnight
+// does not fetch every forecast at once. Fetches are spread evenly over the
+// interval so they never burst against the provider's rate limit.
+type Poller struct {
+	service  *RemoteService
+	cities   CitySource
+	clock    clock.Clock
+	interval time.Duration
+	snapshot *Snapshot
+
+	mx       sync.Mutex
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	running  bool
+}
+
+// NewPoller polls every interval, zero or less disables polling and leaves
+// the snapshot empty. Readings are served for two intervals.
+func NewPoller(service *RemoteService, cities CitySource, clk clock.Clock, interval time.Duration) *Poller {
+	return &Poller{
+		service:  service,
+		cities:   cities,
+		clock:    clk,
+		interval: interval,
+		snapshot: &Snapshot{
+			clock:   clk,
+			maxAge:  2 * interval,
+			entries: make(map[string]snapshotEntry),
+		},
+		stopChan: make(chan struct{}),
+	}
+}
+
+func (p *Poller) Snapshot() *Snapshot {
+	return p.snapshot
+}
+
+func (p *Poller) Start() {
+	if p.interval <= 0 {
+		return
+	}
+
+	p.mx.Lock()
+	if p.running {
+		p.mx.Unlock()
+		return
+	}
+	p.running = true
+	p.stopChan = make(chan struct{})
+	p.mx.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for p.poll() {
+		}
+	}()
+}
+
+func (p *Poller) Stop() {
+	p.mx.Lock()
+	if !p.running {
+		p.mx.Unlock()
+		return
+	}
+	p.running = false
+	close(p.stopChan)
+	p.mx.Unlock()
+	p.wg.Wait()
+}
+
+// poll fetches every city once, city i at i/n of the interval, and waits for
+// the interval to end. It reports false once the poller is stopped.
+func (p *Poller) poll() bool {
+	started := p.clock.Now()
+
+	cities, err := p.list()
+	if err != nil {
+		log.Printf("ERROR: cant list cities to poll: %v", err)
+		return p.sleepUntil(started.Add(p.interval))
+	}
+
+	spacing := p.interval / time.Duration(max(len(cities), 1))
+	for i, city := range cities {
+		if !p.sleepUntil(started.Add(time.Duration(i) * spacing)) {
+			return false
+		}
+
+		// one request brings the current weather and the forecast
+		outlook, err := p.service.GetCityOutlook(city)
+		if err != nil {
+			// the previous reading is served until it is stale
+			log.Printf("ERROR: cant poll weather for %q: %v", city, err)
+			continue
+		}
+		p.snapshot.put(city, outlook)
+	}
+
+	return p.sleepUntil(started.Add(p.interval))
+}
+
+// list returns one spelling of every distinct city with an active subscription.
+func (p *Poller) list() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.interval)
+	defer cancel()
+
+	subs, err := p.cities.ListActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]string)
+	cities := []string{}
+	for _, sub := range subs {
+		key := cityKey(sub.City)
+		if _, ok := keys[key]; ok || key == "" {
+			continue
+		}
+		keys[key] = sub.City
+		cities = append(cities, sub.City)
+	}
+	p.snapshot.retain(keys)
+
+	return cities, nil
+}
+
+func (p *Poller) sleepUntil(t time.Time) bool {
+	select {
+	case <-p.clock.After(t.Sub(p.clock.Now())):
+		return true
+	case <-p.stopChan:
+		return false
+	}
+}
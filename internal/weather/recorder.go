@@ -0,0 +1,99 @@
+package weather
+
+import (
+	"context"
+	"log"
+	"sync"
+	"weather/internal/clock"
+	"weather/internal/models"
+	"weather/internal/store"
+)
+
+// Recorder writes observations to the store in the background, so a slow
+// database never delays a fetch. Observations arriving while the buffer is
+// full are dropped, the history is best effort.
+type Recorder struct {
+	store store.ObservationRepository
+	clock clock.Clock
+	queue chan models.Observation
+
+	mx       sync.Mutex
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	running  bool
+}
+
+func NewRecorder(store store.ObservationRepository, clk clock.Clock, buffer int) *Recorder {
+	return &Recorder{
+		store:    store,
+		clock:    clk,
+		queue:    make(chan models.Observation, max(buffer, 1)),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Observe stamps obs with the current time and queues it.
+func (r *Recorder) Observe(obs models.Observation) {
+	obs.ObservedAt = r.clock.Now()
+
+	select {
+	case r.queue <- obs:
+	default:
+		log.Printf("ERROR: observation buffer full, dropping %s observation", obs.City)
+	}
+}
+
+func (r *Recorder) Start() {
+	r.mx.Lock()
+	if r.running {
+		r.mx.Unlock()
+		return
+	}
+	r.running = true
+	r.stopChan = make(chan struct{})
+	r.mx.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for {
+			select {
+			case obs := <-r.queue:
+				r.record(obs)
+			case <-r.stopChan:
+				r.drain()
+				return
+			}
+		}
+	}()
+}
+
+// Stop writes what is still queued before returning.
+func (r *Recorder) Stop() {
+	r.mx.Lock()
+	if !r.running {
+		r.mx.Unlock()
+		return
+	}
+	r.running = false
+	close(r.stopChan)
+	r.mx.Unlock()
+	r.wg.Wait()
+}
+
+func (r *Recorder) drain() {
+	for {
+		select {
+		case obs := <-r.queue:
+			r.record(obs)
+		default:
+			return
+		}
+	}
+}
+
+func (r *Recorder) record(obs models.Observation) {
+	if err := r.store.Add(context.Background(), &obs); err != nil {
+		log.Printf("ERROR: cant record %s observation: %v", obs.City, err)
+	}
+}
@@ -1,11 +1,17 @@
 package weather
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 	"weather/internal/models"
+	"weather/internal/secrets"
 
 	"github.com/pkg/errors"
 )
@@ -17,38 +23,250 @@ type WeatherApiResponse struct {
 		Condition struct {
 			Text string `json:"text"`
 		} `json:"condition"`
-		Humidity int `json:"humidity"`
+		Humidity   int `json:"humidity"`
+		AirQuality *struct {
+			PM25         float64 `json:"pm2_5"`
+			PM10         float64 `json:"pm10"`
+			O3           float64 `json:"o3"`
+			NO2          float64 `json:"no2"`
+			USEPAIndex   int     `json:"us-epa-index"`
+			GBDEFRAIndex int     `json:"gb-defra-index"`
+		} `json:"air_quality"`
 	} `json:"current"`
 }
 
 func (wa WeatherApiResponse) GetWeatherModel() models.Weather {
-	return models.Weather{
-		Temperature: int(wa.Current.TempC),
+	weather := models.Weather{
+		Temperature:  int(wa.Current.TempC),
+		TemperatureF: int(wa.Current.TempF),
+		Humidity:     wa.Current.Humidity,
+		Description:  wa.Current.Condition.Text,
+	}
+
+	if aq := wa.Current.AirQuality; aq != nil {
+		weather.AirQuality = &models.AirQuality{
+			PM25:         aq.PM25,
+			PM10:         aq.PM10,
+			O3:           aq.O3,
+			NO2:          aq.NO2,
+			USEPAIndex:   aq.USEPAIndex,
+			GBDEFRAIndex: aq.GBDEFRAIndex,
+		}
+	}
+
+	return weather
+}
+
+// Provider names weatherapi.com in recorded observations.
+const Provider = "weatherapi"
+
+func (wa WeatherApiResponse) GetObservation(city string, raw []byte) models.Observation {
+	return models.Observation{
+		City:        city,
+		Provider:    Provider,
+		Temperature: float64(wa.Current.TempC),
 		Humidity:    wa.Current.Humidity,
-		Description: wa.Current.Condition.Text,
+		Condition:   wa.Current.Condition.Text,
+		Raw:         raw,
 	}
 }
 
-type WeatherApi struct {
-	BaseURL string
-	ApiKey  string
+type WeatherApiForecastResponse struct {
+	Location struct {
+		TzID string `json:"tz_id"`
+	} `json:"location"`
+	Forecast struct {
+		ForecastDay []struct {
+			Date string `json:"date"`
+			Day  struct {
+				MaxTempC          float64 `json:"maxtemp_c"`
+				MinTempC          float64 `json:"mintemp_c"`
+				TotalPrecipMM     float64 `json:"totalprecip_mm"`
+				DailyChanceOfRain int     `json:"daily_chance_of_rain"`
+				DailyChanceOfSnow int     `json:"daily_chance_of_snow"`
+				Condition         struct {
+					Text string `json:"text"`
+				} `json:"condition"`
+			} `json:"day"`
+			Astro struct {
+				Sunrise string `json:"sunrise"`
+				Sunset  string `json:"sunset"`
+			} `json:"astro"`
+			Hour []struct {
+				Time         string  `json:"time"`
+				TempC        float64 `json:"temp_c"`
+				PrecipMM     float64 `json:"precip_mm"`
+				ChanceOfRain int     `json:"chance_of_rain"`
+				ChanceOfSnow int     `json:"chance_of_snow"`
+				Condition    struct {
+					Text string `json:"text"`
+				} `json:"condition"`
+			} `json:"hour"`
+		} `json:"forecastday"`
+	} `json:"forecast"`
 }
 
-func (wa *WeatherApi) GetCityWeather(city string) (models.Weather, error) {
-	reqURL := wa.BaseURL + "?key=" + wa.ApiKey + "&q=" + city
-	resp, err := http.Get(reqURL)
+// GetForecastModel converts the first forecast day.
+func (wf WeatherApiForecastResponse) GetForecastModel() (models.Forecast, error) {
+	forecasts, err := wf.GetForecastModels()
 	if err != nil {
-		return models.Weather{}, errors.Wrap(err, "unable to send GET request to weather api")
+		return models.Forecast{}, err
 	}
-	defer resp.Body.Close()
+	return forecasts[0], nil
+}
 
-	if resp.StatusCode == http.StatusBadRequest {
-		return models.Weather{}, errors.New(fmt.Sprintf("city not found: %s", city))
+// GetForecastModels converts every forecast day. Sunrise and sunset stay nil
+// on days the sun does not rise or set.
+func (wf WeatherApiForecastResponse) GetForecastModels() ([]models.Forecast, error) {
+	if len(wf.Forecast.ForecastDay) == 0 {
+		return nil, errors.New("forecast has no days")
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	forecasts := make([]models.Forecast, 0, len(wf.Forecast.ForecastDay))
+	for _, day := range wf.Forecast.ForecastDay {
+		date, err := time.Parse(time.DateOnly, day.Date)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse forecast date")
+		}
+
+		forecast := models.Forecast{
+			Date:           date,
+			Condition:      day.Day.Condition.Text,
+			MinTemperature: day.Day.MinTempC,
+			MaxTemperature: day.Day.MaxTempC,
+			ChanceOfRain:   day.Day.DailyChanceOfRain,
+			ChanceOfSnow:   day.Day.DailyChanceOfSnow,
+			Precipitation:  day.Day.TotalPrecipMM,
+			Sunrise:        astroTime(date, day.Astro.Sunrise),
+			Sunset:         astroTime(date, day.Astro.Sunset),
+		}
+
+		for _, hour := range day.Hour {
+			at, err := time.Parse("2006-01-02 15:04", hour.Time)
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to parse forecast hour")
+			}
+			forecast.Hours = append(forecast.Hours, models.ForecastHour{
+				Time:          at,
+				Temperature:   hour.TempC,
+				Condition:     hour.Condition.Text,
+				ChanceOfRain:  hour.ChanceOfRain,
+				ChanceOfSnow:  hour.ChanceOfSnow,
+				Precipitation: hour.PrecipMM,
+			})
+		}
+		forecasts = append(forecasts, forecast)
+	}
+
+	return forecasts, nil
+}
+
+// WeatherApiOutlookResponse is forecast.json, which carries the current
+// weather along with the forecast.
+type WeatherApiOutlookResponse struct {
+	WeatherApiResponse
+	WeatherApiForecastResponse
+}
+
+func (wo WeatherApiOutlookResponse) GetOutlookModel() (models.Outlook, error) {
+	forecasts, err := wo.GetForecastModels()
 	if err != nil {
-		return models.Weather{}, errors.Wrap(err, "unable to read request body")
+		return models.Outlook{}, err
+	}
+
+	return models.Outlook{
+		Weather:  wo.GetWeatherModel(),
+		Forecast: forecasts,
+		TimeZone: wo.Location.TzID,
+	}, nil
+}
+
+// astroTime reads times like "07:12 AM", anything else such as "No sunrise"
+// is nil.
+func astroTime(date time.Time, raw string) *time.Time {
+	clock, err := time.Parse("03:04 PM", raw)
+	if err != nil {
+		return nil
+	}
+	t := date.Add(time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute)
+	return &t
+}
+
+type WeatherApiAlertsResponse struct {
+	Alerts struct {
+		Alert []struct {
+			Headline    string `json:"headline"`
+			Severity    string `json:"severity"`
+			Urgency     string `json:"urgency"`
+			Areas       string `json:"areas"`
+			Event       string `json:"event"`
+			Effective   string `json:"effective"`
+			Expires     string `json:"expires"`
+			Desc        string `json:"desc"`
+			Instruction string `json:"instruction"`
+		} `json:"alert"`
+	} `json:"alerts"`
+}
+
+// GetAlertModels converts the alerts of city. The provider sends no ids, so
+// an alert is identified by a hash of what tells it apart; a changed alert
+// counts as a new one. Severities outside CAP become unknown.
+func (wa WeatherApiAlertsResponse) GetAlertModels(city string) []models.Alert {
+	alerts := []models.Alert{}
+	for _, a := range wa.Alerts.Alert {
+		severity := strings.ToLower(strings.TrimSpace(a.Severity))
+		if !models.ValidSeverity(severity) {
+			severity = models.SeverityUnknown
+		}
+
+		sum := sha256.Sum256([]byte(strings.Join([]string{a.Event, a.Headline, a.Effective, a.Expires, a.Areas}, "|")))
+		alerts = append(alerts, models.Alert{
+			ID:          hex.EncodeToString(sum[:16]),
+			City:        city,
+			Event:       a.Event,
+			Headline:    a.Headline,
+			Severity:    severity,
+			Urgency:     a.Urgency,
+			Areas:       a.Areas,
+			Description: a.Desc,
+			Instruction: a.Instruction,
+			EffectiveAt: alertTime(a.Effective),
+			ExpiresAt:   alertTime(a.Expires),
+		})
+	}
+	return alerts
+}
+
+// alertTime reads RFC 3339 times, anything else is nil.
+func alertTime(raw string) *time.Time {
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+type WeatherApi struct {
+	BaseURL string
+	// ForecastURL is the forecast.json endpoint, used for daily digests and
+	// alerts.
+	ForecastURL string
+	ApiKey      *secrets.Secret
+	// AirQuality asks for pollutant readings along with the current weather.
+	AirQuality bool
+	// Observer, if set, is told about every successful fetch.
+	Observer Observer
+}
+
+func (wa *WeatherApi) GetCityWeather(city string) (models.Weather, error) {
+	aqi := "no"
+	if wa.AirQuality {
+		aqi = "yes"
+	}
+
+	body, err := wa.get(wa.BaseURL, city, url.Values{"aqi": {aqi}})
+	if err != nil {
+		return models.Weather{}, err
 	}
 
 	var weather WeatherApiResponse
@@ -57,5 +275,109 @@ func (wa *WeatherApi) GetCityWeather(city string) (models.Weather, error) {
 		return models.Weather{}, errors.Wrap(err, "unable to unmarshal request body")
 	}
 
+	if wa.Observer != nil {
+		wa.Observer.Observe(weather.GetObservation(city, body))
+	}
+
 	return weather.GetWeatherModel(), nil
 }
+
+// GetCityForecast returns today's forecast in the city's local time.
+func (wa *WeatherApi) GetCityForecast(city string) (models.Forecast, error) {
+	body, err := wa.get(wa.ForecastURL, city, url.Values{"days": {"1"}, "aqi": {"no"}, "alerts": {"no"}})
+	if err != nil {
+		return models.Forecast{}, err
+	}
+
+	var forecast WeatherApiForecastResponse
+	err = json.Unmarshal(body, &forecast)
+	if err != nil {
+		return models.Forecast{}, errors.Wrap(err, "unable to unmarshal request body")
+	}
+
+	return forecast.GetForecastModel()
+}
+
+// outlookDays covers the city's today wherever its clock is relative to ours.
+const outlookDays = "2"
+
+// GetCityOutlook returns the current weather and the forecast from the city's
+// today on, with one request.
+func (wa *WeatherApi) GetCityOutlook(city string) (models.Outlook, error) {
+	aqi := "no"
+	if wa.AirQuality {
+		aqi = "yes"
+	}
+
+	body, err := wa.get(wa.ForecastURL, city, url.Values{"days": {outlookDays}, "aqi": {aqi}, "alerts": {"no"}})
+	if err != nil {
+		return models.Outlook{}, err
+	}
+
+	var outlook WeatherApiOutlookResponse
+	err = json.Unmarshal(body, &outlook)
+	if err != nil {
+		return models.Outlook{}, errors.Wrap(err, "unable to unmarshal request body")
+	}
+
+	model, err := outlook.GetOutlookModel()
+	if err != nil {
+		return models.Outlook{}, err
+	}
+
+	if wa.Observer != nil {
+		// only the current weather is the observation, not the whole forecast
+		raw, err := json.Marshal(outlook.WeatherApiResponse)
+		if err != nil {
+			return models.Outlook{}, errors.Wrap(err, "unable to marshal current weather")
+		}
+		wa.Observer.Observe(outlook.GetObservation(city, raw))
+	}
+
+	return model, nil
+}
+
+// GetCityAlerts returns the alerts currently published for the city.
+func (wa *WeatherApi) GetCityAlerts(city string) ([]models.Alert, error) {
+	body, err := wa.get(wa.ForecastURL, city, url.Values{"days": {"1"}, "aqi": {"no"}, "alerts": {"yes"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var alerts WeatherApiAlertsResponse
+	err = json.Unmarshal(body, &alerts)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal request body")
+	}
+
+	return alerts.GetAlertModels(city), nil
+}
+
+func (wa *WeatherApi) get(endpoint, city string, params url.Values) ([]byte, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("key", wa.ApiKey.Get())
+	params.Set("q", city)
+
+	resp, err := http.Get(endpoint + "?" + params.Encode())
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to send GET request to weather api")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest {
+		return nil, errors.New(fmt.Sprintf("city not found: %s", city))
+	}
+	// any other failure, e.g. a revoked key, must not be decoded as a reading
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.Errorf("weather api responded with %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read request body")
+	}
+
+	return body, nil
+}
@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// errNotPublic is returned when dialing an address deliveries must not reach.
+var errNotPublic = errors.New("webhook address is not public")
+
+// lookupTimeout bounds the resolution of a webhook host in ValidURL.
+const lookupTimeout = 2 * time.Second
+
+// notPublic are global unicast ranges that still lead into our network or
+// nowhere: "this network", carrier-grade NAT and benchmarking.
+var notPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// ValidURL reports whether raw is an absolute https URL whose host is public,
+// the only kind deliveries go to. Hosts are resolved, and every address they
+// resolve to must be public; the dialer checks again on delivery, when the
+// name may resolve differently.
+func ValidURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+		return false
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return public(addr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return false
+	}
+	for _, addr := range addrs {
+		if !public(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// public reports whether addr is on the internet rather than loopback, a
+// private or link-local network, or one of notPublic.
+func public(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range notPublic {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialPublic refuses connections to addresses that are not public. It runs
+// after resolution, so a name rebound to an internal address since ValidURL
+// is caught too.
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errNotPublic, address)
+	}
+	if !public(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", errNotPublic, addrPort.Addr())
+	}
+	return nil
+}
+
+// newClient posts only to public addresses. It uses no proxy, which would
+// be dialed in place of the webhook.
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second, Control: dialPublic}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,225 @@
+// Package webhook delivers digests as signed JSON to subscriptions with a
+// webhook URL. Deliveries are queued on the outbox, which retries them with
+// backoff; every attempt is logged, and a webhook failing too often in a row
+// is disabled.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"weather/internal/clock"
+	"weather/internal/mailer"
+	"weather/internal/models"
+	"weather/internal/outbox"
+	"weather/internal/store"
+)
+
+// Topic is the outbox topic of queued deliveries.
+const Topic = "webhook"
+
+const EventDigest = "digest"
+
+// Headers of every delivery. The signature is "sha256=" and the hex HMAC-SHA256
+// of the timestamp, a dot and the body under the subscription's secret, see
+// Sign.
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+var (
+	errDisabled = errors.New("webhook is disabled")
+	errRemoved  = errors.New("subscription no longer uses a webhook")
+	errNoSecret = errors.New("webhook has no signing secret, its URL must be set again")
+)
+
+// Payload is the JSON body posted for a digest.
+type Payload struct {
+	ID        string           `json:"id"`
+	Event     string           `json:"event"`
+	Frequency string           `json:"frequency"`
+	Window    time.Time        `json:"window"`
+	City      string           `json:"city"`
+	Units     string           `json:"units"`
+	Weather   models.Weather   `json:"weather"`
+	Forecast  *models.Forecast `json:"forecast,omitempty"`
+}
+
+// delivery is what is queued on the outbox, the body is signed as is.
+type delivery struct {
+	SubscriptionID int64           `json:"subscription_id"`
+	ID             string          `json:"id"`
+	Event          string          `json:"event"`
+	Body           json.RawMessage `json:"body"`
+}
+
+// NewSecret returns a random secret to sign the deliveries to one webhook.
+func NewSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Sign returns the signature header value of body sent at timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type Channel struct {
+	store store.Storage
+	clock clock.Clock
+
+	// Client posts deliveries, its timeout bounds one attempt. It only
+	// connects to public addresses.
+	Client *http.Client
+	// MaxFailures is how many failed attempts in a row disable a webhook.
+	MaxFailures int
+}
+
+func New(store store.Storage, clk clock.Clock) *Channel {
+	return &Channel{
+		store:       store,
+		clock:       clk,
+		Client:      newClient(10 * time.Second),
+		MaxFailures: 10,
+	}
+}
+
+// Handle makes relay deliver the messages queued under Topic.
+func (c *Channel) Handle(relay *outbox.Relay) {
+	relay.Handle(Topic, c.Deliver)
+}
+
+// SendDigest queues digest for its subscription.
+func (c *Channel) SendDigest(ctx context.Context, digest mailer.Digest) error {
+	sub := digest.Subscription
+	payload := Payload{
+		ID:        fmt.Sprintf("%s.%d.%d", digest.Frequency, sub.ID, digest.Window.Unix()),
+		Event:     EventDigest,
+		Frequency: digest.Frequency,
+		Window:    digest.Window,
+		City:      sub.City,
+		Units:     sub.Units,
+		Weather:   digest.Report.Current,
+		Forecast:  digest.Report.Forecast,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode webhook payload: %w", err)
+	}
+
+	return outbox.Add(ctx, c.store.Outbox, Topic, delivery{
+		SubscriptionID: sub.ID,
+		ID:             payload.ID,
+		Event:          payload.Event,
+		Body:           body,
+	})
+}
+
+// Deliver is the outbox handler of Topic. It posts to the subscription's
+// current webhook, so a changed URL gets what was still queued.
+func (c *Channel) Deliver(ctx context.Context, payload json.RawMessage) error {
+	var d delivery
+	if err := json.Unmarshal(payload, &d); err != nil {
+		return outbox.Permanent(fmt.Errorf("decode queued webhook delivery: %w", err))
+	}
+
+	sub, err := c.store.Subscription.GetByID(ctx, d.SubscriptionID)
+	if err != nil {
+		if errors.Is(err, store.ErrorNotFound) {
+			return outbox.Permanent(err)
+		}
+		return err
+	}
+	switch {
+	case !sub.UsesWebhook():
+		return outbox.Permanent(errRemoved)
+	case sub.WebhookDisabledAt != nil:
+		return outbox.Permanent(errDisabled)
+	case sub.WebhookSecret == "":
+		// set before secrets were per subscription, nothing it can verify
+		return outbox.Permanent(errNoSecret)
+	}
+
+	attempt := c.post(ctx, sub, d)
+	attempt.SubscriptionID = sub.ID
+	if err := c.store.Webhook.AddDelivery(ctx, &attempt); err != nil {
+		log.Printf("ERROR: cant log webhook delivery %s: %v", d.ID, err)
+	}
+
+	if attempt.Succeeded() {
+		// delivered, retrying because the bookkeeping failed would deliver twice
+		if err := c.store.Webhook.RecordSuccess(ctx, sub.ID); err != nil {
+			log.Printf("ERROR: cant record webhook success of subscription %d: %v", sub.ID, err)
+		}
+		return nil
+	}
+
+	failed := errors.New(attempt.Error)
+	sub, err = c.store.Webhook.RecordFailure(ctx, sub.ID, c.MaxFailures)
+	if err != nil {
+		return errors.Join(failed, err)
+	}
+	if sub.WebhookDisabledAt != nil {
+		log.Printf("disabled webhook of subscription %d after %d failed deliveries", sub.ID, sub.WebhookFailures)
+		return outbox.Permanent(failed)
+	}
+
+	return failed
+}
+
+// post makes one attempt and describes it for the delivery log.
+func (c *Channel) post(ctx context.Context, sub models.Subscription, d delivery) models.WebhookDelivery {
+	attempt := models.WebhookDelivery{DeliveryID: d.ID, Event: d.Event, URL: sub.WebhookURL}
+
+	timestamp := strconv.FormatInt(c.clock.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.WebhookURL, bytes.NewReader(d.Body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "weather-service-webhook")
+	req.Header.Set(HeaderID, d.ID)
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(sub.WebhookSecret, timestamp, d.Body))
+
+	started := c.clock.Now()
+	resp, err := c.Client.Do(req)
+	attempt.DurationMs = c.clock.Now().Sub(started).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	// drained so the connection is reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	attempt.StatusCode = resp.StatusCode
+	if !attempt.Succeeded() {
+		attempt.Error = "unexpected status " + resp.Status
+	}
+
+	return attempt
+}
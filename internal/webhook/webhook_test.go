@@ -0,0 +1,179 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"weather/internal/clock"
+	"weather/internal/models"
+	"weather/internal/store"
+)
+
+func TestSign(t *testing.T) {
+	got := Sign("secret", "1700000000", []byte(`{"id":"digest.1.1700000000"}`))
+	if want := "sha256=dc2c63220a4d8eb3e0ffa401debd266ff04ea8ea660a0de34c600e36340c255b"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if other := Sign("other", "1700000000", []byte(`{"id":"digest.1.1700000000"}`)); other == got {
+		t.Errorf("got the same signature under another secret")
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	a, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 64 || a == b {
+		t.Errorf("got secrets %q and %q, want two different 32 byte hex ones", a, b)
+	}
+}
+
+// receiver records the deliveries posted to it and answers with status.
+type receiver struct {
+	mx       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.status)
+}
+
+func (r *receiver) posts() int {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return len(r.requests)
+}
+
+// newTestChannel returns a channel posting to a local receiver, which the
+// public-only client would refuse, and a subscription using it with secret.
+func newTestChannel(t *testing.T, status int, secret string) (*Channel, *receiver, store.Storage, models.Subscription) {
+	t.Helper()
+	ctx := context.Background()
+
+	rcv := &receiver{status: status}
+	server := httptest.NewServer(rcv)
+	t.Cleanup(server.Close)
+
+	fake := clock.NewFake(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	storage := store.NewMemoryStorage(fake)
+	c := New(storage, fake)
+	c.Client = server.Client()
+
+	sub := models.Subscription{Email: "hook@example.com", City: "Kyiv", Frequency: models.Daily, Units: models.Metric, Token: "hook-token"}
+	if err := storage.Subscription.Create(ctx, &sub); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := storage.Subscription.UpdatePreferences(ctx, sub.Token, store.PreferencesUpdate{WebhookURL: &server.URL, WebhookSecret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c, rcv, storage, sub
+}
+
+func queued(t *testing.T, sub models.Subscription) json.RawMessage {
+	t.Helper()
+
+	payload, err := json.Marshal(delivery{SubscriptionID: sub.ID, ID: "digest.1.1700000000", Event: EventDigest, Body: json.RawMessage(`{"city":"Kyiv"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+func TestDeliverSignsWithSubscriptionSecret(t *testing.T) {
+	c, rcv, storage, sub := newTestChannel(t, http.StatusNoContent, "subscription-secret")
+
+	if err := c.Deliver(context.Background(), queued(t, sub)); err != nil {
+		t.Fatal(err)
+	}
+
+	if rcv.posts() != 1 {
+		t.Fatalf("got %d posts, want 1", rcv.posts())
+	}
+	req, body := rcv.requests[0], rcv.bodies[0]
+	timestamp := req.Header.Get(HeaderTimestamp)
+	if timestamp != "1792411200" {
+		t.Errorf("got timestamp %q, want the clock's", timestamp)
+	}
+	if got, want := req.Header.Get(HeaderSignature), Sign("subscription-secret", timestamp, body); got != want {
+		t.Errorf("got signature %q, want %q under the subscription's secret", got, want)
+	}
+	if req.Header.Get(HeaderID) != "digest.1.1700000000" || req.Header.Get(HeaderEvent) != EventDigest {
+		t.Errorf("got headers %v, want the delivery id and event", req.Header)
+	}
+
+	deliveries, err := storage.Webhook.ListDeliveries(context.Background(), sub.ID, 10)
+	if err != nil || len(deliveries) != 1 || !deliveries[0].Succeeded() {
+		t.Errorf("got deliveries %+v, %v, want one successful", deliveries, err)
+	}
+}
+
+func TestDeliverWithoutSecret(t *testing.T) {
+	c, rcv, _, sub := newTestChannel(t, http.StatusNoContent, "")
+
+	if err := c.Deliver(context.Background(), queued(t, sub)); !errors.Is(err, errNoSecret) {
+		t.Errorf("got %v, want %v", err, errNoSecret)
+	}
+	if rcv.posts() != 0 {
+		t.Errorf("got %d unsigned posts, want none", rcv.posts())
+	}
+}
+
+func TestDeliverDisablesFailingWebhook(t *testing.T) {
+	ctx := context.Background()
+	c, rcv, storage, sub := newTestChannel(t, http.StatusInternalServerError, "subscription-secret")
+	c.MaxFailures = 2
+
+	for i := range 2 {
+		if err := c.Deliver(ctx, queued(t, sub)); err == nil {
+			t.Fatalf("attempt %d: got no error for a 500", i+1)
+		}
+	}
+	got, err := storage.Subscription.GetByID(ctx, sub.ID)
+	if err != nil || got.WebhookFailures != 2 || got.WebhookDisabledAt == nil {
+		t.Fatalf("got %d failures, disabled at %v, %v, want the webhook disabled", got.WebhookFailures, got.WebhookDisabledAt, err)
+	}
+
+	if err := c.Deliver(ctx, queued(t, sub)); !errors.Is(err, errDisabled) {
+		t.Errorf("got %v after disabling, want %v", err, errDisabled)
+	}
+	if rcv.posts() != 2 {
+		t.Errorf("got %d posts, want none after disabling", rcv.posts())
+	}
+
+	// setting the URL again enables it, with a new secret
+	url := got.WebhookURL
+	if _, err := storage.Subscription.UpdatePreferences(ctx, sub.Token, store.PreferencesUpdate{WebhookURL: &url, WebhookSecret: "new-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	rcv.mx.Lock()
+	rcv.status = http.StatusOK
+	rcv.mx.Unlock()
+	if err := c.Deliver(ctx, queued(t, sub)); err != nil {
+		t.Fatalf("got %v after enabling again", err)
+	}
+	if req := rcv.requests[2]; req.Header.Get(HeaderSignature) != Sign("new-secret", req.Header.Get(HeaderTimestamp), rcv.bodies[2]) {
+		t.Errorf("got signature %q, want it under the new secret", req.Header.Get(HeaderSignature))
+	}
+}